@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"log/slog"
+
+	"quotient/engine/db"
+)
+
+// takeAttackPenalties records recurring penalties for approved attacks that still work.
+// It has to run after the round is saved since the penalties reference it.
+func (se *ScoringEngine) takeAttackPenalties() {
+	attacks, err := db.GetApprovedAttacks()
+	if err != nil {
+		slog.Error("failed to get approved attacks", "error", err)
+		return
+	}
+
+	penalties := []db.AttackPenaltySchema{}
+	for _, attack := range attacks {
+		if !attack.RecurringDue(se.CurrentRound, se.Config.RedTeamSettings.RecurringInterval) {
+			continue
+		}
+		penalties = append(penalties, db.AttackPenaltySchema{
+			AttackID: attack.ID,
+			TeamID:   attack.TeamID,
+			RoundID:  se.CurrentRound,
+			Points:   attack.RecurringPenalty,
+		})
+	}
+
+	if err := db.CreateAttackPenalties(penalties); err != nil {
+		slog.Error("failed to save attack penalties", "round", se.CurrentRound, "error", err)
+		return
+	}
+	if len(penalties) > 0 {
+		slog.Debug("Took recurring attack penalties", "round", se.CurrentRound, "count", len(penalties))
+	}
+}
@@ -7,10 +7,17 @@ import (
 	"log/slog"
 	"math/rand"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 )
 
+// maxOwnerLength caps how much of a check's output is treated as a koth token
+const maxOwnerLength = 256
+
+// validPool limits runner pool names to what's safe in a Redis key
+var validPool = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 // checks for each service
 type Runner interface {
 	Run(teamID uint, identifier string, roundID uint, resultsChan chan Result)
@@ -38,6 +45,8 @@ type Service struct {
 	Target       string    `toml:",omitempty"` // Target is the IP address or hostname for the box
 	ServiceType  string    `toml:",omitempty"` // ServiceType is the name of the Runner that checks the service
 	Attempts     int       `toml:",omitempty"` // Attempts is the number of times the service has been checked
+	Ownership    bool      `toml:",omitempty"` // Ownership marks a koth check whose output is the owning team's token
+	Pool         string    `toml:",omitempty"` // Pool is the runner pool that runs the check, empty for the default pool
 }
 
 type Result struct {
@@ -50,6 +59,8 @@ type Result struct {
 	Points      int    `json:"points,omitempty"`
 	ServiceType string `json:"service_type,omitempty"`
 	RoundID     uint   `json:"round_id"`
+	Owner       string `json:"owner,omitempty"`    // koth ownership token read by the check
+	HostKey     string `json:"host_key,omitempty"` // ssh host key the check saw, for pinning
 
 	// Added for runner visualization
 	RunnerID   string `json:"runner_id,omitempty"`
@@ -66,6 +77,14 @@ func (service *Service) GetName() string {
 	return service.Name
 }
 
+func (service *Service) GetPoints() int {
+	return service.Points
+}
+
+func (service *Service) GetPool() string {
+	return service.Pool
+}
+
 func (service *Service) GetAttempts() int {
 	return service.Attempts
 }
@@ -74,6 +93,10 @@ func (service *Service) GetCredlists() []string {
 	return service.CredLists
 }
 
+func (service *Service) IsOwnership() bool {
+	return service.Ownership
+}
+
 func (service *Service) SetCredlists(lists []string) {
 	service.CredLists = lists
 }
@@ -130,7 +153,30 @@ func (service *Service) getCreds(teamID uint) (string, string, error) {
 	return username, password, nil
 }
 
+// ownerToken pulls the koth ownership token out of check output. If re has a
+// capture group, the first group of the first match is the token, otherwise the
+// whole trimmed output is.
+func ownerToken(output []byte, re *regexp.Regexp) string {
+	token := output
+	if re != nil && re.NumSubexp() > 0 {
+		match := re.FindSubmatch(output)
+		if match == nil {
+			return ""
+		}
+		token = match[1]
+	}
+	owner := strings.TrimSpace(string(token))
+	if len(owner) > maxOwnerLength {
+		owner = owner[:maxOwnerLength]
+	}
+	return owner
+}
+
 func (service *Service) Configure(ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if service.Pool != "" && !validPool.MatchString(service.Pool) {
+		return fmt.Errorf("invalid runner pool %q for %s, pool names can only have letters, numbers, dashes and underscores", service.Pool, service.Display)
+	}
+
 	// Set defaults if they're unset for a service
 	if service.Target == "" {
 		service.Target = ip
@@ -155,13 +201,18 @@ func (service *Service) Configure(ip string, points int, timeout int, slapenalty
 }
 
 func (service *Service) Runnable() bool {
+	return service.RunnableAt(time.Now())
+}
+
+// RunnableAt reports whether the check should run, and be scored, at a time
+func (service *Service) RunnableAt(t time.Time) bool {
 	if service.Disabled {
 		return false
 	}
-	if service.LaunchTime.After(time.Now()) {
+	if service.LaunchTime.After(t) {
 		return false
 	}
-	if !service.StopTime.IsZero() && service.StopTime.Before(time.Now()) {
+	if !service.StopTime.IsZero() && service.StopTime.Before(t) {
 		return false
 	}
 	return true
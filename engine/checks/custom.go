@@ -117,15 +117,22 @@ func (c Custom) Run(teamID uint, teamIdentifier string, roundID uint, resultsCha
 			response <- checkResult
 			return
 		}
+		var re *regexp.Regexp
 		if c.Regex != "" {
-			re, err := regexp.Compile(c.Regex)
+			re, err = regexp.Compile(c.Regex)
 			if err != nil {
 				checkResult.Error = "error compiling regex"
 				checkResult.Debug = err.Error()
 				response <- checkResult
 				return
 			}
+		}
+
+		if c.Ownership {
+			checkResult.Owner = ownerToken(raw, re)
+		}
 
+		if re != nil {
 			reFind := re.Find([]byte(out))
 			if reFind == nil {
 				checkResult.Error = "output incorrect"
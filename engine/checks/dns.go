@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,7 +16,10 @@ import (
 
 type Dns struct {
 	Service
-	Record []DnsRecord
+	Record      []DnsRecord
+	Tcp         bool     `toml:",omitempty"` // send queries over tcp instead of udp
+	Dnssec      bool     `toml:",omitempty"` // answers must be signed by the zone's keys
+	TrustAnchor []string `toml:",omitempty"` // DS records the zone's key signing key must match, required with dnssec
 }
 
 type DnsRecord struct {
@@ -22,35 +28,50 @@ type DnsRecord struct {
 	Answer []string
 }
 
+// dnsKinds are the record kinds a dns check can look up. AXFR checks the zone
+// can't be transferred.
+var dnsKinds = map[string]uint16{
+	"A":     dns.TypeA,
+	"AAAA":  dns.TypeAAAA,
+	"CNAME": dns.TypeCNAME,
+	"TXT":   dns.TypeTXT,
+	"PTR":   dns.TypePTR,
+	"NS":    dns.TypeNS,
+	"MX":    dns.TypeMX,
+	"SRV":   dns.TypeSRV,
+	"SOA":   dns.TypeSOA,
+	"AXFR":  dns.TypeAXFR,
+}
+
 func (c Dns) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
 	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
 		// Pick a record
 		record := c.Record[rand.Intn(len(c.Record))] // #nosec G404 -- non-crypto selection of DNS record to test
-		fqdn := dns.Fqdn(strings.ReplaceAll(dns.Fqdn(record.Domain), "_", teamIdentifier))
+		domain := templateDomain(record.Domain, teamIdentifier)
+		fqdn := dns.Fqdn(domain)
+		if record.Kind == "PTR" && net.ParseIP(domain) != nil {
+			fqdn, _ = dns.ReverseAddr(domain)
+		}
+		server := net.JoinHostPort(c.Target, strconv.Itoa(c.Port))
+
+		if record.Kind == "AXFR" {
+			c.checkTransfer(fqdn, server, checkResult, response)
+			return
+		}
 
 		// Setup for dns query
 		var msg dns.Msg
-
-		// switch of kind of record (A, MX, etc)
-		// TODO: add more values
-		switch record.Kind {
-		case "A":
-			msg.SetQuestion(fqdn, dns.TypeA)
-		case "MX":
-			msg.SetQuestion(fqdn, dns.TypeMX)
+		msg.SetQuestion(fqdn, dnsKinds[record.Kind])
+		if c.Dnssec {
+			msg.SetEdns0(4096, true)
 		}
 
-		// Make it obey timeout via deadline
-		// deadctx, cancel := context.WithTimeout(context.TODO(), time.Duration(2)*time.Second)
-		// defer cancel()
-
 		// Send the query
-		client := dns.Client{Timeout: time.Duration(c.Timeout-1) * time.Second, DialTimeout: time.Duration(c.Timeout-1) * time.Second}
-		// _, _ = dns.ExchangeContext(deadctx, &msg, fmt.Sprintf("%s:%d", c.Target, c.Port)) // double tap for propagation
-		in, rtt, err := client.Exchange(&msg, fmt.Sprintf("%s:%d", c.Target, c.Port))
+		client := c.client()
+		in, rtt, err := client.Exchange(&msg, server)
 		if err != nil {
 			if errors.Is(err, os.ErrDeadlineExceeded) {
-				in, rtt, err = client.Exchange(&msg, fmt.Sprintf("%s:%d", c.Target, c.Port))
+				in, rtt, err = client.Exchange(&msg, server)
 				if err != nil {
 					checkResult.Error = "error sending query"
 					checkResult.Debug = "record " + record.Domain + ":" + fmt.Sprint(record.Answer) + fmt.Sprintf("(took %s)", rtt) + ": " + err.Error()
@@ -65,37 +86,268 @@ func (c Dns) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			}
 		}
 
+		// Only look at answers of the kind that was asked for
+		answers := []dns.RR{}
+		for _, answer := range in.Answer {
+			if answer.Header().Rrtype == dnsKinds[record.Kind] {
+				answers = append(answers, answer)
+			}
+		}
+
 		// Check if we got any records
-		if len(in.Answer) < 1 {
+		if len(answers) < 1 {
 			checkResult.Error = "no records received"
-			checkResult.Debug = "record " + record.Domain + "-> " + fmt.Sprint(record.Answer)
+			checkResult.Debug = "record " + record.Kind + " " + record.Domain + "-> " + fmt.Sprint(record.Answer) + ", received " + fmt.Sprint(in.Answer)
+			response <- checkResult
+			return
+		}
+
+		if c.Dnssec {
+			if err := c.validateDnssec(client, server, dnsKinds[record.Kind], answers, in.Answer, teamIdentifier); err != nil {
+				checkResult.Error = "dnssec validation failed"
+				checkResult.Debug = "record " + record.Kind + " " + record.Domain + ": " + err.Error()
+				response <- checkResult
+				return
+			}
+		}
+
+		// Without expected answers any record of the right kind will do
+		if len(record.Answer) == 0 {
+			checkResult.Status = true
+			checkResult.Debug = fmt.Sprintf("record %s %s returned %v", record.Kind, record.Domain, answers)
 			response <- checkResult
 			return
 		}
 
 		// Loop through results and check for correct match
-		for _, answer := range in.Answer {
-			// Check if an answer is an A record and it matches the expected IP
+		for _, answer := range answers {
 			for _, expectedAnswer := range record.Answer {
 				expectedAnswer = strings.ReplaceAll(expectedAnswer, "_", teamIdentifier)
-				if a, ok := answer.(*dns.A); ok && (a.A).String() == expectedAnswer {
+				if dnsAnswerMatches(answer, expectedAnswer) {
 					checkResult.Status = true
-					checkResult.Debug = fmt.Sprintf("record %s returned %s. acceptable answers were: %v", record.Domain, expectedAnswer, record.Answer)
+					checkResult.Debug = fmt.Sprintf("record %s %s returned %s. acceptable answers were: %v", record.Kind, record.Domain, expectedAnswer, record.Answer)
 					response <- checkResult
 					return
 				}
 			}
 		}
 
-		// If we reach here no records matched expected IP and check fails
+		// If we reach here no records matched and check fails
 		checkResult.Error = "incorrect answer(s) received from DNS"
-		checkResult.Debug = "record " + record.Domain + "-> acceptable answers were: " + fmt.Sprint(record.Answer) + ", received " + fmt.Sprint(in.Answer)
+		checkResult.Debug = "record " + record.Kind + " " + record.Domain + "-> acceptable answers were: " + fmt.Sprint(record.Answer) + ", received " + fmt.Sprint(answers)
 		response <- checkResult
 	}
 
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
 }
 
+// templateDomain puts the team identifier in place of underscores, except the
+// ones that start a label like _ldap._tcp in SRV names
+func templateDomain(domain string, teamIdentifier string) string {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if len(label) > 1 && label[0] == '_' {
+			labels[i] = "_" + strings.ReplaceAll(label[1:], "_", teamIdentifier)
+		} else {
+			labels[i] = strings.ReplaceAll(label, "_", teamIdentifier)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func (c Dns) client() *dns.Client {
+	client := &dns.Client{Timeout: time.Duration(c.Timeout-1) * time.Second, DialTimeout: time.Duration(c.Timeout-1) * time.Second}
+	if c.Tcp {
+		client.Net = "tcp"
+	}
+	return client
+}
+
+// checkTransfer passes if the server refuses to transfer the zone
+func (c Dns) checkTransfer(zone string, server string, checkResult Result, response chan Result) {
+	var msg dns.Msg
+	msg.SetAxfr(zone)
+
+	transfer := &dns.Transfer{
+		DialTimeout: time.Duration(c.Timeout-1) * time.Second,
+		ReadTimeout: time.Duration(c.Timeout-1) * time.Second,
+	}
+	envelopes, err := transfer.In(&msg, server)
+	if err != nil {
+		// the server has to be up to refuse a transfer
+		checkResult.Error = "error sending transfer request"
+		checkResult.Debug = "zone transfer of " + zone + ": " + err.Error()
+		response <- checkResult
+		return
+	}
+
+	records := 0
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			checkResult.Status = true
+			checkResult.Debug = "zone transfer of " + zone + " was refused: " + envelope.Error.Error()
+			response <- checkResult
+			return
+		}
+		records += len(envelope.RR)
+	}
+	if records == 0 {
+		checkResult.Status = true
+		checkResult.Debug = "zone transfer of " + zone + " returned no records"
+		response <- checkResult
+		return
+	}
+
+	checkResult.Error = "zone transfer allowed"
+	checkResult.Debug = fmt.Sprintf("zone transfer of %s returned %d records", zone, records)
+	response <- checkResult
+}
+
+// dnsAnswerMatches compares an answer against an expected answer written the
+// way the record would be in a zone file. MX and SRV answers can be just the
+// target host, or include the priority (and weight and port for SRV).
+func dnsAnswerMatches(answer dns.RR, expected string) bool {
+	sameName := func(a, b string) bool {
+		return strings.EqualFold(dns.Fqdn(a), dns.Fqdn(b))
+	}
+	fields := strings.Fields(expected)
+
+	switch rr := answer.(type) {
+	case *dns.A:
+		ip := net.ParseIP(expected)
+		return ip != nil && ip.Equal(rr.A)
+	case *dns.AAAA:
+		ip := net.ParseIP(expected)
+		return ip != nil && ip.Equal(rr.AAAA)
+	case *dns.CNAME:
+		return sameName(rr.Target, expected)
+	case *dns.PTR:
+		return sameName(rr.Ptr, expected)
+	case *dns.NS:
+		return sameName(rr.Ns, expected)
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "") == expected
+	case *dns.MX:
+		switch len(fields) {
+		case 1:
+			return sameName(rr.Mx, fields[0])
+		case 2:
+			return fields[0] == strconv.Itoa(int(rr.Preference)) && sameName(rr.Mx, fields[1])
+		}
+	case *dns.SRV:
+		switch len(fields) {
+		case 1:
+			return sameName(rr.Target, fields[0])
+		case 4:
+			return fields[0] == strconv.Itoa(int(rr.Priority)) && fields[1] == strconv.Itoa(int(rr.Weight)) &&
+				fields[2] == strconv.Itoa(int(rr.Port)) && sameName(rr.Target, fields[3])
+		}
+	case *dns.SOA:
+		// the primary name server, optionally followed by the admin mailbox
+		switch len(fields) {
+		case 1:
+			return sameName(rr.Ns, fields[0])
+		case 2:
+			return sameName(rr.Ns, fields[0]) && sameName(rr.Mbox, fields[1])
+		}
+	}
+	return false
+}
+
+// validateDnssec checks the answers are signed by the zone's keys, the keys are
+// signed by a key signing key, and that key matches a trust anchor. Without the
+// anchor any key the server made up would pass.
+func (c Dns) validateDnssec(client *dns.Client, server string, qtype uint16, answers []dns.RR, section []dns.RR, teamIdentifier string) error {
+	sigs := []*dns.RRSIG{}
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == qtype {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		return errors.New("answer isn't signed")
+	}
+	zone := sigs[0].SignerName
+
+	var msg dns.Msg
+	msg.SetQuestion(zone, dns.TypeDNSKEY)
+	msg.SetEdns0(4096, true)
+	in, _, err := client.Exchange(&msg, server)
+	if err != nil {
+		return fmt.Errorf("error getting DNSKEY for %s: %w", zone, err)
+	}
+	keys := []dns.RR{}
+	keySigs := []*dns.RRSIG{}
+	for _, rr := range in.Answer {
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, rr)
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDNSKEY {
+				keySigs = append(keySigs, rr)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%s has no DNSKEY records", zone)
+	}
+
+	if _, err := verifyRRSet(sigs, keys, answers); err != nil {
+		return fmt.Errorf("answer signature: %w", err)
+	}
+	ksk, err := verifyRRSet(keySigs, keys, keys)
+	if err != nil {
+		return fmt.Errorf("DNSKEY signature: %w", err)
+	}
+	if ksk.Flags&dns.SEP == 0 {
+		return fmt.Errorf("DNSKEY records for %s aren't signed by a key signing key", zone)
+	}
+
+	for _, anchor := range c.TrustAnchor {
+		rr, err := dns.NewRR(strings.ReplaceAll(anchor, "_", teamIdentifier))
+		if err != nil {
+			return fmt.Errorf("invalid trust anchor: %w", err)
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok || !strings.EqualFold(ds.Hdr.Name, zone) {
+			continue
+		}
+		if want := ksk.ToDS(ds.DigestType); want != nil && want.KeyTag == ds.KeyTag && want.Algorithm == ds.Algorithm && strings.EqualFold(want.Digest, ds.Digest) {
+			return nil
+		}
+	}
+	return fmt.Errorf("key signing key %d for %s doesn't match a trust anchor", ksk.KeyTag(), zone)
+}
+
+// verifyRRSet returns the key that made one of the valid, current signatures over the records
+func verifyRRSet(sigs []*dns.RRSIG, keys []dns.RR, rrset []dns.RR) (*dns.DNSKEY, error) {
+	if len(sigs) == 0 {
+		return nil, errors.New("no signatures")
+	}
+	var lastErr error
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(time.Now()) {
+			lastErr = fmt.Errorf("signature by key %d has expired or isn't valid yet", sig.KeyTag)
+			continue
+		}
+		for _, rr := range keys {
+			key := rr.(*dns.DNSKEY)
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if err := sig.Verify(key, rrset); err != nil {
+				lastErr = fmt.Errorf("signature by key %d doesn't verify: %w", sig.KeyTag, err)
+				continue
+			}
+			return key, nil
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no key matches signature by key %d", sig.KeyTag)
+		}
+	}
+	return nil, lastErr
+}
+
 func (c *Dns) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
 	if c.ServiceType == "" {
 		c.ServiceType = "Dns"
@@ -116,5 +368,56 @@ func (c *Dns) Verify(box string, ip string, points int, timeout int, slapenalty
 		c.Name = box + "-" + c.Display
 	}
 
+	for i := range c.Record {
+		record := &c.Record[i]
+		record.Kind = strings.ToUpper(record.Kind)
+		if _, ok := dnsKinds[record.Kind]; !ok {
+			kinds := []string{}
+			for kind := range dnsKinds {
+				kinds = append(kinds, kind)
+			}
+			slices.Sort(kinds)
+			return fmt.Errorf("dns check %s has unknown record kind %q, expected one of %s", c.Name, record.Kind, strings.Join(kinds, ", "))
+		}
+		if record.Domain == "" {
+			return fmt.Errorf("dns check %s has a %s record with no domain", c.Name, record.Kind)
+		}
+		if record.Kind == "AXFR" && len(record.Answer) > 0 {
+			return fmt.Errorf("dns check %s AXFR record for %s can't have answers, it passes when the transfer is refused", c.Name, record.Domain)
+		}
+		for _, answer := range record.Answer {
+			fields := len(strings.Fields(answer))
+			switch record.Kind {
+			case "MX":
+				if fields < 1 || fields > 2 {
+					return fmt.Errorf("dns check %s MX answer %q should be a host, or preference host", c.Name, answer)
+				}
+			case "SOA":
+				if fields < 1 || fields > 2 {
+					return fmt.Errorf("dns check %s SOA answer %q should be the primary name server, optionally followed by the admin mailbox", c.Name, answer)
+				}
+			case "SRV":
+				if fields != 1 && fields != 4 {
+					return fmt.Errorf("dns check %s SRV answer %q should be a target, or priority weight port target", c.Name, answer)
+				}
+			}
+		}
+	}
+	for _, anchor := range c.TrustAnchor {
+		rr, err := dns.NewRR(strings.ReplaceAll(anchor, "_", "1"))
+		if err != nil {
+			return fmt.Errorf("dns check %s has an invalid trust anchor: %w", c.Name, err)
+		}
+		if _, ok := rr.(*dns.DS); !ok {
+			return fmt.Errorf("dns check %s trust anchor %q isn't a DS record", c.Name, anchor)
+		}
+	}
+	if len(c.TrustAnchor) > 0 && !c.Dnssec {
+		return fmt.Errorf("dns check %s has trust anchors but dnssec isn't enabled", c.Name)
+	}
+	if c.Dnssec && len(c.TrustAnchor) == 0 {
+		return fmt.Errorf("dns check %s has dnssec enabled but no trust anchors", c.Name)
+	}
+
 	return nil
 }
@@ -0,0 +1,193 @@
+package checks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Docker checks containers through the Docker Engine API
+type Docker struct {
+	Service
+	apiAuth
+	Encrypted bool              `toml:",omitempty"` // https, usually on 2376
+	Container []dockerContainer `toml:",omitempty"`
+}
+
+// dockerContainer picks containers by name or label. Containers with a
+// healthcheck also have to be healthy.
+type dockerContainer struct {
+	Name  string `toml:",omitempty"`
+	Label string `toml:",omitempty"` // "key=value", or "key" for any value
+	Count int    `toml:",omitempty"` // how many matching containers have to be up, 1 by default
+}
+
+type dockerListedContainer struct {
+	Id    string
+	Names []string
+}
+
+type dockerInspect struct {
+	State struct {
+		Status  string
+		Running bool
+		Health  *struct {
+			Status string
+		}
+	}
+}
+
+func (c Docker) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		client, token, err := c.client(c.Timeout)
+		if err != nil {
+			checkResult.Error = "error setting up docker client"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		scheme := "http"
+		if c.Encrypted {
+			scheme = "https"
+		}
+		base := fmt.Sprintf("%s://%s:%d", scheme, c.Target, c.Port)
+
+		var up []string
+		for _, want := range c.Container {
+			filters := map[string][]string{}
+			if want.Name != "" {
+				filters["name"] = []string{"^/" + want.Name + "$"}
+			}
+			if want.Label != "" {
+				filters["label"] = []string{want.Label}
+			}
+			encoded, err := json.Marshal(filters)
+			if err != nil {
+				checkResult.Error = "error building docker request"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+
+			// only running containers are listed
+			var listed []dockerListedContainer
+			if _, err := getJSON(client, token, base+"/containers/json?filters="+url.QueryEscape(string(encoded)), &listed); err != nil {
+				checkResult.Error = "docker api request failed"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+
+			healthy := 0
+			var unhealthy []string
+			for _, container := range listed {
+				// the name filter is a regex, make sure it's really this container
+				if want.Name != "" && !slices.Contains(container.Names, "/"+want.Name) {
+					continue
+				}
+				var inspect dockerInspect
+				status, err := getJSON(client, token, base+"/containers/"+container.Id+"/json", &inspect)
+				if status == http.StatusNotFound {
+					// removed since it was listed
+					continue
+				}
+				if err != nil {
+					checkResult.Error = "docker api request failed"
+					checkResult.Debug = err.Error()
+					response <- checkResult
+					return
+				}
+				name := strings.TrimPrefix(strings.Join(container.Names, ","), "/")
+				if !inspect.State.Running {
+					unhealthy = append(unhealthy, name+" is "+inspect.State.Status)
+				} else if inspect.State.Health != nil && inspect.State.Health.Status != "healthy" {
+					unhealthy = append(unhealthy, name+" is "+inspect.State.Health.Status)
+				} else {
+					healthy++
+				}
+			}
+
+			if healthy < want.Count {
+				if len(unhealthy) > 0 {
+					checkResult.Error = "container isn't healthy"
+				} else {
+					checkResult.Error = "container isn't running"
+				}
+				checkResult.Debug = fmt.Sprintf("%d of %d %s up", healthy, want.Count, want.describe())
+				if len(unhealthy) > 0 {
+					checkResult.Debug += ", " + strings.Join(unhealthy, ", ")
+				}
+				response <- checkResult
+				return
+			}
+			up = append(up, fmt.Sprintf("%d %s", healthy, want.describe()))
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = "up: " + strings.Join(up, ", ")
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// describe names the containers for debug output
+func (d dockerContainer) describe() string {
+	var parts []string
+	if d.Name != "" {
+		parts = append(parts, "named "+d.Name)
+	}
+	if d.Label != "" {
+		parts = append(parts, "labelled "+d.Label)
+	}
+	return "containers " + strings.Join(parts, " and ")
+}
+
+func (c *Docker) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Docker"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "docker"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		if c.Encrypted {
+			c.Port = 2376
+		} else {
+			c.Port = 2375
+		}
+	}
+	if err := c.verify(); err != nil {
+		return fmt.Errorf("docker check: %w", err)
+	}
+	if !c.Encrypted && (c.CACert != "" || c.ClientCert != "") {
+		return errors.New("docker ca and client certs need encrypted")
+	}
+	if len(c.Container) == 0 {
+		return errors.New("docker check needs at least one container")
+	}
+	for i := range c.Container {
+		d := &c.Container[i]
+		if d.Name == "" && d.Label == "" {
+			return errors.New("docker container needs a name or a label")
+		}
+		if d.Count < 0 {
+			return errors.New("docker container count can't be negative")
+		}
+		if d.Count == 0 {
+			d.Count = 1
+		}
+	}
+
+	return nil
+}
@@ -2,14 +2,29 @@ package checks
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/pmezard/go-difflib/difflib"
 )
 
+// scoredFilesDir holds reference files checks compare against
+const scoredFilesDir = "./config/scoredfiles"
+
+// maxDiffLines caps how much of a diff goes into a check's debug output
+const maxDiffLines = 20
+
 // FileDifference returns the percentage difference
 // between the contents of the filename passed and
 // the contents of the file passed.
@@ -18,8 +33,32 @@ func FileDifference(fileName string, fileContent string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	diffMatcher := difflib.NewMatcher([]string{originalFileContent}, []string{fileContent})
-	return int((diffMatcher.Ratio() + 0.5) * 100), nil
+	diffMatcher := difflib.NewMatcher(difflib.SplitLines(originalFileContent), difflib.SplitLines(fileContent))
+	return 100 - int(diffMatcher.Ratio()*100+0.5), nil
+}
+
+// DiffExcerpt returns the start of a unified diff between the file and the
+// content, for showing what changed
+func DiffExcerpt(fileName string, fileContent string) (string, error) {
+	originalFileContent, err := GetFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(originalFileContent),
+		B:        difflib.SplitLines(fileContent),
+		FromFile: fileName,
+		ToFile:   "response",
+		Context:  1,
+	})
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitAfter(diff, "\n")
+	if len(lines) > maxDiffLines {
+		lines = append(lines[:maxDiffLines], fmt.Sprintf("... %d more lines\n", len(lines)-maxDiffLines))
+	}
+	return strings.TrimRight(strings.Join(lines, ""), "\n"), nil
 }
 
 // FileHash returns the sha256sum of the filename
@@ -44,7 +83,7 @@ func StringHash(fileContent string) (string, error) {
 }
 
 func GetFile(fileName string) (string, error) {
-	root, err := os.OpenRoot("./scoredfiles")
+	root, err := os.OpenRoot(scoredFilesDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to open scoredfiles directory: %w", err)
 	}
@@ -70,3 +109,109 @@ func GetFile(fileName string) (string, error) {
 	}
 	return string(fileContent), nil
 }
+
+// apiAuth is how checks of HTTPS APIs, like Docker's and Kubernetes', log
+// in. Every field is a file in config/scoredfiles.
+type apiAuth struct {
+	CACert     string `toml:",omitempty"` // PEM CA the API's cert has to chain to, otherwise it isn't checked
+	ClientCert string `toml:",omitempty"` // PEM client certificate
+	ClientKey  string `toml:",omitempty"` // PEM key for the client certificate
+	TokenFile  string `toml:",omitempty"` // bearer token
+}
+
+// client builds an HTTP client for the API and reads the bearer token
+func (a apiAuth) client(timeout int) (*http.Client, string, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: a.CACert == "", // #nosec G402 -- only skipped when no ca cert is configured
+	}
+	if a.CACert != "" {
+		ca, err := GetFile(a.CACert)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading ca cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, "", fmt.Errorf("no certificates in %s", a.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if a.ClientCert != "" {
+		cert, err := GetFile(a.ClientCert)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading client cert: %w", err)
+		}
+		key, err := GetFile(a.ClientKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading client key: %w", err)
+		}
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, "", fmt.Errorf("loading client cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	var token string
+	if a.TokenFile != "" {
+		t, err := GetFile(a.TokenFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading token: %w", err)
+		}
+		token = strings.TrimSpace(t)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true},
+		Timeout:   time.Duration(timeout) * time.Second,
+	}, token, nil
+}
+
+func (a apiAuth) verify() error {
+	for _, f := range []string{a.CACert, a.ClientCert, a.ClientKey, a.TokenFile} {
+		if f != "" && !filepath.IsLocal(f) {
+			return fmt.Errorf("%q must be a path inside config/scoredfiles", f)
+		}
+	}
+	if (a.ClientCert == "") != (a.ClientKey == "") {
+		return errors.New("clientcert and clientkey have to be set together")
+	}
+	return nil
+}
+
+// getJSON gets an API URL and decodes its JSON into v. Errors include the
+// status and the start of the body, which usually says what went wrong.
+func getJSON(client *http.Client, token, url string, v any) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Debug("failed to close api response body", "error", err)
+		}
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(body) > 200 {
+			body = body[:200]
+		}
+		return resp.StatusCode, fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("decoding %s: %w", url, err)
+	}
+	return resp.StatusCode, nil
+}
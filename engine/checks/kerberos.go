@@ -0,0 +1,285 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/miekg/dns"
+)
+
+// Kerberos logs in to a domain controller's KDC with a credlist user and
+// checks the SRV records domain members use to find the DC point at it
+type Kerberos struct {
+	Service
+	Realm    string   // kerberos realm, e.g. "CORP.TEAM_.LOCAL"
+	Spn      []string `toml:",omitempty"` // service principals that have to get tickets, e.g. "cifs/dc01.corp.team_.local"
+	Domain   string   `toml:",omitempty"` // DNS domain of the SRV records, defaults to the realm
+	Srv      []string `toml:",omitempty"` // SRV records under the domain, defaults to the DC locator records
+	Resolver string   `toml:",omitempty"` // DNS server for the SRV lookups, host or host:port, defaults to the target
+	SkipSrv  bool     `toml:",omitempty"` // only check tickets
+}
+
+// kerberosDcRecords are the records Windows looks up to find a domain controller
+var kerberosDcRecords = []string{
+	"_ldap._tcp.dc._msdcs",
+	"_kerberos._tcp.dc._msdcs",
+	"_ldap._tcp",
+	"_kerberos._tcp",
+}
+
+func (c Kerberos) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		// stop a second early so a slow DNS server is reported as such
+		deadline := time.Now().Add(time.Duration(c.Timeout)*time.Second - time.Second)
+
+		username, password, err := c.getCreds(teamID)
+		if err != nil {
+			checkResult.Error = "error getting creds"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		login := "creds used were " + username + ":" + password
+
+		realm := strings.ToUpper(strings.ReplaceAll(c.Realm, "_", teamIdentifier))
+		krb, err := krbLogin(realm, net.JoinHostPort(c.Target, strconv.Itoa(c.Port)), username, password)
+		if err != nil {
+			checkResult.Error = "kerberos login failed for " + username
+			checkResult.Debug = login + ", error: " + err.Error()
+			response <- checkResult
+			return
+		}
+		defer krb.Destroy()
+
+		spns := make([]string, len(c.Spn))
+		for i, spn := range c.Spn {
+			spn = strings.ReplaceAll(spn, "_", teamIdentifier)
+			spns[i] = spn
+			if _, _, err := krb.GetServiceTicket(spn); err != nil {
+				checkResult.Error = "service ticket request failed"
+				checkResult.Debug = "getting a ticket for " + spn + " failed with error: " + err.Error() + ", " + login
+				response <- checkResult
+				return
+			}
+		}
+		tickets := "got a TGT in " + realm
+		if len(c.Spn) > 0 {
+			tickets += " and service tickets for " + strings.Join(spns, ", ")
+		}
+
+		if c.SkipSrv {
+			checkResult.Status = true
+			checkResult.Debug = tickets + ", " + login
+			response <- checkResult
+			return
+		}
+
+		resolver := strings.ReplaceAll(c.Resolver, "_", teamIdentifier)
+		if resolver == "" {
+			resolver = c.Target
+		}
+		if _, _, err := net.SplitHostPort(resolver); err != nil {
+			resolver = net.JoinHostPort(resolver, "53")
+		}
+		target := c.Target
+		if ip := net.ParseIP(target); ip != nil {
+			target = ip.String()
+		}
+		domain := strings.ToLower(templateDomain(c.Domain, teamIdentifier))
+
+		for _, record := range c.Srv {
+			name := dns.Fqdn(templateDomain(record, teamIdentifier) + "." + domain)
+			in, err := kerberosLookup(resolver, name, dns.TypeSRV, deadline)
+			if err != nil {
+				checkResult.Error = "srv lookup failed"
+				checkResult.Debug = "looking up " + name + " on " + resolver + ": " + err.Error()
+				response <- checkResult
+				return
+			}
+
+			var srvs []*dns.SRV
+			for _, answer := range in.Answer {
+				if srv, ok := answer.(*dns.SRV); ok {
+					srvs = append(srvs, srv)
+				}
+			}
+			if len(srvs) == 0 {
+				checkResult.Error = "srv record missing"
+				checkResult.Debug = name + " has no SRV records on " + resolver + ", response code " + dns.RcodeToString[in.Rcode]
+				response <- checkResult
+				return
+			}
+
+			// the DC can be listed by name or by one of its addresses
+			found := false
+			var hosts []string
+			for _, srv := range srvs {
+				addrs := kerberosAddresses(resolver, srv.Target, in.Extra, deadline)
+				if strings.EqualFold(srv.Target, dns.Fqdn(target)) || slices.Contains(addrs, target) {
+					found = true
+					break
+				}
+				hosts = append(hosts, fmt.Sprintf("%s port %d %v", srv.Target, srv.Port, addrs))
+			}
+			if !found {
+				checkResult.Error = "srv record doesn't point at the dc"
+				checkResult.Debug = name + " points at " + strings.Join(hosts, ", ") + ", not " + target
+				response <- checkResult
+				return
+			}
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = tickets + ", " + strconv.Itoa(len(c.Srv)) + " SRV records point at " + target + ", " + login
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// krbLogin gets a TGT from the given KDC, so the runner doesn't need a
+// krb5.conf for every team's realm
+func krbLogin(realm, kdc, username, password string) (*krbclient.Client, error) {
+	cfg, err := krbconfig.NewFromString(krbConfig(realm, kdc))
+	if err != nil {
+		return nil, err
+	}
+
+	// CORP\user and user@corp.local are both just user in the realm
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+	if i := strings.Index(username, "@"); i >= 0 {
+		username = username[:i]
+	}
+
+	krb := krbclient.NewWithPassword(username, realm, password, cfg, krbclient.DisablePAFXFAST(true))
+	if err := krb.Login(); err != nil {
+		krb.Destroy()
+		return nil, err
+	}
+	return krb, nil
+}
+
+// krbConfig is a krb5.conf for a single realm and KDC. Tickets from AD carry a
+// PAC that rarely fits in a datagram, so the KDC is always asked over TCP.
+func krbConfig(realm, kdc string) string {
+	return fmt.Sprintf(`[libdefaults]
+  default_realm = %[1]s
+  dns_lookup_kdc = false
+  dns_lookup_realm = false
+  udp_preference_limit = 1
+
+[realms]
+  %[1]s = {
+    kdc = %[2]s
+  }
+`, realm, kdc)
+}
+
+// kerberosLookup sends a query over udp, retrying over tcp if the answer didn't fit
+func kerberosLookup(server, name string, qtype uint16, deadline time.Time) (*dns.Msg, error) {
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return nil, errors.New("ran out of time")
+	}
+	var msg dns.Msg
+	msg.SetQuestion(name, qtype)
+	client := &dns.Client{Timeout: timeout}
+	in, _, err := client.Exchange(&msg, server)
+	if err == nil && in.Truncated {
+		client.Net = "tcp"
+		in, _, err = client.Exchange(&msg, server)
+	}
+	return in, err
+}
+
+// kerberosAddresses finds the addresses of an SRV target, from the additional
+// records of the SRV answer if the server sent them or by looking them up
+func kerberosAddresses(server, host string, extra []dns.RR, deadline time.Time) []string {
+	var addrs []string
+	for _, rr := range extra {
+		if !strings.EqualFold(rr.Header().Name, host) {
+			continue
+		}
+		switch rr := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, rr.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, rr.AAAA.String())
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		in, err := kerberosLookup(server, host, qtype, deadline)
+		if err != nil {
+			continue
+		}
+		for _, rr := range in.Answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, rr.A.String())
+			case *dns.AAAA:
+				addrs = append(addrs, rr.AAAA.String())
+			}
+		}
+	}
+	return addrs
+}
+
+func (c *Kerberos) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Kerberos"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "kerberos"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 88
+	}
+	if c.Realm == "" {
+		return errors.New("kerberos check needs a realm")
+	}
+	if len(c.CredLists) == 0 {
+		return errors.New("kerberos check needs credlists to log in with")
+	}
+	if slices.Contains(c.Spn, "") {
+		return errors.New("kerberos spn can't be empty")
+	}
+
+	if c.SkipSrv {
+		if c.Domain != "" || len(c.Srv) > 0 || c.Resolver != "" {
+			return errors.New("kerberos domain, srv and resolver aren't used with skipsrv")
+		}
+		return nil
+	}
+	if c.Domain == "" {
+		c.Domain = strings.ToLower(c.Realm)
+	}
+	if len(c.Srv) == 0 {
+		c.Srv = slices.Clone(kerberosDcRecords)
+	}
+	for _, record := range c.Srv {
+		if record == "" || strings.HasPrefix(record, ".") || strings.HasSuffix(record, ".") {
+			return fmt.Errorf("invalid kerberos srv record %q, use a name under the domain like _ldap._tcp", record)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Kubernetes checks workloads through the Kubernetes API
+type Kubernetes struct {
+	Service
+	apiAuth
+	Namespace  string           `toml:",omitempty"` // namespace for entries that don't set one, "default" by default
+	Deployment []kubeDeployment `toml:",omitempty"`
+	Endpoints  []kubeEndpoints  `toml:",omitempty"`
+}
+
+type kubeDeployment struct {
+	Name      string
+	Namespace string `toml:",omitempty"`
+	Replicas  int    `toml:",omitempty"` // ready replicas needed, defaults to the deployment's own replica count
+}
+
+// kubeEndpoints checks a service has ready endpoints to send traffic to
+type kubeEndpoints struct {
+	Service   string
+	Namespace string `toml:",omitempty"`
+	Ready     int    `toml:",omitempty"` // ready endpoints needed, 1 by default
+}
+
+type kubeDeploymentStatus struct {
+	Spec struct {
+		Replicas *int
+	}
+	Status struct {
+		Replicas      int
+		ReadyReplicas int
+	}
+}
+
+type kubeEndpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string
+			Conditions struct {
+				Ready *bool
+			}
+		}
+	}
+}
+
+func (c Kubernetes) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		client, token, err := c.client(c.Timeout)
+		if err != nil {
+			checkResult.Error = "error setting up kubernetes client"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		base := fmt.Sprintf("https://%s:%d", c.Target, c.Port)
+
+		apiFailed := func(status int, err error) {
+			switch status {
+			case http.StatusUnauthorized, http.StatusForbidden:
+				checkResult.Error = "kubernetes api rejected the credentials"
+			default:
+				checkResult.Error = "kubernetes api request failed"
+			}
+			checkResult.Debug = err.Error()
+			response <- checkResult
+		}
+
+		var up []string
+		for _, d := range c.Deployment {
+			var deployment kubeDeploymentStatus
+			status, err := getJSON(client, token, fmt.Sprintf("%s/apis/apps/v1/namespaces/%s/deployments/%s", base, url.PathEscape(d.Namespace), url.PathEscape(d.Name)), &deployment)
+			if status == http.StatusNotFound {
+				checkResult.Error = "deployment not found"
+				checkResult.Debug = "no deployment " + d.Namespace + "/" + d.Name
+				response <- checkResult
+				return
+			}
+			if err != nil {
+				apiFailed(status, err)
+				return
+			}
+
+			want := d.Replicas
+			if want == 0 {
+				// a deployment scaled to zero isn't up
+				want = 1
+				if deployment.Spec.Replicas != nil {
+					want = max(*deployment.Spec.Replicas, 1)
+				}
+			}
+			if deployment.Status.ReadyReplicas < want {
+				checkResult.Error = "deployment doesn't have enough ready replicas"
+				checkResult.Debug = fmt.Sprintf("deployment %s/%s has %d of %d replicas ready, wanted %d", d.Namespace, d.Name, deployment.Status.ReadyReplicas, deployment.Status.Replicas, want)
+				response <- checkResult
+				return
+			}
+			up = append(up, fmt.Sprintf("deployment %s/%s has %d ready", d.Namespace, d.Name, deployment.Status.ReadyReplicas))
+		}
+
+		for _, e := range c.Endpoints {
+			var list kubeEndpointSliceList
+			query := url.Values{"labelSelector": {"kubernetes.io/service-name=" + e.Service}}
+			status, err := getJSON(client, token, fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s", base, url.PathEscape(e.Namespace), query.Encode()), &list)
+			if err != nil {
+				apiFailed(status, err)
+				return
+			}
+
+			var ready []string
+			for _, slice := range list.Items {
+				for _, endpoint := range slice.Endpoints {
+					// a missing condition means ready
+					if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+						ready = append(ready, endpoint.Addresses...)
+					}
+				}
+			}
+			if len(ready) < e.Ready {
+				checkResult.Error = "service doesn't have enough ready endpoints"
+				checkResult.Debug = fmt.Sprintf("service %s/%s has %d ready endpoints, wanted %d", e.Namespace, e.Service, len(ready), e.Ready)
+				response <- checkResult
+				return
+			}
+			up = append(up, fmt.Sprintf("service %s/%s has endpoints %s", e.Namespace, e.Service, strings.Join(ready, ", ")))
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = strings.Join(up, "; ")
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+func (c *Kubernetes) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Kubernetes"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "kubernetes"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 6443
+	}
+	if c.Namespace == "" {
+		c.Namespace = "default"
+	}
+	if err := c.verify(); err != nil {
+		return fmt.Errorf("kubernetes check: %w", err)
+	}
+	if c.TokenFile == "" && c.ClientCert == "" {
+		return errors.New("kubernetes check needs a tokenfile or a clientcert to log in with")
+	}
+	if len(c.Deployment) == 0 && len(c.Endpoints) == 0 {
+		return errors.New("kubernetes check needs at least one deployment or endpoints")
+	}
+	for i := range c.Deployment {
+		d := &c.Deployment[i]
+		if d.Name == "" {
+			return errors.New("kubernetes deployment needs a name")
+		}
+		if d.Namespace == "" {
+			d.Namespace = c.Namespace
+		}
+		if d.Replicas < 0 {
+			return errors.New("kubernetes deployment replicas can't be negative")
+		}
+	}
+	for i := range c.Endpoints {
+		e := &c.Endpoints[i]
+		if e.Service == "" {
+			return errors.New("kubernetes endpoints need a service")
+		}
+		if e.Namespace == "" {
+			e.Namespace = c.Namespace
+		}
+		if e.Ready < 0 {
+			return errors.New("kubernetes endpoints ready can't be negative")
+		}
+		if e.Ready == 0 {
+			e.Ready = 1
+		}
+	}
+
+	return nil
+}
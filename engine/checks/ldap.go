@@ -1,8 +1,14 @@
 package checks
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"math/rand"
+	"net"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,6 +19,33 @@ type Ldap struct {
 	Service
 	Domain    string
 	Encrypted bool
+	StartTls  bool         `toml:",omitempty"` // upgrade a plain connection with StartTLS
+	BindDN    string       `toml:",omitempty"` // simple bind DN, e.g. "uid={{username}},ou=people,{{basedn}}", instead of user@domain
+	Search    []ldapSearch `toml:",omitempty"`
+}
+
+// ldapSearch is a search run after binding. BaseDN and Filter can use the same
+// variables as the bind DN.
+type ldapSearch struct {
+	BaseDN     string            `toml:",omitempty"` // defaults to the domain's DN
+	Filter     string            `toml:",omitempty"`
+	Scope      string            `toml:",omitempty"` // "base", "one" or "sub"
+	MinEntries int               `toml:",omitempty"` // at least this many entries have to match
+	Expect     map[string]string `toml:",omitempty"` // attribute values one entry has to have, "" for any value
+}
+
+var ldapScopes = map[string]int{
+	"base": ldap.ScopeBaseObject,
+	"one":  ldap.ScopeSingleLevel,
+	"sub":  ldap.ScopeWholeSubtree,
+}
+
+// domainDN turns corp.team1.local into dc=corp,dc=team1,dc=local
+func domainDN(domain string) string {
+	if domain == "" {
+		return ""
+	}
+	return "dc=" + strings.Join(strings.Split(domain, "."), ",dc=")
 }
 
 func (c Ldap) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
@@ -28,11 +61,26 @@ func (c Ldap) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan
 			return
 		}
 
+		domain := expandVars(c.Domain, map[string]string{"team": teamIdentifier})
+		vars := map[string]string{
+			"username": ldap.EscapeDN(username),
+			"team":     teamIdentifier,
+			"domain":   domain,
+			"basedn":   domainDN(domain),
+		}
+		filterVars := maps.Clone(vars)
+		filterVars["username"] = ldap.EscapeFilter(username)
+
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+			ServerName:         c.Target,
+		}
 		scheme := "ldap"
 		if c.Encrypted {
 			scheme = "ldaps"
 		}
-		lconn, err := ldap.DialURL(fmt.Sprintf("%s://%s:%d", scheme, c.Target, c.Port))
+		lconn, err := ldap.DialURL(fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(c.Target, fmt.Sprint(c.Port))),
+			ldap.DialWithTLSConfig(tlsConfig), ldap.DialWithDialer(&net.Dialer{Timeout: time.Duration(c.Timeout) * time.Second}))
 		if err != nil {
 			checkResult.Error = "failed to connect"
 			checkResult.Debug = "login " + username + " password " + password + " failed with error: " + err.Error()
@@ -40,23 +88,32 @@ func (c Ldap) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan
 			return
 		}
 		defer func() {
-		if err := lconn.Close(); err != nil {
-			slog.Error("failed to close ldap connection", "error", err)
-		}
-	}()
+			if err := lconn.Close(); err != nil {
+				slog.Error("failed to close ldap connection", "error", err)
+			}
+		}()
 
 		// Set message timeout
 		lconn.SetTimeout(time.Duration(c.Timeout) * time.Second)
 
+		if c.StartTls {
+			if err := lconn.StartTLS(tlsConfig); err != nil {
+				checkResult.Error = "starttls failed"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+		}
+
 		// Attempt to login
-		splitDomain := strings.Split(c.Domain, ".")
-		if len(splitDomain) != 2 {
+		authString := fmt.Sprintf("%s@%s", username, domain)
+		if c.BindDN != "" {
+			authString = expandVars(c.BindDN, vars)
+		} else if !strings.Contains(domain, ".") {
 			checkResult.Error = "Configured domain is not valid (needs to be domain and tld)"
 			response <- checkResult
 			return
 		}
-
-		authString := fmt.Sprintf("%s@%s", username, c.Domain)
 		err = lconn.Bind(authString, password)
 		if err != nil {
 			checkResult.Error = "login failed for " + username
@@ -65,14 +122,67 @@ func (c Ldap) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan
 			return
 		}
 
+		if len(c.Search) == 0 {
+			checkResult.Status = true
+			checkResult.Debug = "login successful for username " + username + " password " + password
+			response <- checkResult
+			return
+		}
+
+		search := c.Search[rand.Intn(len(c.Search))] // #nosec G404 -- non-crypto selection of search to run
+		baseDN := expandVars(search.BaseDN, vars)
+		filter := expandVars(search.Filter, filterVars)
+		attributes := []string{"1.1"} // no attributes, just the entries
+		if len(search.Expect) > 0 {
+			attributes = slices.Sorted(maps.Keys(search.Expect))
+		}
+
+		result, err := lconn.Search(ldap.NewSearchRequest(
+			baseDN, ldapScopes[search.Scope], ldap.NeverDerefAliases, 0, c.Timeout, false, filter, attributes, nil,
+		))
+		if err != nil {
+			checkResult.Error = "ldap search failed"
+			checkResult.Debug = "search of " + baseDN + " for " + filter + " as " + username + " failed with error: " + err.Error()
+			response <- checkResult
+			return
+		}
+
+		matched := 0
+		for _, entry := range result.Entries {
+			if ldapEntryMatches(entry, search.Expect) {
+				matched++
+			}
+		}
+		if matched < search.MinEntries {
+			checkResult.Error = "ldap search didn't find the expected entries"
+			checkResult.Debug = fmt.Sprintf("search of %s for %s found %d entries, %d matching, wanted at least %d", baseDN, filter, len(result.Entries), matched, search.MinEntries)
+			response <- checkResult
+			return
+		}
+
 		checkResult.Status = true
-		checkResult.Debug = "login successful for username " + username + " password " + password
+		checkResult.Debug = fmt.Sprintf("login successful for username %s password %s, search of %s for %s found %d matching entries", username, password, baseDN, filter, matched)
 		response <- checkResult
 	}
 
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
 }
 
+// ldapEntryMatches reports whether an entry has every expected attribute
+// value. Values are compared ignoring case, like most LDAP attributes are.
+func ldapEntryMatches(entry *ldap.Entry, expect map[string]string) bool {
+	for name, want := range expect {
+		values := entry.GetEqualFoldAttributeValues(name)
+		if len(values) == 0 {
+			return false
+		}
+		if want != "" && !slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, want) }) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Ldap) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
 	if c.ServiceType == "" {
 		c.ServiceType = "Ldap"
@@ -81,7 +191,11 @@ func (c *Ldap) Verify(box string, ip string, points int, timeout int, slapenalty
 		return err
 	}
 	if c.Port == 0 {
-		c.Port = 636
+		if c.StartTls {
+			c.Port = 389
+		} else {
+			c.Port = 636
+		}
 	}
 	if c.Display == "" {
 		c.Display = "ldap"
@@ -89,6 +203,57 @@ func (c *Ldap) Verify(box string, ip string, points int, timeout int, slapenalty
 	if c.Name == "" {
 		c.Name = box + "-" + c.Display
 	}
+	if c.Encrypted && c.StartTls {
+		return errors.New("ldap check can use ldaps (encrypted) or starttls, not both")
+	}
+	if c.BindDN == "" && c.Domain != "" && !strings.Contains(strings.Trim(c.Domain, "."), ".") {
+		return fmt.Errorf("ldap domain %q needs at least a name and a tld", c.Domain)
+	}
+	if err := verifyTemplate(c.Domain, "team"); err != nil {
+		return fmt.Errorf("ldap domain: %w", err)
+	}
+	if err := verifyTemplate(c.BindDN, "username", "team", "domain", "basedn"); err != nil {
+		return fmt.Errorf("ldap bind dn: %w", err)
+	}
+	for i := range c.Search {
+		s := &c.Search[i]
+		if s.BaseDN == "" {
+			if c.Domain == "" {
+				return errors.New("ldap search needs a base dn when the check has no domain")
+			}
+			s.BaseDN = "{{basedn}}"
+		}
+		if s.Filter == "" {
+			s.Filter = "(objectClass=*)"
+		}
+		if s.Scope == "" {
+			s.Scope = "sub"
+		}
+		if _, ok := ldapScopes[s.Scope]; !ok {
+			return fmt.Errorf("unknown ldap search scope %q, use base, one or sub", s.Scope)
+		}
+		if s.MinEntries == 0 {
+			s.MinEntries = 1
+		}
+		for _, field := range []string{s.BaseDN, s.Filter} {
+			if err := verifyTemplate(field, "username", "team", "domain", "basedn"); err != nil {
+				return fmt.Errorf("ldap search: %w", err)
+			}
+		}
+		if _, err := ldap.CompileFilter(expandVars(s.Filter, map[string]string{"username": "user", "team": "1", "domain": "example.com", "basedn": "dc=example,dc=com"})); err != nil {
+			return fmt.Errorf("invalid ldap search filter %q: %w", s.Filter, err)
+		}
+	}
+
+	return nil
+}
 
+// verifyTemplate checks a template only uses the given {{variables}}
+func verifyTemplate(s string, vars ...string) error {
+	for _, m := range stepVariable.FindAllStringSubmatch(s, -1) {
+		if !slices.Contains(vars, m[1]) {
+			return fmt.Errorf("unknown variable {{%s}}, can use %s", m[1], strings.Join(vars, ", "))
+		}
+	}
 	return nil
 }
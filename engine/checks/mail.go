@@ -0,0 +1,267 @@
+package checks
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/knadh/go-pop3"
+)
+
+// mailTagHeader carries the random tag the mail check looks for
+const mailTagHeader = "X-Quotient-Tag"
+
+// mailPollInterval is how often the mailbox is checked for the sent message
+const mailPollInterval = time.Second
+
+// Mail scores mail flow end to end: it sends a tagged message over SMTP to a
+// user from the credlists, waits for it to show up in their mailbox over IMAP
+// or POP3, and deletes it.
+type Mail struct {
+	Service
+	Domain           string `toml:",omitempty"` // appended to usernames to make addresses, e.g. "@team.local"
+	Encrypted        bool   `toml:",omitempty"` // SMTP over TLS
+	RequireAuth      bool   `toml:",omitempty"` // log in to SMTP even if the server doesn't advertise AUTH
+	Mailbox          string `toml:",omitempty"` // "imap" or "pop3"
+	MailboxPort      int    `toml:",omitempty"`
+	MailboxEncrypted bool   `toml:",omitempty"` // IMAP or POP3 over TLS
+}
+
+func (c Mail) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		// leave a second before the check times out to report a missing message
+		deadline := time.Now().Add(time.Duration(c.Timeout)*time.Second - time.Second)
+
+		username, password, err := c.getCreds(teamID)
+		if err != nil {
+			checkResult.Error = "error getting creds"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		toUser, toPassword, err := c.getCreds(teamID)
+		if err != nil {
+			checkResult.Error = "error getting creds"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		to := toUser + c.Domain
+
+		tag, body := generateRandomContent()
+		message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: scoring check %s\r\n%s: %s\r\n\r\n%s\r\n", username+c.Domain, to, tag, mailTagHeader, tag, body)
+
+		sender := Smtp{
+			Service:     Service{Target: c.Target, Port: c.Port, Timeout: c.Timeout, CredLists: c.CredLists},
+			Encrypted:   c.Encrypted,
+			Domain:      c.Domain,
+			RequireAuth: c.RequireAuth,
+		}
+		if err := sender.send(username, password, to, message); err != nil {
+			checkResult.Error = "sending mail failed: " + err.step
+			checkResult.Debug = err.err.Error()
+			response <- checkResult
+			return
+		}
+
+		login := toUser + c.Domain
+		var fetchErr *mailError
+		if c.Mailbox == "pop3" {
+			fetchErr = c.takePop3(login, toPassword, tag, deadline)
+		} else {
+			fetchErr = c.takeImap(login, toPassword, tag, deadline)
+		}
+		if fetchErr != nil {
+			checkResult.Error = fetchErr.step
+			checkResult.Debug = fetchErr.err.Error() + ", mail from " + username + c.Domain + " to " + to
+			response <- checkResult
+			return
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = "message " + tag + " from " + username + c.Domain + " arrived in " + to + "'s " + c.Mailbox + " mailbox"
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// takeImap waits for the tagged message to show up in the user's inbox and
+// deletes it.
+func (c Mail) takeImap(username, password, tag string, deadline time.Time) *mailError {
+	dialer := net.Dialer{
+		Timeout: time.Duration(c.Timeout) * time.Second,
+	}
+	addr := fmt.Sprintf("%s:%d", c.Target, c.MailboxPort)
+
+	var cl *client.Client
+	var err error
+	if c.MailboxEncrypted {
+		cl, err = client.DialWithDialerTLS(&dialer, addr, &tls.Config{InsecureSkipVerify: true}) // #nosec G402 -- competition services may use self-signed certs
+	} else {
+		cl, err = client.DialWithDialer(&dialer, addr)
+	}
+	if err != nil {
+		return &mailError{"connection to mailbox failed", err}
+	}
+	defer func() {
+		if err := cl.Logout(); err != nil {
+			slog.Debug("failed to log out of imap", "error", err)
+		}
+	}()
+	cl.Timeout = time.Duration(c.Timeout) * time.Second
+
+	if err := cl.Login(username, password); err != nil {
+		return &mailError{"mailbox login failed", fmt.Errorf("creds %s:%s, error: %w", username, password, err)}
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add(mailTagHeader, tag)
+	for {
+		// selecting again picks up messages delivered since the last search
+		if _, err := cl.Select(imap.InboxName, false); err != nil {
+			return &mailError{"selecting inbox failed", err}
+		}
+		ids, err := cl.Search(criteria)
+		if err != nil {
+			return &mailError{"searching inbox failed", err}
+		}
+		if len(ids) > 0 {
+			seqSet := new(imap.SeqSet)
+			seqSet.AddNum(ids...)
+			if err := cl.Store(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), []any{imap.DeletedFlag}, nil); err != nil {
+				return &mailError{"deleting message failed", err}
+			}
+			if err := cl.Expunge(nil); err != nil {
+				return &mailError{"deleting message failed", err}
+			}
+			return nil
+		}
+
+		if time.Now().Add(mailPollInterval).After(deadline) {
+			return &mailError{"message never arrived", fmt.Errorf("no message tagged %s in %s's inbox", tag, username)}
+		}
+		time.Sleep(mailPollInterval)
+	}
+}
+
+// takePop3 waits for the tagged message to show up in the user's maildrop and
+// deletes it. POP3 only shows messages that were there at login, so each
+// attempt is a new session.
+func (c Mail) takePop3(username, password, tag string, deadline time.Time) *mailError {
+	p := pop3.New(pop3.Opt{
+		Host:          c.Target,
+		Port:          c.MailboxPort,
+		DialTimeout:   time.Duration(c.Timeout) * time.Second,
+		TLSEnabled:    c.MailboxEncrypted,
+		TLSSkipVerify: true, // competition services may use self-signed certs
+	})
+
+	for {
+		found, err := takePop3Message(p, username, password, tag)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+
+		if time.Now().Add(mailPollInterval).After(deadline) {
+			return &mailError{"message never arrived", fmt.Errorf("no message tagged %s in %s's maildrop", tag, username)}
+		}
+		time.Sleep(mailPollInterval)
+	}
+}
+
+func takePop3Message(p *pop3.Client, username, password, tag string) (bool, *mailError) {
+	conn, err := p.NewConn()
+	if err != nil {
+		return false, &mailError{"connection to mailbox failed", err}
+	}
+	quit := true
+	defer func() {
+		if quit {
+			if err := conn.Quit(); err != nil {
+				slog.Debug("failed to quit pop3", "error", err)
+			}
+		}
+	}()
+
+	if err := conn.Auth(username, password); err != nil {
+		return false, &mailError{"mailbox login failed", fmt.Errorf("creds %s:%s, error: %w", username, password, err)}
+	}
+
+	messages, err := conn.List(0)
+	if err != nil {
+		return false, &mailError{"listing messages failed", err}
+	}
+	// newest first, that's where the message will be
+	for i := len(messages) - 1; i >= 0; i-- {
+		m, err := conn.Top(messages[i].ID, 0)
+		if err != nil {
+			return false, &mailError{"reading message failed", err}
+		}
+		if m.Header.Get(mailTagHeader) != tag {
+			continue
+		}
+		if err := conn.Dele(messages[i].ID); err != nil {
+			return false, &mailError{"deleting message failed", err}
+		}
+		// the deletion only happens once the session ends cleanly
+		quit = false
+		if err := conn.Quit(); err != nil {
+			return false, &mailError{"deleting message failed", err}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (c *Mail) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Mail"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "mail"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 25
+	}
+	if c.Mailbox == "" {
+		c.Mailbox = "imap"
+	}
+	if c.MailboxPort == 0 {
+		switch {
+		case c.Mailbox == "imap" && c.MailboxEncrypted:
+			c.MailboxPort = 993
+		case c.Mailbox == "imap":
+			c.MailboxPort = 143
+		case c.MailboxEncrypted:
+			c.MailboxPort = 995
+		default:
+			c.MailboxPort = 110
+		}
+	}
+	if c.Mailbox != "imap" && c.Mailbox != "pop3" {
+		return fmt.Errorf("unknown mailbox protocol %q, use imap or pop3", c.Mailbox)
+	}
+	if len(c.CredLists) == 0 {
+		return errors.New("mail check needs credlists to send and read mail as")
+	}
+	if c.Timeout < 3 {
+		return errors.New("mail check needs a timeout of at least 3 seconds to wait for delivery")
+	}
+
+	return nil
+}
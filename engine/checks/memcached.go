@@ -0,0 +1,198 @@
+package checks
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Memcached writes a random value to a key and reads it back over the text
+// protocol. With credlists it logs in first, the way memcached's -Y auth file
+// expects.
+type Memcached struct {
+	Service
+	Key string `toml:",omitempty"` // key the check writes, "quotient-check" by default
+}
+
+func (c Memcached) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		var username, password string
+		if len(c.CredLists) > 0 {
+			var err error
+			username, password, err = c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+		}
+
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.Target, strconv.Itoa(c.Port)), time.Duration(c.Timeout)*time.Second)
+		if err != nil {
+			checkResult.Error = "memcached connection failed"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				slog.Error("failed to close memcached connection", "error", err)
+			}
+		}()
+		if err := conn.SetDeadline(time.Now().Add(time.Duration(c.Timeout) * time.Second)); err != nil {
+			checkResult.Error = "memcached connection failed"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		mc := memcachedConn{conn: conn, r: bufio.NewReader(conn)}
+
+		login := ""
+		if len(c.CredLists) > 0 {
+			login = ", creds used were " + username + ":" + password
+			// the auth file login is a set of "username password" to any key
+			if err := mc.set("auth", username+" "+password); err != nil {
+				checkResult.Error = "memcached login failed"
+				checkResult.Debug = err.Error() + login
+				response <- checkResult
+				return
+			}
+		}
+
+		value := strconv.FormatInt(rand.Int63(), 36) // #nosec G404 -- value only has to differ between rounds
+		if err := mc.set(c.Key, value); err != nil {
+			checkResult.Error = "memcached set failed"
+			checkResult.Debug = "setting " + c.Key + ": " + err.Error() + login
+			response <- checkResult
+			return
+		}
+		got, err := mc.get(c.Key)
+		if err != nil {
+			checkResult.Error = "memcached get failed"
+			checkResult.Debug = "getting " + c.Key + ": " + err.Error() + login
+			response <- checkResult
+			return
+		}
+		if got != value {
+			checkResult.Error = "memcached returned the wrong value"
+			checkResult.Debug = "set " + c.Key + " to " + value + " but got back " + got
+			response <- checkResult
+			return
+		}
+		if err := mc.delete(c.Key); err != nil {
+			slog.Debug("failed to delete memcached check key", "key", c.Key, "error", err)
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = "set and got " + c.Key + login
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// memcachedConn speaks just enough of the memcached text protocol for the check
+type memcachedConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// reply reads one line from the server, turning error replies into errors
+func (m memcachedConn) reply() (string, error) {
+	line, err := m.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "ERROR" || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR") {
+		return "", errors.New("server replied " + line)
+	}
+	return line, nil
+}
+
+func (m memcachedConn) set(key, value string) error {
+	if _, err := fmt.Fprintf(m.conn, "set %s 0 60 %d\r\n%s\r\n", key, len(value), value); err != nil {
+		return err
+	}
+	line, err := m.reply()
+	if err != nil {
+		return err
+	}
+	if line != "STORED" {
+		return errors.New("server replied " + line)
+	}
+	return nil
+}
+
+func (m memcachedConn) get(key string) (string, error) {
+	if _, err := fmt.Fprintf(m.conn, "get %s\r\n", key); err != nil {
+		return "", err
+	}
+	line, err := m.reply()
+	if err != nil {
+		return "", err
+	}
+	if line == "END" {
+		return "", errors.New("key not found")
+	}
+	// VALUE <key> <flags> <bytes>
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "VALUE" {
+		return "", errors.New("unexpected reply " + line)
+	}
+	size, err := strconv.Atoi(fields[3])
+	if err != nil || size < 0 || size > 1<<20 {
+		return "", errors.New("unexpected reply " + line)
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(m.r, data); err != nil {
+		return "", err
+	}
+	if line, err := m.reply(); err != nil || line != "END" {
+		return "", fmt.Errorf("unexpected end of reply %q: %v", line, err)
+	}
+	return string(data[:size]), nil
+}
+
+func (m memcachedConn) delete(key string) error {
+	if _, err := fmt.Fprintf(m.conn, "delete %s\r\n", key); err != nil {
+		return err
+	}
+	_, err := m.reply()
+	return err
+}
+
+func (c *Memcached) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Memcached"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "memcached"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 11211
+	}
+	if c.Key == "" {
+		c.Key = "quotient-check"
+	}
+	// keys can't have spaces or control characters and are at most 250 bytes
+	if len(c.Key) > 250 || strings.ContainsFunc(c.Key, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return fmt.Errorf("invalid memcached key %q", c.Key)
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Mongo logs in to MongoDB and runs a find
+type Mongo struct {
+	Service
+	Encrypted  bool        `toml:",omitempty"`
+	AuthSource string      `toml:",omitempty"` // database the credlist users are in, "admin" by default
+	Find       []mongoFind `toml:",omitempty"`
+}
+
+// mongoFind is a find run after logging in
+type mongoFind struct {
+	Database     string
+	Collection   string
+	Filter       string            `toml:",omitempty"` // extended JSON, "{}" by default
+	MinDocuments int               `toml:",omitempty"` // at least this many documents have to match
+	Expect       map[string]string `toml:",omitempty"` // field values one document has to have, "" for any value, "a.b" for nested fields
+}
+
+func (c Mongo) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		timeout := time.Duration(c.Timeout) * time.Second
+		opts := options.Client().
+			SetHosts([]string{net.JoinHostPort(c.Target, strconv.Itoa(c.Port))}).
+			SetDirect(true).
+			SetConnectTimeout(timeout).
+			SetServerSelectionTimeout(timeout).
+			SetRetryReads(false).
+			SetRetryWrites(false)
+		if c.Encrypted {
+			opts.SetTLSConfig(&tls.Config{
+				InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+				ServerName:         c.Target,
+			})
+		}
+
+		login := "no creds"
+		if len(c.CredLists) > 0 {
+			username, password, err := c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+			opts.SetAuth(options.Credential{Username: username, Password: password, AuthSource: c.AuthSource})
+			login = "creds used were " + username + ":" + password
+		}
+
+		client, err := mongo.Connect(opts)
+		if err != nil {
+			checkResult.Error = "creating mongo client failed"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		defer func() {
+			if err := client.Disconnect(context.Background()); err != nil {
+				slog.Error("failed to disconnect mongo client", "error", err)
+			}
+		}()
+
+		// the driver logs in on the first command
+		if err := client.Ping(ctx, nil); err != nil {
+			checkResult.Error = "mongo connection or login failed"
+			checkResult.Debug = login + ", error: " + err.Error()
+			response <- checkResult
+			return
+		}
+
+		if len(c.Find) == 0 {
+			checkResult.Status = true
+			checkResult.Debug = "connected, " + login
+			response <- checkResult
+			return
+		}
+
+		find := c.Find[rand.Intn(len(c.Find))] // #nosec G404 -- non-crypto selection of find to run
+		var filter bson.D
+		if err := bson.UnmarshalExtJSON([]byte(find.Filter), false, &filter); err != nil {
+			checkResult.Error = "invalid mongo filter"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		namespace := find.Database + "." + find.Collection
+		cursor, err := client.Database(find.Database).Collection(find.Collection).Find(ctx, filter)
+		if err != nil {
+			checkResult.Error = "mongo find failed"
+			checkResult.Debug = "find in " + namespace + " for " + find.Filter + " failed with error: " + err.Error() + ", " + login
+			response <- checkResult
+			return
+		}
+		defer func() {
+			if err := cursor.Close(context.Background()); err != nil {
+				slog.Error("failed to close mongo cursor", "error", err)
+			}
+		}()
+
+		found, matched := 0, 0
+		for matched < find.MinDocuments && cursor.Next(ctx) {
+			found++
+			if mongoDocumentMatches(cursor.Current, find.Expect) {
+				matched++
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			checkResult.Error = "mongo find failed"
+			checkResult.Debug = "reading results of find in " + namespace + " failed with error: " + err.Error()
+			response <- checkResult
+			return
+		}
+		if matched < find.MinDocuments {
+			checkResult.Error = "mongo find didn't return the expected documents"
+			checkResult.Debug = fmt.Sprintf("find in %s for %s returned %d documents, %d matching, wanted at least %d", namespace, find.Filter, found, matched, find.MinDocuments)
+			response <- checkResult
+			return
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = fmt.Sprintf("find in %s for %s returned %d matching documents, %s", namespace, find.Filter, matched, login)
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// mongoDocumentMatches reports whether a document has every expected field value
+func mongoDocumentMatches(doc bson.Raw, expect map[string]string) bool {
+	for field, want := range expect {
+		value, err := doc.LookupErr(strings.Split(field, ".")...)
+		if err != nil {
+			return false
+		}
+		if want != "" && mongoValue(value) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// mongoValue formats scalar values plainly and everything else as extended JSON
+func mongoValue(v bson.RawValue) string {
+	switch v.Type {
+	case bson.TypeString:
+		return v.StringValue()
+	case bson.TypeInt32:
+		return strconv.Itoa(int(v.Int32()))
+	case bson.TypeInt64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case bson.TypeDouble:
+		return strconv.FormatFloat(v.Double(), 'f', -1, 64)
+	case bson.TypeBoolean:
+		return strconv.FormatBool(v.Boolean())
+	case bson.TypeObjectID:
+		return v.ObjectID().Hex()
+	}
+	return v.String()
+}
+
+func (c *Mongo) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Mongo"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "mongo"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 27017
+	}
+	if c.AuthSource != "" && len(c.CredLists) == 0 {
+		return errors.New("mongo auth source needs credlists to log in with")
+	}
+	if c.AuthSource == "" {
+		c.AuthSource = "admin"
+	}
+	for i := range c.Find {
+		f := &c.Find[i]
+		if f.Database == "" || f.Collection == "" {
+			return errors.New("mongo find needs a database and a collection")
+		}
+		if f.Filter == "" {
+			f.Filter = "{}"
+		}
+		var filter bson.D
+		if err := bson.UnmarshalExtJSON([]byte(f.Filter), false, &filter); err != nil {
+			return fmt.Errorf("invalid mongo filter %q: %w", f.Filter, err)
+		}
+		if f.MinDocuments < 0 {
+			return errors.New("mongo find min documents can't be negative")
+		}
+		if f.MinDocuments == 0 {
+			f.MinDocuments = 1
+		}
+		for _, field := range slices.Sorted(maps.Keys(f.Expect)) {
+			if field == "" || slices.Contains(strings.Split(field, "."), "") {
+				return fmt.Errorf("invalid mongo expect field %q", field)
+			}
+		}
+	}
+
+	return nil
+}
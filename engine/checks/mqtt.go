@@ -0,0 +1,154 @@
+package checks
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Mqtt subscribes to a topic, publishes a random message to it and waits for
+// the broker to deliver it back
+type Mqtt struct {
+	Service
+	Encrypted bool   `toml:",omitempty"`
+	Topic     string `toml:",omitempty"` // topic the check publishes to, "quotient/check" by default
+}
+
+func (c Mqtt) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		// stop waiting a second early so a lost message is reported as such
+		deadline := time.Now().Add(time.Duration(c.Timeout)*time.Second - time.Second)
+
+		scheme := "tcp"
+		if c.Encrypted {
+			scheme = "ssl"
+		}
+		clientID := "quotient-" + strconv.FormatInt(rand.Int63(), 36) // #nosec G404 -- client id only has to be unique
+		opts := mqtt.NewClientOptions().
+			AddBroker(scheme + "://" + net.JoinHostPort(c.Target, strconv.Itoa(c.Port))).
+			SetClientID(clientID).
+			SetCleanSession(true).
+			SetAutoReconnect(false).
+			SetConnectTimeout(time.Duration(c.Timeout) * time.Second).
+			SetTLSConfig(&tls.Config{
+				InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+				ServerName:         c.Target,
+			})
+
+		login := "no creds"
+		if len(c.CredLists) > 0 {
+			username, password, err := c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+			opts.SetUsername(username).SetPassword(password)
+			login = "creds used were " + username + ":" + password
+		}
+
+		client := mqtt.NewClient(opts)
+		if err := mqttWait(client.Connect(), deadline); err != nil {
+			checkResult.Error = "mqtt connection or login failed"
+			checkResult.Debug = login + ", error: " + err.Error()
+			response <- checkResult
+			return
+		}
+		defer client.Disconnect(250)
+
+		received := make(chan string, 16)
+		handler := func(_ mqtt.Client, m mqtt.Message) {
+			select {
+			case received <- string(m.Payload()):
+			default:
+			}
+		}
+		if err := mqttWait(client.Subscribe(c.Topic, 1, handler), deadline); err != nil {
+			checkResult.Error = "mqtt subscribe failed"
+			checkResult.Debug = "subscribing to " + c.Topic + ": " + err.Error() + ", " + login
+			response <- checkResult
+			return
+		}
+
+		payload := clientID + "-" + strconv.FormatUint(uint64(roundID), 10)
+		if err := mqttWait(client.Publish(c.Topic, 1, false, payload), deadline); err != nil {
+			checkResult.Error = "mqtt publish failed"
+			checkResult.Debug = "publishing to " + c.Topic + ": " + err.Error() + ", " + login
+			response <- checkResult
+			return
+		}
+
+		// other clients can publish to the topic too, so wait for our message
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		var others []string
+		for {
+			select {
+			case got := <-received:
+				if got == payload {
+					checkResult.Status = true
+					checkResult.Debug = "published and received " + payload + " on " + c.Topic + ", " + login
+					response <- checkResult
+					return
+				}
+				others = append(others, got)
+			case <-timer.C:
+				checkResult.Error = "mqtt message wasn't delivered"
+				checkResult.Debug = "published " + payload + " to " + c.Topic + " but didn't get it back"
+				if len(others) > 0 {
+					checkResult.Debug += fmt.Sprintf(", got %d other messages", len(others))
+				}
+				response <- checkResult
+				return
+			}
+		}
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// mqttWait waits for a paho token until the check's deadline
+func mqttWait(token mqtt.Token, deadline time.Time) error {
+	if !token.WaitTimeout(time.Until(deadline)) {
+		return errors.New("timed out waiting for the broker")
+	}
+	return token.Error()
+}
+
+func (c *Mqtt) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Mqtt"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "mqtt"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		if c.Encrypted {
+			c.Port = 8883
+		} else {
+			c.Port = 1883
+		}
+	}
+	if c.Topic == "" {
+		c.Topic = "quotient/check"
+	}
+	if strings.ContainsAny(c.Topic, "+#") {
+		return fmt.Errorf("mqtt topic %q can't have wildcards", c.Topic)
+	}
+
+	return nil
+}
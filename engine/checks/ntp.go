@@ -0,0 +1,123 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/beevik/ntp"
+)
+
+// Ntp checks a time server answers and its clock is close to ours. With
+// credlists the query is signed with a symmetric key, the username is the key
+// id and the password is the key. Like in ntp.keys, keys longer than 20
+// characters are hex.
+type Ntp struct {
+	Service
+	Tolerance int    `toml:",omitempty"` // how far off the server's clock can be, in milliseconds, 1000 by default
+	KeyType   string `toml:",omitempty"` // symmetric key type for credlists, "md5", "sha1" (the default), "sha256", "sha512", "aes128" or "aes256"
+}
+
+var ntpKeyTypes = map[string]ntp.AuthType{
+	"md5":    ntp.AuthMD5,
+	"sha1":   ntp.AuthSHA1,
+	"sha256": ntp.AuthSHA256,
+	"sha512": ntp.AuthSHA512,
+	"aes128": ntp.AuthAES128,
+	"aes256": ntp.AuthAES256,
+}
+
+func (c Ntp) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		options := ntp.QueryOptions{Timeout: time.Duration(c.Timeout) * time.Second}
+		login := ""
+		if len(c.CredLists) > 0 {
+			username, password, err := c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+			keyID, err := strconv.ParseUint(username, 10, 16)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = "credlist username " + username + " isn't an ntp key id"
+				response <- checkResult
+				return
+			}
+			options.Auth = ntp.AuthOptions{Type: ntpKeyTypes[c.KeyType], Key: password, KeyID: uint16(keyID)}
+			login = ", key " + username + " " + password
+		}
+
+		resp, err := ntp.QueryWithOptions(net.JoinHostPort(c.Target, strconv.Itoa(c.Port)), options)
+		if err != nil {
+			checkResult.Error = "ntp query failed"
+			checkResult.Debug = err.Error() + login
+			response <- checkResult
+			return
+		}
+		if err := resp.Validate(); err != nil {
+			if errors.Is(err, ntp.ErrAuthFailed) {
+				checkResult.Error = "ntp authentication failed"
+			} else {
+				checkResult.Error = "ntp server isn't synchronized"
+			}
+			checkResult.Debug = fmt.Sprintf("stratum %d, reference %s: %s%s", resp.Stratum, resp.ReferenceString(), err, login)
+			response <- checkResult
+			return
+		}
+
+		offset := resp.ClockOffset.Abs()
+		tolerance := time.Duration(c.Tolerance) * time.Millisecond
+		if offset > tolerance {
+			checkResult.Error = "ntp server time is off"
+			checkResult.Debug = fmt.Sprintf("clock offset is %s, more than %s", resp.ClockOffset, tolerance)
+			response <- checkResult
+			return
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = fmt.Sprintf("clock offset is %s, stratum %d, reference %s%s", resp.ClockOffset, resp.Stratum, resp.ReferenceString(), login)
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+func (c *Ntp) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Ntp"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "ntp"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 123
+	}
+	if c.Tolerance < 0 {
+		return errors.New("ntp tolerance can't be negative")
+	}
+	if c.Tolerance == 0 {
+		c.Tolerance = 1000
+	}
+	if c.KeyType != "" && len(c.CredLists) == 0 {
+		return errors.New("ntp key type needs credlists with the key id and key")
+	}
+	if c.KeyType == "" {
+		c.KeyType = "sha1"
+	}
+	if _, ok := ntpKeyTypes[c.KeyType]; !ok {
+		return fmt.Errorf("unknown ntp key type %q", c.KeyType)
+	}
+
+	return nil
+}
@@ -1,32 +1,403 @@
 package checks
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"strconv"
+	"strings"
 	"time"
-	// why are there no good rdp libraries?
+
+	"github.com/bodgit/ntlmssp"
 )
 
+// Rdp negotiates a connection the way an RDP client does. Without credlists
+// the check passes once the server speaks RDP; with credlists it logs in
+// through Network Level Authentication (CredSSP with NTLM).
 type Rdp struct {
 	Service
+	Domain string `toml:",omitempty"` // NTLM domain, unless the username is DOMAIN\user or user@domain
+}
+
+// RDP negotiation protocols, see MS-RDPBCGR 2.2.1.1.1.
+const (
+	rdpProtocolRDP      = 0x0
+	rdpProtocolSSL      = 0x1
+	rdpProtocolHybrid   = 0x2
+	rdpProtocolHybridEx = 0x8
+)
+
+const (
+	rdpNegRsp     = 0x02
+	rdpNegFailure = 0x03
+
+	// newest CredSSP version we speak, the one that sends a client nonce
+	credsspVersion = 6
+)
+
+var rdpNegFailures = map[uint32]string{
+	1: "server requires tls",
+	2: "server requires standard rdp security",
+	3: "server has no tls certificate",
+	4: "server rejected the negotiation flags",
+	5: "server requires nla",
+	6: "server requires tls with client certificates",
+}
+
+var errNotRdp = errors.New("not an rdp server")
+
+// tsRequest is the CredSSP message exchanged over TLS, see MS-CSSP 2.2.1.
+type tsRequest struct {
+	Version     int         `asn1:"explicit,tag:0"`
+	NegoTokens  []negoToken `asn1:"optional,explicit,tag:1"`
+	AuthInfo    []byte      `asn1:"optional,explicit,tag:2"`
+	PubKeyAuth  []byte      `asn1:"optional,explicit,tag:3"`
+	ErrorCode   int         `asn1:"optional,explicit,tag:4"`
+	ClientNonce []byte      `asn1:"optional,explicit,tag:5"`
+}
+
+type negoToken struct {
+	Token []byte `asn1:"explicit,tag:0"`
 }
 
 func (c Rdp) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
 	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
-		_, err := net.DialTimeout("tcp", c.Target+":"+strconv.Itoa(c.Port), time.Duration(c.Timeout)*time.Second)
+		var username, password string
+		if len(c.CredLists) > 0 {
+			var err error
+			username, password, err = c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+		}
+
+		conn, err := net.DialTimeout("tcp", c.Target+":"+strconv.Itoa(c.Port), time.Duration(c.Timeout)*time.Second)
 		if err != nil {
 			checkResult.Error = "connection error"
 			checkResult.Debug = err.Error()
 			response <- checkResult
 			return
 		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				slog.Debug("failed to close rdp connection", "error", err)
+			}
+		}()
+		if err := conn.SetDeadline(time.Now().Add(time.Duration(c.Timeout) * time.Second)); err != nil {
+			checkResult.Error = "connection error"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+
+		requested := uint32(rdpProtocolSSL | rdpProtocolHybrid)
+		selected, err := rdpNegotiate(conn, username, requested)
+		if err != nil {
+			if errors.Is(err, errNotRdp) {
+				checkResult.Error = "port open but no rdp"
+			} else {
+				checkResult.Error = "rdp negotiation failed"
+			}
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+
+		if selected == rdpProtocolRDP {
+			if len(c.CredLists) > 0 {
+				checkResult.Error = "server doesn't support nla"
+				checkResult.Debug = "server selected standard rdp security, credentials can't be checked without nla"
+				response <- checkResult
+				return
+			}
+			checkResult.Status = true
+			checkResult.Debug = "server selected standard rdp security"
+			response <- checkResult
+			return
+		}
+
+		tlsConn := tls.Client(conn, &tls.Config{
+			InsecureSkipVerify: true, // #nosec G402 -- rdp servers almost always use self-signed certs
+			MinVersion:         tls.VersionTLS10,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			checkResult.Error = "rdp tls handshake failed"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+
+		if len(c.CredLists) == 0 {
+			checkResult.Status = true
+			checkResult.Debug = fmt.Sprintf("server negotiated rdp (protocol %#x)", selected)
+			response <- checkResult
+			return
+		}
+
+		if selected&(rdpProtocolHybrid|rdpProtocolHybridEx) == 0 {
+			checkResult.Error = "server doesn't support nla"
+			checkResult.Debug = fmt.Sprintf("server selected protocol %#x, credentials can't be checked without nla", selected)
+			response <- checkResult
+			return
+		}
+
+		domain := c.Domain
+		if d, u, ok := strings.Cut(username, `\`); ok {
+			domain, username = d, u
+		} else if u, d, ok := strings.Cut(username, "@"); ok {
+			domain, username = d, u
+		}
+
+		if err := credsspLogin(tlsConn, domain, username, password); err != nil {
+			var authErr *credsspAuthError
+			if errors.As(err, &authErr) {
+				checkResult.Error = "rdp login failed"
+			} else {
+				checkResult.Error = "nla authentication error"
+			}
+			checkResult.Debug = err.Error() + " for user " + username
+			response <- checkResult
+			return
+		}
+
 		checkResult.Status = true
+		checkResult.Debug = "nla login succeeded for user " + username
 		response <- checkResult
 	}
 
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
 }
 
+// rdpNegotiate sends an X.224 Connection Request and returns the protocol the
+// server selected from the Connection Confirm.
+func rdpNegotiate(conn net.Conn, username string, requested uint32) (uint32, error) {
+	var x224 bytes.Buffer
+	x224.Write([]byte{0xe0, 0, 0, 0, 0, 0}) // CR TPDU, no references, class 0
+	if username != "" {
+		fmt.Fprintf(&x224, "Cookie: mstshash=%s\r\n", username)
+	}
+	neg := make([]byte, 8)
+	neg[0] = 0x01 // TYPE_RDP_NEG_REQ
+	binary.LittleEndian.PutUint16(neg[2:], 8)
+	binary.LittleEndian.PutUint32(neg[4:], requested)
+	x224.Write(neg)
+
+	packet := make([]byte, 5, 5+x224.Len())
+	packet[0] = 0x03 // TPKT version
+	binary.BigEndian.PutUint16(packet[2:], uint16(5+x224.Len()))
+	packet[4] = byte(x224.Len())
+	packet = append(packet, x224.Bytes()...)
+	if _, err := conn.Write(packet); err != nil {
+		return 0, fmt.Errorf("error sending connection request: %w", err)
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, fmt.Errorf("%w: error reading connection confirm: %v", errNotRdp, err)
+	}
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if header[0] != 0x03 || length < 11 {
+		return 0, fmt.Errorf("%w: reply isn't a tpkt packet (% x)", errNotRdp, header)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, fmt.Errorf("%w: error reading connection confirm: %v", errNotRdp, err)
+	}
+	if body[1]&0xf0 != 0xd0 || int(body[0]) >= len(body) {
+		return 0, fmt.Errorf("%w: reply isn't an x.224 connection confirm", errNotRdp)
+	}
+
+	// the negotiation response follows the fixed part of the confirm
+	negData := body[7:]
+	if len(negData) < 8 {
+		return rdpProtocolRDP, nil
+	}
+	code := binary.LittleEndian.Uint32(negData[4:8])
+	switch negData[0] {
+	case rdpNegRsp:
+		return code, nil
+	case rdpNegFailure:
+		if reason, ok := rdpNegFailures[code]; ok {
+			return 0, errors.New(reason)
+		}
+		return 0, fmt.Errorf("server refused negotiation with code %d", code)
+	default:
+		return 0, fmt.Errorf("unknown negotiation response type %d", negData[0])
+	}
+}
+
+// credsspAuthError means the server rejected the credentials, as opposed to
+// the exchange breaking down.
+type credsspAuthError struct {
+	msg string
+}
+
+func (e *credsspAuthError) Error() string { return e.msg }
+
+// credsspLogin runs the CredSSP exchange up to the server proving its public
+// key, which it only does once the NTLM authentication has succeeded. The
+// user's credentials are never delegated to the server.
+func credsspLogin(conn *tls.Conn, domain, username, password string) error {
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server sent no tls certificate")
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(state.PeerCertificates[0].RawSubjectPublicKeyInfo, &spki); err != nil {
+		return fmt.Errorf("error parsing server public key: %w", err)
+	}
+	pubKey := spki.PublicKey.Bytes
+
+	client, err := ntlmssp.NewClient(ntlmssp.SetUserInfo(username, password), ntlmssp.SetDomain(domain))
+	if err != nil {
+		return err
+	}
+	negotiate, err := client.Authenticate(nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := writeTSRequest(conn, tsRequest{Version: credsspVersion, NegoTokens: []negoToken{{negotiate}}}); err != nil {
+		return err
+	}
+
+	challenge, err := readTSRequest(conn)
+	if err != nil {
+		return fmt.Errorf("error reading ntlm challenge: %w", err)
+	}
+	if challenge.ErrorCode != 0 {
+		return fmt.Errorf("server returned error %#08x", uint32(challenge.ErrorCode))
+	}
+	if len(challenge.NegoTokens) == 0 {
+		return errors.New("server sent no ntlm challenge")
+	}
+	authenticate, err := client.Authenticate(challenge.NegoTokens[0].Token, nil)
+	if err != nil {
+		return fmt.Errorf("error processing ntlm challenge: %w", err)
+	}
+	session := client.SecuritySession()
+	if session == nil {
+		return errors.New("ntlm negotiated no session security")
+	}
+
+	// servers older than version 5 expect the public key itself, newer ones
+	// a hash of it bound to a nonce
+	version := min(challenge.Version, credsspVersion)
+	auth := tsRequest{Version: version, NegoTokens: []negoToken{{authenticate}}}
+	proof := pubKey
+	if version >= 5 {
+		auth.ClientNonce = make([]byte, 32)
+		if _, err := rand.Read(auth.ClientNonce); err != nil {
+			return err
+		}
+		proof = credsspHash("CredSSP Client-To-Server Binding Hash\x00", auth.ClientNonce, pubKey)
+	}
+	sealed, signature, err := session.Wrap(proof)
+	if err != nil {
+		return err
+	}
+	auth.PubKeyAuth = append(signature, sealed...)
+	if err := writeTSRequest(conn, auth); err != nil {
+		return err
+	}
+
+	reply, err := readTSRequest(conn)
+	if err != nil {
+		// servers before version 3 just hang up on bad credentials
+		return &credsspAuthError{"server closed the connection after authentication: " + err.Error()}
+	}
+	if reply.ErrorCode != 0 {
+		return &credsspAuthError{fmt.Sprintf("server returned error %#08x", uint32(reply.ErrorCode))}
+	}
+	if len(reply.PubKeyAuth) <= 16 {
+		return &credsspAuthError{"server didn't prove its public key"}
+	}
+	got, err := session.Unwrap(reply.PubKeyAuth[16:], reply.PubKeyAuth[:16])
+	if err != nil {
+		return fmt.Errorf("error checking server public key proof: %w", err)
+	}
+	var want []byte
+	if version >= 5 {
+		want = credsspHash("CredSSP Server-To-Client Binding Hash\x00", auth.ClientNonce, pubKey)
+	} else {
+		want = append([]byte{pubKey[0] + 1}, pubKey[1:]...)
+	}
+	if !bytes.Equal(got, want) {
+		return errors.New("server public key proof didn't match its tls certificate")
+	}
+	return nil
+}
+
+func credsspHash(magic string, nonce, pubKey []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(magic))
+	h.Write(nonce)
+	h.Write(pubKey)
+	return h.Sum(nil)
+}
+
+func writeTSRequest(w io.Writer, req tsRequest) error {
+	b, err := asn1.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("error sending credssp request: %w", err)
+	}
+	return nil
+}
+
+// readTSRequest reads one DER encoded TSRequest off the connection.
+func readTSRequest(r io.Reader) (tsRequest, error) {
+	var req tsRequest
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return req, err
+	}
+	if header[0] != 0x30 {
+		return req, fmt.Errorf("credssp reply isn't a sequence (tag %#x)", header[0])
+	}
+	raw := header
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 {
+			return req, fmt.Errorf("bad credssp length encoding %#x", header[1])
+		}
+		lenBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return req, err
+		}
+		raw = append(raw, lenBytes...)
+		length = 0
+		for _, b := range lenBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return req, err
+	}
+	if _, err := asn1.Unmarshal(append(raw, body...), &req); err != nil {
+		return req, fmt.Errorf("error parsing credssp reply: %w", err)
+	}
+	return req, nil
+}
+
 func (c *Rdp) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
 	if c.ServiceType == "" {
 		c.ServiceType = "Rdp"
@@ -43,6 +414,9 @@ func (c *Rdp) Verify(box string, ip string, points int, timeout int, slapenalty
 	if c.Port == 0 {
 		c.Port = 3389
 	}
+	if c.Domain != "" && len(c.CredLists) == 0 {
+		return errors.New("rdp domain needs credlists to log in with")
+	}
 
 	return nil
 }
@@ -0,0 +1,128 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis logs in, writes a random value to a key and reads it back
+type Redis struct {
+	Service
+	Encrypted bool   `toml:",omitempty"`
+	Database  int    `toml:",omitempty"`
+	Key       string `toml:",omitempty"` // key the check writes, "quotient:check" by default
+}
+
+func (c Redis) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		var username, password string
+		if len(c.CredLists) > 0 {
+			var err error
+			username, password, err = c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+		}
+
+		options := &redis.Options{
+			Addr:             net.JoinHostPort(c.Target, strconv.Itoa(c.Port)),
+			Username:         username,
+			Password:         password,
+			DB:               c.Database,
+			Protocol:         2, // older servers don't know HELLO
+			DisableIndentity: true,
+			MaxRetries:       -1,
+			DialTimeout:      time.Duration(c.Timeout) * time.Second,
+		}
+		if c.Encrypted {
+			options.TLSConfig = &tls.Config{
+				InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+				ServerName:         c.Target,
+			}
+		}
+		client := redis.NewClient(options)
+		defer func() {
+			if err := client.Close(); err != nil {
+				slog.Error("failed to close redis client", "error", err)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Timeout)*time.Second)
+		defer cancel()
+
+		login := "creds used were " + username + ":" + password
+		if err := client.Ping(ctx).Err(); err != nil {
+			checkResult.Error = "redis connection or login failed"
+			checkResult.Debug = login + ", error: " + err.Error()
+			response <- checkResult
+			return
+		}
+
+		value := strconv.FormatInt(rand.Int63(), 36) // #nosec G404 -- value only has to differ between rounds
+		if err := client.Set(ctx, c.Key, value, time.Minute).Err(); err != nil {
+			checkResult.Error = "redis set failed"
+			checkResult.Debug = "setting " + c.Key + " failed with error: " + err.Error() + ", " + login
+			response <- checkResult
+			return
+		}
+		got, err := client.Get(ctx, c.Key).Result()
+		if err != nil {
+			checkResult.Error = "redis get failed"
+			checkResult.Debug = "getting " + c.Key + " failed with error: " + err.Error() + ", " + login
+			response <- checkResult
+			return
+		}
+		if got != value {
+			checkResult.Error = "redis returned the wrong value"
+			checkResult.Debug = "set " + c.Key + " to " + value + " but got back " + got
+			response <- checkResult
+			return
+		}
+		if err := client.Del(ctx, c.Key).Err(); err != nil {
+			slog.Debug("failed to delete redis check key", "key", c.Key, "error", err)
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = "set and got " + c.Key + ", " + login
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+func (c *Redis) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Redis"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "redis"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 6379
+	}
+	if c.Database < 0 {
+		return errors.New("redis database can't be negative")
+	}
+	if c.Key == "" {
+		c.Key = "quotient:check"
+	}
+
+	return nil
+}
@@ -1,16 +1,68 @@
 package checks
 
 import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"log/slog"
+	"math/big"
+	"math/bits"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf16"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/gosnmp/gosnmp"
+	krbcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/miekg/dns"
+	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xdg-go/scram"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/crypto/ssh"
 )
 
 // TestWebRun_ActualExecution tests Web check Run() with real HTTP server
@@ -150,6 +202,3237 @@ func TestWebRun_ActualExecution(t *testing.T) {
 	}
 }
 
+// TestWebRun_Ownership tests that koth ownership checks report the token they read
+func TestWebRun_Ownership(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		regex         string
+		ownership     bool
+		expectedOwner string
+	}{
+		{
+			name:          "whole page is the token",
+			body:          "  blue-team-token\n",
+			ownership:     true,
+			expectedOwner: "blue-team-token",
+		},
+		{
+			name:          "regex capture group is the token",
+			body:          "<html>owner: red-token</html>",
+			regex:         `owner: ([a-z-]+)`,
+			ownership:     true,
+			expectedOwner: "red-token",
+		},
+		{
+			name:          "regex without group uses the page",
+			body:          "plain-token",
+			regex:         `token`,
+			ownership:     true,
+			expectedOwner: "plain-token",
+		},
+		{
+			name:          "non-ownership check reports no owner",
+			body:          "blue-team-token",
+			expectedOwner: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			webCheck := &Web{
+				Service: Service{
+					Target:    "127.0.0.1",
+					Timeout:   5,
+					Ownership: tt.ownership,
+				},
+				Scheme: "http",
+				Url:    []urlData{{Path: "/", Regex: tt.regex}},
+			}
+			_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+			fmt.Sscanf(portStr, "%d", &webCheck.Port)
+
+			resultsChan := make(chan Result, 1)
+			webCheck.Run(0, "", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.True(t, result.Status, "check should pass: %s", result.Error)
+				assert.Equal(t, tt.expectedOwner, result.Owner)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// TestWebRun_Steps tests scripted web checks against a small app with a login form
+func TestWebRun_Steps(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<form><input type="hidden" name="csrf" value="tok123"></form>`))
+	})
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("csrf") != "tok123" || r.FormValue("password") != "hunter2" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: r.FormValue("user")})
+		http.Redirect(w, r, "/home", http.StatusFound)
+	})
+	mux.HandleFunc("GET /api/me", func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"user": {"name": %q, "roles": ["user"]}}`, session.Value)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	login := []webStep{
+		{Name: "login page", Path: "/login", Extract: []webExtract{{Var: "csrf", webSelector: webSelector{CSS: "input[name=csrf]", Attr: "value"}}}},
+		{Name: "log in", Method: "POST", Path: "/login", NoRedirect: true, Status: 302, Form: map[string]string{"user": "{{team}}-admin", "password": "hunter2", "csrf": "{{csrf}}"},
+			Assert: []webAssert{{webSelector: webSelector{Header: "Location"}, Equals: "/home"}}},
+	}
+
+	tests := []struct {
+		name          string
+		steps         []webStep
+		expectedError string
+	}{
+		{
+			name: "login flow keeps the session",
+			steps: append(login, webStep{Name: "profile", Path: "/api/me", Status: 200, Assert: []webAssert{
+				{webSelector: webSelector{JSONPath: "$.user.name"}, Equals: "{{team}}-admin"},
+				{webSelector: webSelector{JSONPath: "$.user.roles[0]"}, Contains: "user"},
+				{webSelector: webSelector{JSONPath: "$.user.email"}, Absent: true},
+			}}),
+		},
+		{
+			name:          "failing assertion names the step",
+			steps:         append(login, webStep{Name: "profile", Path: "/api/me", Assert: []webAssert{{webSelector: webSelector{JSONPath: "$.user.name"}, Equals: "someone-else"}}}),
+			expectedError: "step 3 (profile): assertion failed",
+		},
+		{
+			name:          "missing session",
+			steps:         []webStep{{Path: "/api/me", Status: 200}},
+			expectedError: "step 1: status returned by webserver was incorrect",
+		},
+		{
+			name:          "extract that doesn't match",
+			steps:         []webStep{{Path: "/login", Extract: []webExtract{{Var: "token", webSelector: webSelector{Regex: `token=(\w+)`}}}}},
+			expectedError: "step 1: couldn't extract token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webCheck := &Web{
+				Service: Service{Target: "127.0.0.1", Timeout: 5},
+				Step:    tt.steps,
+			}
+			require.NoError(t, webCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+			fmt.Sscanf(portStr, "%d", &webCheck.Port)
+
+			resultsChan := make(chan Result, 1)
+			webCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				if tt.expectedError == "" {
+					assert.True(t, result.Status, "check should pass: %s\n%s", result.Error, result.Debug)
+					assert.Len(t, strings.Split(result.Debug, "\n"), len(tt.steps), "debug should have a line per step")
+				} else {
+					assert.False(t, result.Status)
+					assert.Contains(t, result.Error, tt.expectedError)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// TestWebRun_CompareFile tests web checks that compare the page against a scored file
+func TestWebRun_CompareFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("config/scoredfiles", 0o755))
+	require.NoError(t, os.WriteFile("config/scoredfiles/index.html", []byte("<h1>Welcome</h1>\n<p>Our store</p>\n<p>Open 9-5</p>\n<footer>Team</footer>\n"), 0o644))
+
+	tests := []struct {
+		name          string
+		body          string
+		diff          int
+		expectedError string
+		expectedDebug string
+	}{
+		{
+			name:          "identical page",
+			body:          "<h1>Welcome</h1>\n<p>Our store</p>\n<p>Open 9-5</p>\n<footer>Team</footer>\n",
+			expectedDebug: "0% different",
+		},
+		{
+			name:          "small change within threshold",
+			body:          "<h1>Welcome</h1>\n<p>Our store</p>\n<p>Open 9-6</p>\n<footer>Team</footer>\n",
+			diff:          30,
+			expectedDebug: "20% different",
+		},
+		{
+			name:          "defaced page",
+			body:          "<h1>hacked by red team</h1>\n",
+			diff:          30,
+			expectedError: "page didn't match the compare file",
+			expectedDebug: "+<h1>hacked by red team</h1>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			webCheck := &Web{
+				Service: Service{Target: "127.0.0.1", Timeout: 5},
+				Scheme:  "http",
+				Url:     []urlData{{Path: "/", CompareFile: "index.html", Diff: tt.diff}},
+			}
+			_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+			fmt.Sscanf(portStr, "%d", &webCheck.Port)
+
+			resultsChan := make(chan Result, 1)
+			webCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedError == "", result.Status, result.Error)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// TestRdpRun_ActualExecution tests RDP check Run() against a fake RDP server
+func TestRdpRun_ActualExecution(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("CORP\\alice,wrong\n"), 0o644))
+
+	// borrow a self-signed certificate from httptest
+	certServer := httptest.NewTLSServer(nil)
+	tlsConfig := certServer.TLS
+	certServer.Close()
+
+	confirm := func(negType byte, code uint32) []byte {
+		packet := []byte{0x03, 0, 0, 19, 14, 0xd0, 0, 0, 0, 0, 0, negType, 0, 8, 0, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(packet[15:], code)
+		return packet
+	}
+
+	tests := []struct {
+		name          string
+		credLists     []string
+		serve         func(conn net.Conn)
+		expectedError string
+		expectedDebug string
+	}{
+		{
+			name: "not rdp",
+			serve: func(conn net.Conn) {
+				conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			},
+			expectedError: "port open but no rdp",
+		},
+		{
+			name: "negotiation failure",
+			serve: func(conn net.Conn) {
+				conn.Write(confirm(rdpNegFailure, 2))
+			},
+			expectedError: "rdp negotiation failed",
+			expectedDebug: "server requires standard rdp security",
+		},
+		{
+			name: "tls without creds",
+			serve: func(conn net.Conn) {
+				conn.Write(confirm(rdpNegRsp, rdpProtocolSSL))
+				tls.Server(conn, tlsConfig).Handshake()
+			},
+			expectedDebug: "server negotiated rdp",
+		},
+		{
+			name:      "no nla with creds",
+			credLists: []string{"creds.csv"},
+			serve: func(conn net.Conn) {
+				conn.Write(confirm(rdpNegRsp, rdpProtocolRDP))
+			},
+			expectedError: "server doesn't support nla",
+		},
+		{
+			name:      "bad credentials",
+			credLists: []string{"creds.csv"},
+			serve: func(conn net.Conn) {
+				conn.Write(confirm(rdpNegRsp, rdpProtocolHybrid))
+				tlsConn := tls.Server(conn, tlsConfig)
+				negotiate, err := readTSRequest(tlsConn)
+				if err != nil || len(negotiate.NegoTokens) == 0 {
+					return
+				}
+				// echo the client's flags back in a bare NTLM challenge
+				challenge := make([]byte, 60)
+				copy(challenge, "NTLMSSP\x00")
+				challenge[8] = 2
+				flags := binary.LittleEndian.Uint32(negotiate.NegoTokens[0].Token[12:])
+				binary.LittleEndian.PutUint32(challenge[20:], flags&^0x02000000|0x00800000)
+				copy(challenge[24:], "12345678")
+				binary.LittleEndian.PutUint16(challenge[40:], 4)
+				binary.LittleEndian.PutUint16(challenge[42:], 4)
+				binary.LittleEndian.PutUint32(challenge[44:], 56)
+				writeTSRequest(tlsConn, tsRequest{Version: 6, NegoTokens: []negoToken{{challenge}}})
+
+				auth, err := readTSRequest(tlsConn)
+				if err != nil || len(auth.PubKeyAuth) == 0 || len(auth.ClientNonce) != 32 {
+					return
+				}
+				writeTSRequest(tlsConn, tsRequest{Version: 6, ErrorCode: -1073741715}) // STATUS_LOGON_FAILURE
+			},
+			expectedError: "rdp login failed",
+			expectedDebug: "0xc000006d for user alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				io.ReadFull(conn, make([]byte, int(binary.BigEndian.Uint16(request[2:]))-4))
+				tt.serve(conn)
+			}()
+
+			rdpCheck := &Rdp{
+				Service: Service{
+					Target:    "127.0.0.1",
+					Port:      listener.Addr().(*net.TCPAddr).Port,
+					Timeout:   5,
+					CredLists: tt.credLists,
+				},
+			}
+
+			resultsChan := make(chan Result, 1)
+			rdpCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedError == "", result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeSmtpServer accepts mail without auth and hands each message to deliver
+func fakeSmtpServer(t *testing.T, deliver func(message []byte)) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+					case "EHLO", "HELO":
+						fmt.Fprint(conn, "250 localhost\r\n")
+					case "DATA":
+						fmt.Fprint(conn, "354 go ahead\r\n")
+						var message bytes.Buffer
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							message.WriteString(line)
+						}
+						deliver(message.Bytes())
+						fmt.Fprint(conn, "250 queued\r\n")
+					case "QUIT":
+						fmt.Fprint(conn, "221 bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "250 ok\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// fakePop3Server serves the messages in box, deleting them on a clean QUIT
+func fakePop3Server(t *testing.T, box *[][]byte, mu *sync.Mutex) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				mu.Lock()
+				messages := slices.Clone(*box)
+				mu.Unlock()
+				deleted := map[int]bool{}
+				fmt.Fprint(conn, "+OK ready\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					arg := 0
+					if len(fields) > 1 {
+						arg, _ = strconv.Atoi(fields[1])
+					}
+					switch fields[0] {
+					case "LIST":
+						fmt.Fprint(conn, "+OK\r\n")
+						for i, m := range messages {
+							fmt.Fprintf(conn, "%d %d\r\n", i+1, len(m))
+						}
+						fmt.Fprint(conn, ".\r\n")
+					case "TOP":
+						header, _, _ := bytes.Cut(messages[arg-1], []byte("\r\n\r\n"))
+						fmt.Fprintf(conn, "+OK\r\n%s\r\n\r\n.\r\n", header)
+					case "DELE":
+						deleted[arg] = true
+						fmt.Fprint(conn, "+OK\r\n")
+					case "QUIT":
+						mu.Lock()
+						*box = slices.DeleteFunc(*box, func(m []byte) bool {
+							for id := range deleted {
+								if bytes.Equal(m, messages[id-1]) {
+									return true
+								}
+							}
+							return false
+						})
+						mu.Unlock()
+						fmt.Fprint(conn, "+OK bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "+OK\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestMailRun_ActualExecution tests the mail check sending through a fake SMTP
+// server and reading the message back over IMAP and POP3
+func TestMailRun_ActualExecution(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("username,password\n"), 0o644))
+
+	runMail := func(check *Mail) Result {
+		require.NoError(t, check.Verify("box01", "127.0.0.1", 5, 3, 1, 3))
+		resultsChan := make(chan Result, 1)
+		check.Run(1, "01", 1, resultsChan)
+		select {
+		case result := <-resultsChan:
+			return result
+		case <-time.After(10 * time.Second):
+			t.Fatal("check timed out")
+			return Result{}
+		}
+	}
+
+	t.Run("imap delivery", func(t *testing.T) {
+		be := memory.New()
+		user, err := be.Login(nil, "username", "password")
+		require.NoError(t, err)
+		inbox, err := user.GetMailbox(imap.InboxName)
+		require.NoError(t, err)
+
+		imapServer := server.New(be)
+		imapServer.AllowInsecureAuth = true
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go imapServer.Serve(listener)
+		defer imapServer.Close()
+
+		smtpPort := fakeSmtpServer(t, func(message []byte) {
+			inbox.CreateMessage(nil, time.Now(), bytes.NewBuffer(message))
+		})
+
+		result := runMail(&Mail{
+			Service:     Service{Target: "127.0.0.1", Port: smtpPort, CredLists: []string{"creds.csv"}},
+			MailboxPort: listener.Addr().(*net.TCPAddr).Port,
+		})
+		assert.True(t, result.Status, result.Error+": "+result.Debug)
+
+		// only the message that was there to start with is left
+		status, err := inbox.Status([]imap.StatusItem{imap.StatusMessages})
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1), status.Messages)
+	})
+
+	t.Run("pop3 delivery", func(t *testing.T) {
+		var mu sync.Mutex
+		var box [][]byte
+		pop3Port := fakePop3Server(t, &box, &mu)
+		smtpPort := fakeSmtpServer(t, func(message []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			box = append(box, message)
+		})
+
+		result := runMail(&Mail{
+			Service:     Service{Target: "127.0.0.1", Port: smtpPort, CredLists: []string{"creds.csv"}},
+			Mailbox:     "pop3",
+			MailboxPort: pop3Port,
+		})
+		assert.True(t, result.Status, result.Error+": "+result.Debug)
+		mu.Lock()
+		assert.Empty(t, box, "message should be deleted")
+		mu.Unlock()
+	})
+
+	t.Run("message never arrives", func(t *testing.T) {
+		var mu sync.Mutex
+		var box [][]byte
+		pop3Port := fakePop3Server(t, &box, &mu)
+		smtpPort := fakeSmtpServer(t, func(message []byte) {})
+
+		result := runMail(&Mail{
+			Service:     Service{Target: "127.0.0.1", Port: smtpPort, CredLists: []string{"creds.csv"}},
+			Mailbox:     "pop3",
+			MailboxPort: pop3Port,
+		})
+		assert.False(t, result.Status)
+		assert.Equal(t, "message never arrived", result.Error)
+	})
+
+	t.Run("smtp down", func(t *testing.T) {
+		result := runMail(&Mail{
+			Service:     Service{Target: "127.0.0.1", Port: 1, CredLists: []string{"creds.csv"}},
+			MailboxPort: 1,
+		})
+		assert.False(t, result.Status)
+		assert.Equal(t, "sending mail failed: connection to server failed", result.Error)
+	})
+}
+
+// fakeSqlDriver answers every query with the same columns and rows
+type fakeSqlDriver struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (d fakeSqlDriver) Open(string) (driver.Conn, error)    { return d, nil }
+func (d fakeSqlDriver) Prepare(string) (driver.Stmt, error) { return d, nil }
+func (d fakeSqlDriver) Close() error                        { return nil }
+func (d fakeSqlDriver) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+func (d fakeSqlDriver) NumInput() int                       { return 0 }
+func (d fakeSqlDriver) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (d fakeSqlDriver) Query([]driver.Value) (driver.Rows, error) {
+	return &fakeSqlRows{fakeSqlDriver: d}, nil
+}
+
+type fakeSqlRows struct {
+	fakeSqlDriver
+	next int
+}
+
+func (r *fakeSqlRows) Columns() []string { return r.columns }
+func (r *fakeSqlRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// TestSqlRun_Rows tests the SQL check's output assertions against a fake driver
+func TestSqlRun_Rows(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("scorer,password\n"), 0o644))
+
+	sql.Register("quotienttest", fakeSqlDriver{
+		columns: []string{"id", "name", "price"},
+		rows: [][]driver.Value{
+			{int64(1), "widget", "9.99"},
+			{int64(2), "gadget", nil},
+		},
+	})
+
+	tests := []struct {
+		name           string
+		query          queryData
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "output in named column",
+			query:          queryData{Command: "SELECT", Column: "name", Output: "gadget"},
+			expectedStatus: true,
+			expectedDebug:  "found exact string match: gadget",
+		},
+		{
+			name:          "output only checks the first column",
+			query:         queryData{Command: "SELECT", Output: "gadget"},
+			expectedDebug: "no matching output found",
+		},
+		{
+			name:          "missing column",
+			query:         queryData{Command: "SELECT", Column: "stock", Output: "5"},
+			expectedError: "query didn't return the output column",
+		},
+		{
+			name:           "all rows match",
+			query:          queryData{Command: "SELECT", Rows: [][]string{{"1", "widget", "9.99"}, {"2", "gadget", ""}}},
+			expectedStatus: true,
+			expectedDebug:  "all 2 rows matched",
+		},
+		{
+			name:           "rows match regexes",
+			query:          queryData{Command: "SELECT", UseRegex: true, Rows: [][]string{{`^\d+$`, "^w", `^\d+\.\d\d$`}, {`^\d+$`, "^g", ""}}},
+			expectedStatus: true,
+			expectedDebug:  "all 2 rows matched",
+		},
+		{
+			name:          "changed row",
+			query:         queryData{Command: "SELECT", Rows: [][]string{{"1", "widget", "9.99"}, {"2", "gadget", "4.99"}}},
+			expectedError: "query output didn't match expected rows",
+			expectedDebug: `row 2 column 3 was "", wanted "4.99"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlCheck := &Sql{
+				Service: Service{Target: "127.0.0.1", Port: 3306, Timeout: 5, CredLists: []string{"creds.csv"}},
+				Kind:    "quotienttest",
+				Query:   []queryData{tt.query},
+			}
+
+			resultsChan := make(chan Result, 1)
+			sqlCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// deniedReadsSftp serves sftp uploads and deletes out of a directory but
+// refuses every download
+type deniedReadsSftp struct{ dir string }
+
+func (h deniedReadsSftp) Fileread(*sftp.Request) (io.ReaderAt, error) {
+	return nil, os.ErrPermission
+}
+
+func (h deniedReadsSftp) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return os.Create(filepath.Join(h.dir, r.Filepath))
+}
+
+func (h deniedReadsSftp) Filecmd(r *sftp.Request) error {
+	if r.Method != "Remove" {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	return os.Remove(filepath.Join(h.dir, r.Filepath))
+}
+
+func (h deniedReadsSftp) Filelist(*sftp.Request) (sftp.ListerAt, error) {
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// fakeSshServer accepts scorer:password and serves exec requests and sftp out
+// of dir. "echo" commands print their arguments and anything else exits 1.
+// Reads can be set to "denied" to refuse every sftp download.
+func fakeSshServer(t *testing.T, dir string, hostKey crypto.Signer, reads string) int {
+	signer, err := ssh.NewSignerFromSigner(hostKey)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "scorer" && string(password) == "password" {
+				return nil, nil
+			}
+			return nil, errors.New("bad password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	serveSession := func(channel ssh.Channel, requests <-chan *ssh.Request) {
+		defer channel.Close()
+		for req := range requests {
+			var payload struct{ Value string }
+			ssh.Unmarshal(req.Payload, &payload)
+			switch req.Type {
+			case "exec":
+				req.Reply(true, nil)
+				status := uint32(1)
+				if args, ok := strings.CutPrefix(payload.Value, "echo "); ok {
+					fmt.Fprintln(channel, args)
+					status = 0
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			case "subsystem":
+				req.Reply(payload.Value == "sftp", nil)
+				if reads == "denied" {
+					h := deniedReadsSftp{dir: dir}
+					sftp.NewRequestServer(channel, sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}).Serve()
+					return
+				}
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(dir))
+				if err == nil {
+					server.Serve()
+				}
+				return
+			default:
+				req.Reply(false, nil)
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					if newChannel.ChannelType() != "session" {
+						newChannel.Reject(ssh.UnknownChannelType, "sessions only")
+						continue
+					}
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go serveSession(channel, requests)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestSshRun_ExecSftpAndPinning tests exec commands, sftp checks and host key
+// pinning against a real ssh server
+func TestSshRun_ExecSftpAndPinning(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("scorer,password\n"), 0o644))
+
+	home := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(home, "motd"), []byte("welcome to team 1\n"), 0o644))
+	motdHash, err := StringHash("welcome to team 1\n")
+	require.NoError(t, err)
+
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	port := fakeSshServer(t, home, hostKey, "")
+	// uploads can't be downloaded again from this one
+	deniedHome := t.TempDir()
+	deniedPort := fakeSshServer(t, deniedHome, hostKey, "denied")
+
+	authorizedKey := func(key *ecdsa.PrivateKey) string {
+		pub, err := ssh.NewPublicKey(&key.PublicKey)
+		require.NoError(t, err)
+		return marshalHostKey(pub)
+	}
+
+	tests := []struct {
+		name           string
+		check          Ssh
+		pinned         string
+		deniedReads    bool
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "exec output",
+			check:          Ssh{Command: []commandData{{Exec: true, Contains: true, Command: "echo hello", Output: "hello"}}},
+			expectedStatus: true,
+		},
+		{
+			name:           "exec expected failure",
+			check:          Ssh{Command: []commandData{{Exec: true, Command: "false", ExitCode: 1}}},
+			expectedStatus: true,
+		},
+		{
+			name:          "exec wrong status",
+			check:         Ssh{Command: []commandData{{Exec: true, Command: "false"}}},
+			expectedError: "command exited with the wrong status",
+			expectedDebug: "exited with 1, wanted 0",
+		},
+		{
+			name:           "sftp write and file hash",
+			check:          Ssh{Write: true, File: []sshFile{{Name: "motd", Hash: motdHash, Regex: "team \\d"}}},
+			expectedStatus: true,
+		},
+		{
+			name:          "sftp missing file",
+			check:         Ssh{File: []sshFile{{Name: "missing.txt"}}},
+			expectedError: "failed to read file",
+		},
+		{
+			name:          "sftp upload can't be downloaded",
+			check:         Ssh{Write: true},
+			deniedReads:   true,
+			expectedError: "failed to download uploaded file",
+		},
+		{
+			name:           "pinned key matches",
+			check:          Ssh{PinHostKey: true, Command: []commandData{{Exec: true, Command: "echo hi"}}},
+			pinned:         authorizedKey(hostKey),
+			expectedStatus: true,
+		},
+		{
+			name:          "pinned key changed",
+			check:         Ssh{PinHostKey: true, Command: []commandData{{Exec: true, Command: "echo hi"}}},
+			pinned:        authorizedKey(otherKey),
+			expectedError: "host key changed",
+			expectedDebug: "pinned key was SHA256:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sshCheck := tt.check
+			sshCheck.Service = Service{Target: "127.0.0.1", Port: port, Timeout: 5, CredLists: []string{"creds.csv"}}
+			if tt.deniedReads {
+				sshCheck.Port = deniedPort
+			}
+			require.NoError(t, sshCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+			if sshCheck.PinsHostKey() {
+				sshCheck.SetPinnedHostKey(tt.pinned)
+			}
+
+			resultsChan := make(chan Result, 1)
+			sshCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+				if sshCheck.PinHostKey {
+					assert.Equal(t, authorizedKey(hostKey), result.HostKey)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(home)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "uploaded probe should be deleted")
+	entries, err = os.ReadDir(deniedHome)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "probe that couldn't be downloaded should be deleted")
+}
+
+// fakeLdapServer answers binds for alice and searches under
+// dc=corp,dc=team01,dc=local with two people, upgrading to TLS on StartTLS
+func fakeLdapServer(t *testing.T, tlsConfig *tls.Config) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	result := func(id int64, tag ber.Tag, code int64) *ber.Packet {
+		envelope := ber.NewSequence("")
+		envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+		op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+		envelope.AppendChild(op)
+		return envelope
+	}
+	entry := func(id int64, dn string, attributes map[string]string) *ber.Packet {
+		envelope := ber.NewSequence("")
+		envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+		attrs := ber.NewSequence("")
+		for name, value := range attributes {
+			attr := ber.NewSequence("")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+			attr.AppendChild(values)
+			attrs.AppendChild(attr)
+		}
+		op.AppendChild(attrs)
+		envelope.AppendChild(op)
+		return envelope
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					packet, err := ber.ReadPacket(conn)
+					if err != nil || len(packet.Children) < 2 {
+						return
+					}
+					id := packet.Children[0].Value.(int64)
+					op := packet.Children[1]
+					switch op.Tag {
+					case ldap.ApplicationBindRequest:
+						name := op.Children[1].Data.String()
+						password := op.Children[2].Data.String()
+						code := int64(ldap.LDAPResultInvalidCredentials)
+						if (name == "alice@corp.team01.local" || name == "uid=alice,ou=people,dc=corp,dc=team01,dc=local") && password == "password" {
+							code = ldap.LDAPResultSuccess
+						}
+						conn.Write(result(id, ldap.ApplicationBindResponse, code).Bytes())
+					case ldap.ApplicationExtendedRequest:
+						conn.Write(result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess).Bytes())
+						tlsConn := tls.Server(conn, tlsConfig)
+						if err := tlsConn.Handshake(); err != nil {
+							return
+						}
+						conn = tlsConn
+					case ldap.ApplicationSearchRequest:
+						if !strings.HasSuffix(op.Children[0].Data.String(), "dc=corp,dc=team01,dc=local") {
+							conn.Write(result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject).Bytes())
+							continue
+						}
+						conn.Write(entry(id, "uid=alice,ou=people,dc=corp,dc=team01,dc=local", map[string]string{"mail": "alice@corp.team01.local", "title": "Admin"}).Bytes())
+						conn.Write(entry(id, "uid=bob,ou=people,dc=corp,dc=team01,dc=local", map[string]string{"mail": "bob@corp.team01.local"}).Bytes())
+						conn.Write(result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+					default:
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestLdapRun_SearchAndStartTls tests binds, searches and StartTLS against a
+// fake directory
+func TestLdapRun_SearchAndStartTls(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+
+	certServer := httptest.NewTLSServer(nil)
+	tlsConfig := certServer.TLS
+	certServer.Close()
+	port := fakeLdapServer(t, tlsConfig)
+
+	tests := []struct {
+		name           string
+		check          Ldap
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "upn bind with multi-label domain",
+			check:          Ldap{Domain: "corp.team{{team}}.local"},
+			expectedStatus: true,
+		},
+		{
+			name: "dn bind over starttls with search",
+			check: Ldap{
+				Domain:   "corp.team{{team}}.local",
+				StartTls: true,
+				BindDN:   "uid={{username}},ou=people,{{basedn}}",
+				Search:   []ldapSearch{{Filter: "(uid={{username}})", Expect: map[string]string{"MAIL": "Alice@corp.team01.local", "title": ""}}},
+			},
+			expectedStatus: true,
+			expectedDebug:  "found 1 matching entries",
+		},
+		{
+			name: "too few entries",
+			check: Ldap{
+				Domain: "corp.team{{team}}.local",
+				Search: []ldapSearch{{BaseDN: "ou=people,{{basedn}}", Scope: "one", MinEntries: 3}},
+			},
+			expectedError: "ldap search didn't find the expected entries",
+			expectedDebug: "found 2 entries, 2 matching, wanted at least 3",
+		},
+		{
+			name: "attribute changed",
+			check: Ldap{
+				Domain: "corp.team{{team}}.local",
+				Search: []ldapSearch{{Expect: map[string]string{"mail": "carol@corp.team01.local"}}},
+			},
+			expectedError: "ldap search didn't find the expected entries",
+		},
+		{
+			name: "wrong base dn",
+			check: Ldap{
+				Domain: "corp.team{{team}}.local",
+				Search: []ldapSearch{{BaseDN: "dc=example,dc=com"}},
+			},
+			expectedError: "ldap search failed",
+		},
+		{
+			name:          "bad bind dn",
+			check:         Ldap{BindDN: "cn={{username}},dc=example,dc=com"},
+			expectedError: "login failed for alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ldapCheck := tt.check
+			ldapCheck.Service = Service{Target: "127.0.0.1", Port: port, Timeout: 5, CredLists: []string{"creds.csv"}}
+			require.NoError(t, ldapCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			ldapCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// winrmReply is what the fake WinRM server answers a command with
+type winrmReply struct {
+	stdout, stderr string
+	exitCode       int
+}
+
+// fakeWinRMServer is an HTTPS WinRM endpoint that takes basic auth for alice
+// and answers powershell commands from replies
+func fakeWinRMServer(t *testing.T, replies map[string]winrmReply) *httptest.Server {
+	const envelope = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd" xmlns:rsp="http://schemas.microsoft.com/wbem/wsman/1/windows/shell"><s:Header><a:Action>%s</a:Action></s:Header><s:Body>%s</s:Body></s:Envelope>`
+	commandLine := regexp.MustCompile(`-EncodedCommand ([A-Za-z0-9+/=]+)`)
+	commandID := regexp.MustCompile(`CommandId="([^"]*)"`)
+
+	var mu sync.Mutex
+	var commands []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		request := string(body)
+		w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+
+		switch {
+		case strings.Contains(request, "transfer/Create<"):
+			fmt.Fprintf(w, envelope, "http://schemas.xmlsoap.org/ws/2004/09/transfer/CreateResponse",
+				`<a:ReferenceParameters><w:SelectorSet><w:Selector Name="ShellId">shell-1</w:Selector></w:SelectorSet></a:ReferenceParameters>`)
+		case strings.Contains(request, "shell/Command<"):
+			m := commandLine.FindStringSubmatch(request)
+			require.NotNil(t, m, request)
+			encoded, err := base64.StdEncoding.DecodeString(m[1])
+			require.NoError(t, err)
+			units := make([]uint16, len(encoded)/2)
+			for i := range units {
+				units[i] = binary.LittleEndian.Uint16(encoded[i*2:])
+			}
+			mu.Lock()
+			commands = append(commands, strings.TrimPrefix(string(utf16.Decode(units)), "$ProgressPreference = 'SilentlyContinue';"))
+			id := len(commands) - 1
+			mu.Unlock()
+			fmt.Fprintf(w, envelope, "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandResponse",
+				fmt.Sprintf(`<rsp:CommandResponse><rsp:CommandId>%d</rsp:CommandId></rsp:CommandResponse>`, id))
+		case strings.Contains(request, "shell/Receive<"):
+			id, _ := strconv.Atoi(commandID.FindStringSubmatch(request)[1])
+			mu.Lock()
+			reply, ok := replies[commands[id]]
+			mu.Unlock()
+			if !ok {
+				reply = winrmReply{stderr: "The term is not recognized", exitCode: 1}
+			}
+			fmt.Fprintf(w, envelope, "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/ReceiveResponse",
+				fmt.Sprintf(`<rsp:ReceiveResponse><rsp:Stream Name="stdout" CommandId="%[1]d">%[2]s</rsp:Stream><rsp:Stream Name="stderr" CommandId="%[1]d">%[3]s</rsp:Stream><rsp:CommandState CommandId="%[1]d" State="http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandState/Done"><rsp:ExitCode>%[4]d</rsp:ExitCode></rsp:CommandState></rsp:ReceiveResponse>`,
+					id, base64.StdEncoding.EncodeToString([]byte(reply.stdout)), base64.StdEncoding.EncodeToString([]byte(reply.stderr)), reply.exitCode))
+		default:
+			fmt.Fprintf(w, envelope, "http://schemas.xmlsoap.org/ws/2004/09/transfer/DeleteResponse", "")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestWinRMRun_ScriptsAndCACert tests basic auth, CA pinning and scripts
+// against a fake WinRM server
+func TestWinRMRun_ScriptsAndCACert(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+
+	server := fakeWinRMServer(t, map[string]winrmReply{
+		"Get-Service W3SVC | Select -Expand Status":  {stdout: "Running\r\n"},
+		"Test-Path C:\\inetpub\\wwwroot\\index.html": {stdout: "True\r\n"},
+		"Get-Content C:\\flag.txt":                   {stdout: "flag{winrm}\r\n"},
+		"Write-Error 'warning'; 'ok'":                {stdout: "ok\r\n", stderr: "warning"},
+		"exit 3":                                     {exitCode: 3},
+	})
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	require.NoError(t, os.MkdirAll("config/scoredfiles", 0o755))
+	require.NoError(t, os.WriteFile("config/scoredfiles/ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644))
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	otherTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other ca"},
+		DNSNames:              []string{"example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	otherDER, err := x509.CreateCertificate(crand.Reader, otherTemplate, otherTemplate, &otherKey.PublicKey, otherKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile("config/scoredfiles/other.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherDER}), 0o644))
+
+	exitThree := 3
+	tests := []struct {
+		name           string
+		check          WinRM
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name: "script with pinned ca",
+			check: WinRM{
+				CACert:     "ca.pem",
+				ServerName: "example.com",
+				Script: []winScript{{Command: []winCommandData{
+					{Command: "Get-Service W3SVC | Select -Expand Status", Output: "Running"},
+					{Command: "Test-Path C:\\inetpub\\wwwroot\\index.html", Output: "True"},
+					{Command: "Get-Content C:\\flag.txt", Output: `^flag\{\w+\}`, UseRegex: true},
+				}}},
+			},
+			expectedStatus: true,
+		},
+		{
+			name: "script step fails",
+			check: WinRM{Script: []winScript{{Command: []winCommandData{
+				{Command: "Get-Service W3SVC | Select -Expand Status", Output: "Running"},
+				{Command: "Remove-Item C:\\flag.txt"},
+			}}}},
+			expectedError: "command produced an error message",
+			expectedDebug: "script step 2",
+		},
+		{
+			name:           "exit code not checked unless set",
+			check:          WinRM{Command: []winCommandData{{Command: "exit 3"}}},
+			expectedStatus: true,
+		},
+		{
+			name:           "expected exit code",
+			check:          WinRM{Command: []winCommandData{{Command: "exit 3", ExitCode: &exitThree}}},
+			expectedStatus: true,
+		},
+		{
+			name:          "wrong exit code",
+			check:         WinRM{Command: []winCommandData{{Command: "exit 3", ExitCode: new(int)}}},
+			expectedError: "command exited with the wrong status",
+			expectedDebug: "exited with 3, wanted 0",
+		},
+		{
+			name:          "stderr fails by default",
+			check:         WinRM{Command: []winCommandData{{Command: "Write-Error 'warning'; 'ok'", Output: "ok"}}},
+			expectedError: "command produced an error message",
+		},
+		{
+			name:           "stderr allowed",
+			check:          WinRM{Command: []winCommandData{{Command: "Write-Error 'warning'; 'ok'", Output: "ok", AllowStderr: true}}},
+			expectedStatus: true,
+		},
+		{
+			name:          "wrong ca",
+			check:         WinRM{CACert: "other.pem", ServerName: "example.com"},
+			expectedError: "connection test failed",
+			expectedDebug: "certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winrmCheck := tt.check
+			winrmCheck.Service = Service{Target: "127.0.0.1", Port: port, Timeout: 5, CredLists: []string{"creds.csv"}}
+			winrmCheck.Encrypted = true
+			winrmCheck.Auth = "basic"
+			require.NoError(t, winrmCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			winrmCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeVncServer is an RFB 3.8 server offering the given security types. It
+// takes the password "password" (and the user alice for VeNCrypt Plain) and
+// answers framebuffer requests with an 8x8 screen from pixel, as two
+// rectangles, unless pixel is nil
+func fakeVncServer(t *testing.T, securityTypes []byte, pixel func(x, y int) [3]byte) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	certServer := httptest.NewTLSServer(nil)
+	tlsConfig := certServer.TLS
+	certServer.Close()
+
+	vncResponse := func(challenge []byte) []byte {
+		key := make([]byte, 8)
+		copy(key, "password")
+		for i, b := range key {
+			key[i] = bits.Reverse8(b)
+		}
+		block, err := des.NewCipher(key)
+		require.NoError(t, err)
+		response := make([]byte, 16)
+		block.Encrypt(response[:8], challenge[:8])
+		block.Encrypt(response[8:], challenge[8:])
+		return response
+	}
+
+	handle := func(conn net.Conn) {
+		defer func() { conn.Close() }()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		version := make([]byte, 12)
+		conn.Write([]byte("RFB 003.008\n"))
+		if _, err := io.ReadFull(conn, version); err != nil {
+			return
+		}
+		conn.Write(append([]byte{byte(len(securityTypes))}, securityTypes...))
+		chosen := make([]byte, 1)
+		if _, err := io.ReadFull(conn, chosen); err != nil {
+			return
+		}
+
+		ok := true
+		switch chosen[0] {
+		case 2:
+			challenge := make([]byte, 16)
+			crand.Read(challenge)
+			conn.Write(challenge)
+			response := make([]byte, 16)
+			if _, err := io.ReadFull(conn, response); err != nil {
+				return
+			}
+			ok = bytes.Equal(response, vncResponse(challenge))
+		case 19:
+			conn.Write([]byte{0, 2})
+			clientVersion := make([]byte, 2)
+			if _, err := io.ReadFull(conn, clientVersion); err != nil {
+				return
+			}
+			// accepted, then one sub-type
+			conn.Write([]byte{0, 1})
+			binary.Write(conn, binary.BigEndian, uint32(vencryptX509Plain))
+			var subType uint32
+			if err := binary.Read(conn, binary.BigEndian, &subType); err != nil || subType != vencryptX509Plain {
+				return
+			}
+			conn.Write([]byte{1})
+			tlsConn := tls.Server(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			var lengths [2]uint32
+			if err := binary.Read(conn, binary.BigEndian, &lengths); err != nil {
+				return
+			}
+			creds := make([]byte, lengths[0]+lengths[1])
+			if _, err := io.ReadFull(conn, creds); err != nil {
+				return
+			}
+			ok = string(creds) == "alice"+"password"
+		}
+		if !ok {
+			binary.Write(conn, binary.BigEndian, uint32(1))
+			binary.Write(conn, binary.BigEndian, uint32(len("authentication failed")))
+			conn.Write([]byte("authentication failed"))
+			return
+		}
+		binary.Write(conn, binary.BigEndian, uint32(0))
+
+		shared := make([]byte, 1)
+		if _, err := io.ReadFull(conn, shared); err != nil {
+			return
+		}
+		// 8x8, 32 bits per pixel true color, little endian, red in the third byte
+		serverInit := []byte{0, 8, 0, 8, 32, 24, 0, 1, 0, 255, 0, 255, 0, 255, 16, 8, 0, 0, 0, 0}
+		serverInit = binary.BigEndian.AppendUint32(serverInit, uint32(len("desktop")))
+		conn.Write(append(serverInit, "desktop"...))
+
+		for {
+			request := make([]byte, 10)
+			if _, err := io.ReadFull(conn, request); err != nil || request[0] != 3 {
+				return
+			}
+			if pixel == nil {
+				continue
+			}
+			update := []byte{0, 0, 0, 2}
+			for _, y0 := range []int{0, 4} {
+				update = binary.BigEndian.AppendUint16(update, 0)
+				update = binary.BigEndian.AppendUint16(update, uint16(y0))
+				update = binary.BigEndian.AppendUint16(update, 8)
+				update = binary.BigEndian.AppendUint16(update, 4)
+				update = binary.BigEndian.AppendUint32(update, 0)
+				for y := y0; y < y0+4; y++ {
+					for x := range 8 {
+						p := pixel(x, y)
+						update = append(update, p[2], p[1], p[0], 0)
+					}
+				}
+			}
+			conn.Write(update)
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestVncRun_Framebuffer tests security types and framebuffer checks against
+// a fake VNC server
+func TestVncRun_Framebuffer(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrong.csv", []byte("alice,hunter2\n"), 0o644))
+
+	// a desktop with a white window on the left
+	desktop := func(x, y int) [3]byte {
+		if x < 4 {
+			return [3]byte{255, 255, 255}
+		}
+		return [3]byte{0, 0, 40}
+	}
+	black := func(x, y int) [3]byte { return [3]byte{} }
+
+	require.NoError(t, os.MkdirAll("config/scoredfiles", 0o755))
+	writeThumbnail := func(name string, white func(x, y int) bool) {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := range 64 {
+			for x := range 64 {
+				if white(x, y) {
+					img.Set(x, y, color.White)
+				} else {
+					img.Set(x, y, color.Black)
+				}
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		require.NoError(t, os.WriteFile(filepath.Join("config/scoredfiles", name), buf.Bytes(), 0o644))
+	}
+	writeThumbnail("desktop.png", func(x, y int) bool { return x < 32 })
+	writeThumbnail("login.png", func(x, y int) bool { return y < 32 })
+
+	tests := []struct {
+		name           string
+		check          Vnc
+		credList       string
+		security       []byte
+		pixel          func(x, y int) [3]byte
+		expectedStatus bool
+		expectedError  string
+	}{
+		{
+			name:           "vnc password with matching thumbnail",
+			check:          Vnc{Thumbnail: "desktop.png", NonBlank: true},
+			security:       []byte{2},
+			pixel:          desktop,
+			expectedStatus: true,
+		},
+		{
+			name:          "wrong vnc password",
+			check:         Vnc{},
+			credList:      "wrong.csv",
+			security:      []byte{2},
+			pixel:         desktop,
+			expectedError: "failed to log in to VNC server",
+		},
+		{
+			name:           "no auth",
+			check:          Vnc{Security: "none"},
+			security:       []byte{1},
+			pixel:          desktop,
+			expectedStatus: true,
+		},
+		{
+			name:           "vencrypt x509 plain",
+			check:          Vnc{Security: "vencrypt", NonBlank: true},
+			security:       []byte{19},
+			pixel:          desktop,
+			expectedStatus: true,
+		},
+		{
+			name:          "vencrypt wrong password",
+			check:         Vnc{Security: "vencrypt"},
+			credList:      "wrong.csv",
+			security:      []byte{19},
+			pixel:         desktop,
+			expectedError: "failed to log in to VNC server",
+		},
+		{
+			name:          "black screen",
+			check:         Vnc{NonBlank: true},
+			security:      []byte{2},
+			pixel:         black,
+			expectedError: "screen is blank",
+		},
+		{
+			name:          "different screen",
+			check:         Vnc{Thumbnail: "login.png", MaxDifference: 4},
+			security:      []byte{2},
+			pixel:         desktop,
+			expectedError: "screen doesn't match the thumbnail",
+		},
+		{
+			name:          "hung desktop",
+			check:         Vnc{},
+			security:      []byte{2},
+			expectedError: "no framebuffer update",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := fakeVncServer(t, tt.security, tt.pixel)
+			credList := tt.credList
+			if credList == "" {
+				credList = "creds.csv"
+			}
+
+			vncCheck := tt.check
+			vncCheck.Service = Service{Target: "127.0.0.1", Port: port, Timeout: 3, CredLists: []string{credList}}
+			require.NoError(t, vncCheck.Verify("box01", "127.0.0.1", 5, 3, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			vncCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// writeScoredFile writes a file into config/scoredfiles for a test that has
+// changed into a temp dir
+func writeScoredFile(t *testing.T, name string, content []byte) {
+	require.NoError(t, os.MkdirAll("config/scoredfiles", 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join("config/scoredfiles", name), content, 0o644))
+}
+
+// TestDockerRun_Containers tests container checks against a fake Docker
+// Engine API that wants a client certificate
+func TestDockerRun_Containers(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	clientTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "quotient"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	clientDER, err := x509.CreateCertificate(crand.Reader, clientTemplate, clientTemplate, &clientKey.PublicKey, clientKey)
+	require.NoError(t, err)
+	clientCert, err := x509.ParseCertificate(clientDER)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+	writeScoredFile(t, "client.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER}))
+	writeScoredFile(t, "client-key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	containers := map[string]struct {
+		name   string
+		labels map[string]string
+		state  string
+		health string
+	}{
+		"a1": {name: "web", labels: map[string]string{"app": "shop"}, state: "running", health: "healthy"},
+		"b2": {name: "web-old", labels: map[string]string{"app": "shop"}, state: "running"},
+		"c3": {name: "db", labels: map[string]string{"app": "db"}, state: "running", health: "unhealthy"},
+		"d4": {name: "worker", labels: map[string]string{"app": "worker"}, state: "exited"},
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/containers/json" {
+			var filters map[string][]string
+			require.NoError(t, json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters))
+			listed := []map[string]any{}
+			for id, c := range containers {
+				if c.state != "running" {
+					continue
+				}
+				if names := filters["name"]; len(names) > 0 && !regexp.MustCompile(names[0]).MatchString("/"+c.name) {
+					continue
+				}
+				if labels := filters["label"]; len(labels) > 0 {
+					key, value, _ := strings.Cut(labels[0], "=")
+					if c.labels[key] != value {
+						continue
+					}
+				}
+				listed = append(listed, map[string]any{"Id": id, "Names": []string{"/" + c.name}})
+			}
+			json.NewEncoder(w).Encode(listed)
+			return
+		}
+		c, ok := containers[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"No such container"}`)
+			return
+		}
+		state := map[string]any{"Status": c.state, "Running": c.state == "running"}
+		if c.health != "" {
+			state["Health"] = map[string]any{"Status": c.health}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"State": state})
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	writeScoredFile(t, "docker-ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	tests := []struct {
+		name           string
+		check          Docker
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "running and healthy by name and label",
+			check:          Docker{Container: []dockerContainer{{Name: "web"}, {Label: "app=shop", Count: 2}}},
+			expectedStatus: true,
+		},
+		{
+			name:          "not enough replicas",
+			check:         Docker{Container: []dockerContainer{{Label: "app=shop", Count: 3}}},
+			expectedError: "container isn't running",
+			expectedDebug: "2 of 3",
+		},
+		{
+			name:          "unhealthy",
+			check:         Docker{Container: []dockerContainer{{Name: "db"}}},
+			expectedError: "container isn't healthy",
+			expectedDebug: "db is unhealthy",
+		},
+		{
+			name:          "exited",
+			check:         Docker{Container: []dockerContainer{{Name: "worker"}}},
+			expectedError: "container isn't running",
+		},
+		{
+			name:          "no client cert",
+			check:         Docker{apiAuth: apiAuth{CACert: "docker-ca.pem"}, Container: []dockerContainer{{Name: "web"}}},
+			expectedError: "docker api request failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dockerCheck := tt.check
+			dockerCheck.Service = Service{Target: "127.0.0.1", Port: port, Timeout: 5}
+			dockerCheck.Encrypted = true
+			if dockerCheck.ClientCert == "" && dockerCheck.CACert == "" {
+				dockerCheck.apiAuth = apiAuth{CACert: "docker-ca.pem", ClientCert: "client.pem", ClientKey: "client-key.pem"}
+			}
+			require.NoError(t, dockerCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			dockerCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// TestKubernetesRun_Workloads tests deployment and endpoint checks against a
+// fake Kubernetes API that takes a bearer token
+func TestKubernetesRun_Workloads(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeScoredFile(t, "token", []byte("s3cret-token\n"))
+	writeScoredFile(t, "bad-token", []byte("expired\n"))
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer s3cret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"kind":"Status","message":"Unauthorized"}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/apps/v1/namespaces/shop/deployments/web":
+			fmt.Fprint(w, `{"spec":{"replicas":3},"status":{"replicas":3,"readyReplicas":3}}`)
+		case "/apis/apps/v1/namespaces/shop/deployments/api":
+			fmt.Fprint(w, `{"spec":{"replicas":3},"status":{"replicas":3,"readyReplicas":1}}`)
+		case "/apis/apps/v1/namespaces/default/deployments/idle":
+			fmt.Fprint(w, `{"spec":{"replicas":0},"status":{}}`)
+		case "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices":
+			switch r.URL.Query().Get("labelSelector") {
+			case "kubernetes.io/service-name=web":
+				fmt.Fprint(w, `{"items":[{"endpoints":[{"addresses":["10.42.0.5"],"conditions":{"ready":true}},{"addresses":["10.42.0.6"]}]},{"endpoints":[{"addresses":["10.42.1.7"],"conditions":{"ready":false}}]}]}`)
+			default:
+				fmt.Fprint(w, `{"items":[]}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","message":"not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	writeScoredFile(t, "kube-ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	tests := []struct {
+		name           string
+		check          Kubernetes
+		token          string
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name: "ready deployment and endpoints",
+			check: Kubernetes{
+				Namespace:  "shop",
+				Deployment: []kubeDeployment{{Name: "web"}},
+				Endpoints:  []kubeEndpoints{{Service: "web", Ready: 2}},
+			},
+			expectedStatus: true,
+			expectedDebug:  "10.42.0.5, 10.42.0.6",
+		},
+		{
+			name:           "enough replicas asked for",
+			check:          Kubernetes{Namespace: "shop", Deployment: []kubeDeployment{{Name: "api", Replicas: 1}}},
+			expectedStatus: true,
+		},
+		{
+			name:          "replicas not ready",
+			check:         Kubernetes{Namespace: "shop", Deployment: []kubeDeployment{{Name: "api"}}},
+			expectedError: "deployment doesn't have enough ready replicas",
+			expectedDebug: "1 of 3",
+		},
+		{
+			name:          "scaled to zero",
+			check:         Kubernetes{Deployment: []kubeDeployment{{Name: "idle"}}},
+			expectedError: "deployment doesn't have enough ready replicas",
+		},
+		{
+			name:          "missing deployment",
+			check:         Kubernetes{Deployment: []kubeDeployment{{Name: "web"}}},
+			expectedError: "deployment not found",
+		},
+		{
+			name:          "no endpoints",
+			check:         Kubernetes{Namespace: "shop", Endpoints: []kubeEndpoints{{Service: "api"}}},
+			expectedError: "service doesn't have enough ready endpoints",
+		},
+		{
+			name:          "bad token",
+			check:         Kubernetes{Namespace: "shop", Deployment: []kubeDeployment{{Name: "web"}}},
+			token:         "bad-token",
+			expectedError: "kubernetes api rejected the credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeCheck := tt.check
+			kubeCheck.Service = Service{Target: "127.0.0.1", Port: port, Timeout: 5}
+			kubeCheck.apiAuth = apiAuth{CACert: "kube-ca.pem", TokenFile: "token"}
+			if tt.token != "" {
+				kubeCheck.TokenFile = tt.token
+			}
+			require.NoError(t, kubeCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			kubeCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeSnmpAgent answers v2c gets for one community from a fixed set of values.
+// Like real agents it ignores requests with the wrong community.
+func fakeSnmpAgent(t *testing.T, community string, values map[string]gosnmp.SnmpPDU) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request, err := (&gosnmp.GoSNMP{Version: gosnmp.Version2c}).SnmpDecodePacket(buf[:n])
+			if err != nil || request.Community != community {
+				continue
+			}
+			var variables []gosnmp.SnmpPDU
+			for _, v := range request.Variables {
+				value, ok := values[strings.TrimPrefix(v.Name, ".")]
+				if !ok {
+					value = gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject}
+				}
+				value.Name = v.Name
+				variables = append(variables, value)
+			}
+			request.PDUType = gosnmp.GetResponse
+			request.Variables = variables
+			reply, err := request.MarshalMsg()
+			if err != nil {
+				t.Logf("fake snmp agent: %v", err)
+				continue
+			}
+			conn.WriteTo(reply, addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// TestSnmpRun_Get tests SNMP gets and value matching against a fake agent
+func TestSnmpRun_Get(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/community.csv", []byte("snmp,team1secret\n"), 0o644))
+
+	values := map[string]gosnmp.SnmpPDU{
+		sysDescr:            {Type: gosnmp.OctetString, Value: []byte("Linux web01 6.1.0")},
+		"1.3.6.1.2.1.1.3.0": {Type: gosnmp.TimeTicks, Value: uint32(123456)},
+		"1.3.6.1.2.1.2.1.0": {Type: gosnmp.Integer, Value: 3},
+		"1.3.6.1.2.1.1.2.0": {Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"},
+	}
+	publicPort := fakeSnmpAgent(t, "public", values)
+	secretPort := fakeSnmpAgent(t, "team1secret", values)
+
+	tests := []struct {
+		name           string
+		check          Snmp
+		port           int
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "default sysDescr",
+			port:           publicPort,
+			expectedStatus: true,
+			expectedDebug:  `"Linux web01 6.1.0"`,
+		},
+		{
+			name: "values match",
+			check: Snmp{Oid: []snmpOid{
+				{Oid: "1.3.6.1.2.1.1.1.0", Value: `^Linux web\d+`, UseRegex: true},
+				{Oid: ".1.3.6.1.2.1.1.3.0"},
+				{Oid: "1.3.6.1.2.1.2.1.0", Value: "3"},
+				{Oid: "1.3.6.1.2.1.1.2.0", Value: "1.3.6.1.4.1.8072.3.2.10"},
+			}},
+			port:           publicPort,
+			expectedStatus: true,
+			expectedDebug:  `1.3.6.1.2.1.1.3.0 is "123456"`,
+		},
+		{
+			name:          "wrong value",
+			check:         Snmp{Oid: []snmpOid{{Oid: "1.3.6.1.2.1.2.1.0", Value: "4"}}},
+			port:          publicPort,
+			expectedError: "oid value didn't match",
+			expectedDebug: `is "3", wanted "4"`,
+		},
+		{
+			name:          "missing oid",
+			check:         Snmp{Oid: []snmpOid{{Oid: "1.3.6.1.2.1.1.5.0"}}},
+			port:          publicPort,
+			expectedError: "oid not found",
+		},
+		{
+			name:           "community from credlist",
+			check:          Snmp{Service: Service{CredLists: []string{"community.csv"}}},
+			port:           secretPort,
+			expectedStatus: true,
+			expectedDebug:  "community team1secret",
+		},
+		{
+			name:          "wrong community",
+			check:         Snmp{Community: "private"},
+			port:          publicPort,
+			expectedError: "snmp get failed",
+			expectedDebug: "community private",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snmpCheck := tt.check
+			snmpCheck.Target = "127.0.0.1"
+			snmpCheck.Port = tt.port
+			snmpCheck.Timeout = 3
+			require.NoError(t, snmpCheck.Verify("box01", "127.0.0.1", 5, 3, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			snmpCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// ntpTimestamp converts a time to the 64-bit NTP timestamp format
+func ntpTimestamp(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + 2208988800) // NTP counts from 1900
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// fakeNtpServer answers queries with its clock off by offset. Replies are
+// signed with a SHA-1 key when keyID isn't zero.
+func fakeNtpServer(t *testing.T, offset time.Duration, stratum byte, keyID uint32, key string) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			now := time.Now().Add(offset)
+			reply := make([]byte, 48)
+			reply[0] = 4<<3 | 4 // version 4, server mode
+			reply[1] = stratum
+			reply[2] = 6
+			reply[3] = 0xec
+			binary.BigEndian.PutUint32(reply[8:], 1<<10) // root dispersion, 1/64s
+			copy(reply[12:16], "LOCL")
+			binary.BigEndian.PutUint64(reply[16:], ntpTimestamp(now.Add(-time.Minute)))
+			copy(reply[24:32], buf[40:48]) // origin is the client's transmit time
+			binary.BigEndian.PutUint64(reply[32:], ntpTimestamp(now))
+			binary.BigEndian.PutUint64(reply[40:], ntpTimestamp(now))
+			if keyID != 0 {
+				reply = binary.BigEndian.AppendUint32(reply, keyID)
+				digest := sha1.Sum(append([]byte(key), reply[:48]...))
+				reply = append(reply, digest[:]...)
+			}
+			conn.WriteTo(reply, addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// TestNtpRun_Offset tests NTP offset tolerance, stratum and key checks
+func TestNtpRun_Offset(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/keys.csv", []byte("7,timekeeper\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrongkeys.csv", []byte("7,someoneelse\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/badid.csv", []byte("seven,timekeeper\n"), 0o644))
+
+	tests := []struct {
+		name           string
+		check          Ntp
+		port           int
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "in sync",
+			port:           fakeNtpServer(t, 0, 2, 0, ""),
+			expectedStatus: true,
+			expectedDebug:  "stratum 2",
+		},
+		{
+			name:          "clock off",
+			port:          fakeNtpServer(t, 5*time.Second, 2, 0, ""),
+			expectedError: "ntp server time is off",
+		},
+		{
+			name:           "within a wider tolerance",
+			check:          Ntp{Tolerance: 10000},
+			port:           fakeNtpServer(t, -5*time.Second, 2, 0, ""),
+			expectedStatus: true,
+		},
+		{
+			name:          "unsynchronized",
+			port:          fakeNtpServer(t, 0, 16, 0, ""),
+			expectedError: "ntp server isn't synchronized",
+		},
+		{
+			name:           "signed with the key",
+			check:          Ntp{Service: Service{CredLists: []string{"keys.csv"}}},
+			port:           fakeNtpServer(t, 0, 2, 7, "timekeeper"),
+			expectedStatus: true,
+			expectedDebug:  "key 7 timekeeper",
+		},
+		{
+			name:          "wrong key",
+			check:         Ntp{Service: Service{CredLists: []string{"wrongkeys.csv"}}},
+			port:          fakeNtpServer(t, 0, 2, 7, "timekeeper"),
+			expectedError: "ntp authentication failed",
+		},
+		{
+			name:          "key id isn't a number",
+			check:         Ntp{Service: Service{CredLists: []string{"badid.csv"}}},
+			port:          fakeNtpServer(t, 0, 2, 7, "timekeeper"),
+			expectedError: "error getting creds",
+			expectedDebug: "isn't an ntp key id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ntpCheck := tt.check
+			ntpCheck.Target = "127.0.0.1"
+			ntpCheck.Port = tt.port
+			ntpCheck.Timeout = 5
+			require.NoError(t, ntpCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			ntpCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// serveFake accepts connections on a local port and hands each one to handle
+func serveFake(t *testing.T, handle func(conn net.Conn)) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// fakeRedisServer speaks enough RESP2 for the redis check. A forgetful server
+// says OK to every SET but never stores anything.
+func fakeRedisServer(t *testing.T, username, password string, forgetful bool) int {
+	return serveFake(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		authed := password == ""
+		data := map[string]string{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || !strings.HasPrefix(line, "*") {
+				return
+			}
+			count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, count)
+			for i := range args {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+				arg := make([]byte, size+2)
+				if _, err := io.ReadFull(r, arg); err != nil {
+					return
+				}
+				args[i] = string(arg[:size])
+			}
+
+			command := strings.ToUpper(args[0])
+			switch {
+			case command == "AUTH":
+				if args[len(args)-1] == password && (len(args) == 2 || args[1] == username) {
+					authed = true
+					fmt.Fprint(conn, "+OK\r\n")
+				} else {
+					fmt.Fprint(conn, "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+				}
+			case !authed:
+				fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			case command == "PING":
+				fmt.Fprint(conn, "+PONG\r\n")
+			case command == "SET":
+				if !forgetful {
+					data[args[1]] = args[2]
+				}
+				fmt.Fprint(conn, "+OK\r\n")
+			case command == "GET":
+				if value, ok := data[args[1]]; ok {
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+				} else {
+					fmt.Fprint(conn, "$-1\r\n")
+				}
+			case command == "DEL":
+				delete(data, args[1])
+				fmt.Fprint(conn, ":1\r\n")
+			default:
+				fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+			}
+		}
+	})
+}
+
+// TestRedisRun_RoundTrip tests the redis login and SET/GET round trip
+func TestRedisRun_RoundTrip(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrong.csv", []byte("alice,hunter2\n"), 0o644))
+
+	tests := []struct {
+		name           string
+		credlist       string
+		port           int
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "no auth",
+			port:           fakeRedisServer(t, "", "", false),
+			expectedStatus: true,
+			expectedDebug:  "set and got quotient:check",
+		},
+		{
+			name:           "acl login",
+			credlist:       "creds.csv",
+			port:           fakeRedisServer(t, "alice", "password", false),
+			expectedStatus: true,
+			expectedDebug:  "alice:password",
+		},
+		{
+			name:          "wrong password",
+			credlist:      "wrong.csv",
+			port:          fakeRedisServer(t, "alice", "password", false),
+			expectedError: "redis connection or login failed",
+			expectedDebug: "WRONGPASS",
+		},
+		{
+			name:          "needs a login",
+			port:          fakeRedisServer(t, "alice", "password", false),
+			expectedError: "redis connection or login failed",
+			expectedDebug: "NOAUTH",
+		},
+		{
+			name:          "value not stored",
+			port:          fakeRedisServer(t, "", "", true),
+			expectedError: "redis get failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisCheck := Redis{Service: Service{Target: "127.0.0.1", Port: tt.port, Timeout: 5}}
+			if tt.credlist != "" {
+				redisCheck.CredLists = []string{tt.credlist}
+			}
+			require.NoError(t, redisCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			redisCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeMemcachedServer speaks the memcached text protocol. With a login set it
+// wants that "username password" set first, like memcached -Y does.
+func fakeMemcachedServer(t *testing.T, login string) int {
+	return serveFake(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		authed := login == ""
+		data := map[string]string{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				fmt.Fprint(conn, "ERROR\r\n")
+				continue
+			}
+			switch fields[0] {
+			case "set":
+				size, _ := strconv.Atoi(fields[4])
+				value := make([]byte, size+2)
+				if _, err := io.ReadFull(r, value); err != nil {
+					return
+				}
+				switch {
+				case !authed && string(value[:size]) == login:
+					authed = true
+					fmt.Fprint(conn, "STORED\r\n")
+				case !authed:
+					fmt.Fprint(conn, "CLIENT_ERROR authentication failure\r\n")
+				default:
+					data[fields[1]] = string(value[:size])
+					fmt.Fprint(conn, "STORED\r\n")
+				}
+			case "get":
+				if !authed {
+					fmt.Fprint(conn, "CLIENT_ERROR unauthenticated\r\n")
+					continue
+				}
+				if value, ok := data[fields[1]]; ok {
+					fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(value), value)
+				}
+				fmt.Fprint(conn, "END\r\n")
+			case "delete":
+				delete(data, fields[1])
+				fmt.Fprint(conn, "DELETED\r\n")
+			default:
+				fmt.Fprint(conn, "ERROR\r\n")
+			}
+		}
+	})
+}
+
+// TestMemcachedRun_RoundTrip tests the memcached login and set/get round trip
+func TestMemcachedRun_RoundTrip(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrong.csv", []byte("alice,hunter2\n"), 0o644))
+
+	tests := []struct {
+		name           string
+		credlist       string
+		port           int
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "no auth",
+			port:           fakeMemcachedServer(t, ""),
+			expectedStatus: true,
+			expectedDebug:  "set and got quotient-check",
+		},
+		{
+			name:           "auth file login",
+			credlist:       "creds.csv",
+			port:           fakeMemcachedServer(t, "alice password"),
+			expectedStatus: true,
+			expectedDebug:  "alice:password",
+		},
+		{
+			name:          "wrong password",
+			credlist:      "wrong.csv",
+			port:          fakeMemcachedServer(t, "alice password"),
+			expectedError: "memcached login failed",
+			expectedDebug: "authentication failure",
+		},
+		{
+			name:          "needs a login",
+			port:          fakeMemcachedServer(t, "alice password"),
+			expectedError: "memcached set failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memcachedCheck := Memcached{Service: Service{Target: "127.0.0.1", Port: tt.port, Timeout: 5}}
+			if tt.credlist != "" {
+				memcachedCheck.CredLists = []string{tt.credlist}
+			}
+			require.NoError(t, memcachedCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			memcachedCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeMongoServer answers the commands the mongo check sends. It wants a
+// SCRAM-SHA-256 login when username is set, and finds return every document
+// in the collection.
+func fakeMongoServer(t *testing.T, username, password string, collections map[string][]bson.D) int {
+	client, err := scram.SHA256.NewClient(username, password, "")
+	require.NoError(t, err)
+	stored := client.GetStoredCredentials(scram.KeyFactors{Salt: "quotient-salt", Iters: 4096})
+	scramServer, err := scram.SHA256.NewServer(func(name string) (scram.StoredCredentials, error) {
+		if name != username {
+			return scram.StoredCredentials{}, errors.New("unknown user")
+		}
+		return stored, nil
+	})
+	require.NoError(t, err)
+
+	const opReply, opQuery, opMsg = 1, 2004, 2013
+	return serveFake(t, func(conn net.Conn) {
+		authed := username == ""
+		var conversation *scram.ServerConversation
+		for {
+			header := make([]byte, 16)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			requestID := binary.LittleEndian.Uint32(header[4:])
+			opCode := binary.LittleEndian.Uint32(header[12:])
+			body := make([]byte, binary.LittleEndian.Uint32(header)-16)
+			if _, err := io.ReadFull(conn, body); err != nil {
+				return
+			}
+
+			var command bson.Raw
+			switch opCode {
+			case opQuery: // only the first hello on a connection
+				collectionEnd := 4 + bytes.IndexByte(body[4:], 0)
+				command = body[collectionEnd+9:] // skip and return counts
+			case opMsg:
+				command = body[5:] // flags, then one document section
+			default:
+				return
+			}
+			command = command[:binary.LittleEndian.Uint32(command)]
+
+			name := command.Index(0).Key()
+			var reply bson.D
+			switch name {
+			case "hello", "isMaster", "ismaster":
+				reply = bson.D{
+					{Key: "isWritablePrimary", Value: true}, {Key: "ismaster", Value: true},
+					{Key: "minWireVersion", Value: int32(0)}, {Key: "maxWireVersion", Value: int32(21)},
+					{Key: "maxBsonObjectSize", Value: int32(16 << 20)}, {Key: "maxMessageSizeBytes", Value: int32(48000000)},
+					{Key: "maxWriteBatchSize", Value: int32(100000)}, {Key: "logicalSessionTimeoutMinutes", Value: int32(30)},
+					{Key: "saslSupportedMechs", Value: bson.A{"SCRAM-SHA-256"}}, {Key: "ok", Value: 1.0},
+				}
+			case "saslStart", "saslContinue":
+				if name == "saslStart" {
+					conversation = scramServer.NewConversation()
+				}
+				_, payload := command.Lookup("payload").Binary()
+				challenge, err := conversation.Step(string(payload))
+				if err != nil {
+					reply = bson.D{{Key: "ok", Value: 0.0}, {Key: "errmsg", Value: "Authentication failed."}, {Key: "code", Value: int32(18)}}
+					break
+				}
+				authed = conversation.Valid()
+				reply = bson.D{
+					{Key: "conversationId", Value: int32(1)}, {Key: "done", Value: conversation.Done()},
+					{Key: "payload", Value: bson.Binary{Data: []byte(challenge)}}, {Key: "ok", Value: 1.0},
+				}
+			case "ping", "endSessions", "killCursors":
+				reply = bson.D{{Key: "ok", Value: 1.0}}
+			case "find":
+				if !authed {
+					reply = bson.D{{Key: "ok", Value: 0.0}, {Key: "errmsg", Value: "command find requires authentication"}, {Key: "code", Value: int32(13)}}
+					break
+				}
+				namespace := command.Lookup("$db").StringValue() + "." + command.Lookup("find").StringValue()
+				batch := bson.A{}
+				for _, doc := range collections[namespace] {
+					batch = append(batch, doc)
+				}
+				reply = bson.D{
+					{Key: "cursor", Value: bson.D{{Key: "firstBatch", Value: batch}, {Key: "id", Value: int64(0)}, {Key: "ns", Value: namespace}}},
+					{Key: "ok", Value: 1.0},
+				}
+			default:
+				reply = bson.D{{Key: "ok", Value: 0.0}, {Key: "errmsg", Value: "no such command: " + name}, {Key: "code", Value: int32(59)}}
+			}
+
+			doc, err := bson.Marshal(reply)
+			if err != nil {
+				t.Logf("fake mongo server: %v", err)
+				return
+			}
+			var out []byte
+			if opCode == opQuery {
+				out = make([]byte, 36) // header, flags, cursor id, starting from, number returned
+				binary.LittleEndian.PutUint32(out[12:], opReply)
+				binary.LittleEndian.PutUint32(out[32:], 1)
+			} else {
+				out = make([]byte, 21) // header, flags, section kind
+				binary.LittleEndian.PutUint32(out[12:], opMsg)
+			}
+			out = append(out, doc...)
+			binary.LittleEndian.PutUint32(out, uint32(len(out)))
+			binary.LittleEndian.PutUint32(out[8:], requestID)
+			if _, err := conn.Write(out); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// TestMongoRun_AuthAndFind tests the mongo login and find against a fake server
+func TestMongoRun_AuthAndFind(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrong.csv", []byte("alice,hunter2\n"), 0o644))
+
+	orders := map[string][]bson.D{"shop.orders": {
+		{{Key: "_id", Value: int32(1)}, {Key: "status", Value: "paid"}, {Key: "total", Value: int32(12)}, {Key: "customer", Value: bson.D{{Key: "name", Value: "bob"}}}},
+		{{Key: "_id", Value: int32(2)}, {Key: "status", Value: "paid"}, {Key: "total", Value: int32(30)}, {Key: "customer", Value: bson.D{{Key: "name", Value: "eve"}}}},
+	}}
+	openPort := fakeMongoServer(t, "", "", orders)
+	authPort := fakeMongoServer(t, "alice", "password", orders)
+
+	tests := []struct {
+		name           string
+		check          Mongo
+		port           int
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "connect without auth",
+			port:           openPort,
+			expectedStatus: true,
+			expectedDebug:  "connected, no creds",
+		},
+		{
+			name: "login and find",
+			check: Mongo{
+				Service: Service{CredLists: []string{"creds.csv"}},
+				Find:    []mongoFind{{Database: "shop", Collection: "orders", Filter: `{"status": "paid"}`, Expect: map[string]string{"customer.name": "bob", "total": "12"}}},
+			},
+			port:           authPort,
+			expectedStatus: true,
+			expectedDebug:  "returned 1 matching documents, creds used were alice:password",
+		},
+		{
+			name: "not enough documents",
+			check: Mongo{
+				Service: Service{CredLists: []string{"creds.csv"}},
+				Find:    []mongoFind{{Database: "shop", Collection: "orders", MinDocuments: 3}},
+			},
+			port:          authPort,
+			expectedError: "mongo find didn't return the expected documents",
+			expectedDebug: "returned 2 documents, 2 matching, wanted at least 3",
+		},
+		{
+			name: "no matching document",
+			check: Mongo{
+				Service: Service{CredLists: []string{"creds.csv"}},
+				Find:    []mongoFind{{Database: "shop", Collection: "orders", Expect: map[string]string{"customer.name": "mallory"}}},
+			},
+			port:          authPort,
+			expectedError: "mongo find didn't return the expected documents",
+		},
+		{
+			name:          "wrong password",
+			check:         Mongo{Service: Service{CredLists: []string{"wrong.csv"}}},
+			port:          authPort,
+			expectedError: "mongo connection or login failed",
+			expectedDebug: "alice:hunter2",
+		},
+		{
+			name:          "find needs a login",
+			check:         Mongo{Find: []mongoFind{{Database: "shop", Collection: "orders"}}},
+			port:          authPort,
+			expectedError: "mongo find failed",
+			expectedDebug: "requires authentication",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mongoCheck := tt.check
+			mongoCheck.Target = "127.0.0.1"
+			mongoCheck.Port = tt.port
+			mongoCheck.Timeout = 5
+			require.NoError(t, mongoCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			mongoCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeMqttBroker is a bare MQTT 3.1.1 broker that delivers messages back to
+// the client that published them. It checks the login when username is set,
+// and a lossy broker acks publishes without delivering them.
+func fakeMqttBroker(t *testing.T, username, password string, lossy bool) int {
+	return serveFake(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		var subscribed []string
+		for {
+			header, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			// the remaining length is a base-128 varint
+			length := 0
+			for shift := 0; ; shift += 7 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return
+				}
+				length |= int(b&0x7f) << shift
+				if b&0x80 == 0 {
+					break
+				}
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			readString := func() string {
+				n := int(binary.BigEndian.Uint16(body))
+				s := string(body[2 : 2+n])
+				body = body[2+n:]
+				return s
+			}
+
+			switch header >> 4 {
+			case 1: // CONNECT
+				readString() // protocol name
+				flags := body[1]
+				body = body[4:] // level, flags and keep alive
+				readString()    // client id
+				if flags&0x04 != 0 {
+					readString() // will topic
+					readString() // will message
+				}
+				var user, pass string
+				if flags&0x80 != 0 {
+					user = readString()
+				}
+				if flags&0x40 != 0 {
+					pass = readString()
+				}
+				if username != "" && (user != username || pass != password) {
+					conn.Write([]byte{0x20, 2, 0, 4}) // bad username or password
+					return
+				}
+				conn.Write([]byte{0x20, 2, 0, 0})
+			case 8: // SUBSCRIBE
+				packetID := body[:2]
+				body = body[2:]
+				var granted []byte
+				for len(body) > 0 {
+					subscribed = append(subscribed, readString())
+					body = body[1:]
+					granted = append(granted, 0)
+				}
+				conn.Write(append([]byte{0x90, byte(2 + len(granted)), packetID[0], packetID[1]}, granted...))
+			case 3: // PUBLISH
+				topic := readString()
+				if header>>1&3 > 0 {
+					conn.Write([]byte{0x40, 2, body[0], body[1]}) // PUBACK
+					body = body[2:]
+				}
+				if !lossy && slices.Contains(subscribed, topic) {
+					packet := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+					packet = append(append(packet, topic...), body...)
+					conn.Write(append([]byte{0x30, byte(len(packet))}, packet...))
+				}
+			case 12: // PINGREQ
+				conn.Write([]byte{0xd0, 0})
+			case 14: // DISCONNECT
+				return
+			}
+		}
+	})
+}
+
+// TestMqttRun_PublishSubscribe tests the MQTT publish/subscribe round trip
+func TestMqttRun_PublishSubscribe(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte("alice,password\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrong.csv", []byte("alice,hunter2\n"), 0o644))
+
+	tests := []struct {
+		name           string
+		check          Mqtt
+		port           int
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "anonymous round trip",
+			port:           fakeMqttBroker(t, "", "", false),
+			expectedStatus: true,
+			expectedDebug:  "on quotient/check, no creds",
+		},
+		{
+			name:           "login and custom topic",
+			check:          Mqtt{Service: Service{CredLists: []string{"creds.csv"}}, Topic: "plant/line1/status"},
+			port:           fakeMqttBroker(t, "alice", "password", false),
+			expectedStatus: true,
+			expectedDebug:  "on plant/line1/status, creds used were alice:password",
+		},
+		{
+			name:          "wrong password",
+			check:         Mqtt{Service: Service{CredLists: []string{"wrong.csv"}}},
+			port:          fakeMqttBroker(t, "alice", "password", false),
+			expectedError: "mqtt connection or login failed",
+			expectedDebug: "alice:hunter2",
+		},
+		{
+			name:          "message not delivered",
+			port:          fakeMqttBroker(t, "", "", true),
+			expectedError: "mqtt message wasn't delivered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mqttCheck := tt.check
+			mqttCheck.Target = "127.0.0.1"
+			mqttCheck.Port = tt.port
+			mqttCheck.Timeout = 3
+			require.NoError(t, mqttCheck.Verify("box01", "127.0.0.1", 5, 3, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			mqttCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeKdc is a KDC over TCP for one user that doesn't ask for
+// preauthentication, so a wrong password only shows when the client can't
+// decrypt the reply. It hands out service tickets for spns.
+func fakeKdc(t *testing.T, realm, username, password string, spns []string) int {
+	aes, err := krbcrypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	require.NoError(t, err)
+	sessionKey, err := types.GenerateEncryptionKey(aes)
+	require.NoError(t, err)
+	krbtgt := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm)
+
+	krbError := func(sname types.PrincipalName, code int32) []byte {
+		e := messages.NewKRBError(sname, realm, code, "")
+		b, err := e.Marshal()
+		require.NoError(t, err)
+		return b
+	}
+	encrypt := func(part messages.EncKDCRepPart, key types.EncryptionKey, usage uint32) types.EncryptedData {
+		b, err := part.Marshal()
+		require.NoError(t, err)
+		enc, err := krbcrypto.GetEncryptedData(b, key, usage, 1)
+		require.NoError(t, err)
+		return enc
+	}
+	// the client never looks inside tickets, so they hold nothing
+	ticket := func(sname types.PrincipalName) messages.Ticket {
+		return messages.Ticket{TktVNO: 5, Realm: realm, SName: sname, EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("ticket")}}
+	}
+	encPart := func(nonce int, sname types.PrincipalName) messages.EncKDCRepPart {
+		now := time.Now().UTC()
+		return messages.EncKDCRepPart{Key: sessionKey, LastReqs: []messages.LastReq{}, Nonce: nonce, Flags: types.NewKrbFlags(),
+			AuthTime: now, StartTime: now, EndTime: now.Add(time.Hour), SRealm: realm, SName: sname}
+	}
+
+	reply := func(req []byte) []byte {
+		switch req[0] {
+		case 0x6a: // AS-REQ
+			var asReq messages.ASReq
+			require.NoError(t, asReq.Unmarshal(req))
+			body := asReq.ReqBody
+			if body.Realm != realm || body.CName.PrincipalNameString() != username {
+				return krbError(body.SName, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN)
+			}
+			userKey, _, err := krbcrypto.GetKeyFromPassword(password, body.CName, realm, etypeID.AES256_CTS_HMAC_SHA1_96, nil)
+			require.NoError(t, err)
+			asRep := messages.ASRep{KDCRepFields: messages.KDCRepFields{PVNO: 5, MsgType: msgtype.KRB_AS_REP, CRealm: realm, CName: body.CName,
+				Ticket: ticket(krbtgt), EncPart: encrypt(encPart(body.Nonce, body.SName), userKey, keyusage.AS_REP_ENCPART)}}
+			b, err := asRep.Marshal()
+			require.NoError(t, err)
+			return b
+		case 0x6c: // TGS-REQ
+			var tgsReq messages.TGSReq
+			require.NoError(t, tgsReq.Unmarshal(req))
+			body := tgsReq.ReqBody
+			if !slices.Contains(spns, body.SName.PrincipalNameString()) {
+				return krbError(body.SName, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+			}
+			tgsRep := messages.TGSRep{KDCRepFields: messages.KDCRepFields{PVNO: 5, MsgType: msgtype.KRB_TGS_REP, CRealm: realm, CName: body.CName,
+				Ticket: ticket(body.SName), EncPart: encrypt(encPart(body.Nonce, body.SName), sessionKey, keyusage.TGS_REP_ENCPART_SESSION_KEY)}}
+			b, err := tgsRep.Marshal()
+			require.NoError(t, err)
+			return b
+		}
+		return krbError(krbtgt, errorcode.KRB_ERR_GENERIC)
+	}
+
+	return serveFake(t, func(conn net.Conn) {
+		for {
+			var size uint32
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil || size > 1<<16 {
+				return
+			}
+			req := make([]byte, size)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			resp := reply(req)
+			if binary.Write(conn, binary.BigEndian, uint32(len(resp))) != nil {
+				return
+			}
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// fakeDcDns serves the DC's SRV records with records, adding the target's
+// address to the answer when it's in glue and answering address queries from addrs
+func fakeDcDns(t *testing.T, records []string, glue []string, addrs []string) int {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		require.NoError(t, err)
+		return r
+	}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		for _, s := range records {
+			r := rr(s)
+			if r.Header().Rrtype != q.Qtype || !strings.EqualFold(r.Header().Name, q.Name) {
+				continue
+			}
+			resp.Answer = append(resp.Answer, r)
+			if srv, ok := r.(*dns.SRV); ok {
+				for _, g := range glue {
+					if a := rr(g); strings.EqualFold(a.Header().Name, srv.Target) {
+						resp.Extra = append(resp.Extra, a)
+					}
+				}
+			}
+		}
+		for _, s := range addrs {
+			if a := rr(s); a.Header().Rrtype == q.Qtype && strings.EqualFold(a.Header().Name, q.Name) {
+				resp.Answer = append(resp.Answer, a)
+			}
+		}
+		w.WriteMsg(resp)
+	})
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: udp, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return udp.LocalAddr().(*net.UDPAddr).Port
+}
+
+// TestKerberosRun_DomainController tests tickets and DC SRV records against a
+// fake KDC and DNS server
+func TestKerberosRun_DomainController(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("submissions/pcrs/1", 0o755))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/creds.csv", []byte(`CORP\alice,password`+"\n"), 0o644))
+	require.NoError(t, os.WriteFile("submissions/pcrs/1/wrong.csv", []byte("alice,hunter2\n"), 0o644))
+
+	kdcPort := fakeKdc(t, "CORP.TEAM01.LOCAL", "alice", "password", []string{"cifs/dc01.corp.team01.local"})
+	dnsPort := fakeDcDns(t, []string{
+		"_ldap._tcp.dc._msdcs.corp.team01.local. 600 IN SRV 0 100 389 dc01.corp.team01.local.",
+		"_kerberos._tcp.dc._msdcs.corp.team01.local. 600 IN SRV 0 100 88 dc01.corp.team01.local.",
+		"_ldap._tcp.corp.team01.local. 600 IN SRV 0 100 389 dc01.corp.team01.local.",
+		"_kerberos._tcp.corp.team01.local. 600 IN SRV 0 100 88 dc01.corp.team01.local.",
+		"_gc._tcp.corp.team01.local. 600 IN SRV 0 100 3268 dc02.corp.team01.local.",
+	}, []string{
+		"dc01.corp.team01.local. 3600 IN A 127.0.0.1",
+	}, []string{
+		"dc01.corp.team01.local. 3600 IN A 127.0.0.1",
+		"dc02.corp.team01.local. 3600 IN A 10.100.101.9",
+	})
+	resolver := fmt.Sprintf("127.0.0.1:%d", dnsPort)
+	creds := Service{CredLists: []string{"creds.csv"}}
+
+	tests := []struct {
+		name           string
+		check          Kerberos
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "tickets and dc locator records",
+			check:          Kerberos{Service: creds, Spn: []string{"cifs/dc_.corp.team_.local"}, Resolver: resolver},
+			expectedStatus: true,
+			expectedDebug:  "got a TGT in CORP.TEAM01.LOCAL and service tickets for cifs/dc01.corp.team01.local, 4 SRV records point at 127.0.0.1",
+		},
+		{
+			name:           "tickets only",
+			check:          Kerberos{Service: creds, SkipSrv: true},
+			expectedStatus: true,
+			expectedDebug:  `got a TGT in CORP.TEAM01.LOCAL, creds used were CORP\alice:password`,
+		},
+		{
+			name:          "wrong password",
+			check:         Kerberos{Service: Service{CredLists: []string{"wrong.csv"}}, SkipSrv: true},
+			expectedError: "kerberos login failed for alice",
+			expectedDebug: "alice:hunter2",
+		},
+		{
+			name:          "unknown spn",
+			check:         Kerberos{Service: creds, Spn: []string{"MSSQLSvc/sql01.corp.team_.local"}, SkipSrv: true},
+			expectedError: "service ticket request failed",
+			expectedDebug: "MSSQLSvc/sql01.corp.team01.local: KRB Error: (7) KDC_ERR_S_PRINCIPAL_UNKNOWN",
+		},
+		{
+			name:          "missing record",
+			check:         Kerberos{Service: creds, Srv: []string{"_ldap._tcp", "_kpasswd._tcp"}, Resolver: resolver},
+			expectedError: "srv record missing",
+			expectedDebug: "_kpasswd._tcp.corp.team01.local. has no SRV records",
+		},
+		{
+			name:          "record points at another host",
+			check:         Kerberos{Service: creds, Srv: []string{"_gc._tcp"}, Resolver: resolver},
+			expectedError: "srv record doesn't point at the dc",
+			expectedDebug: "dc02.corp.team01.local. port 3268 [10.100.101.9], not 127.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			krbCheck := tt.check
+			krbCheck.Target = "127.0.0.1"
+			krbCheck.Port = kdcPort
+			krbCheck.Timeout = 5
+			krbCheck.Realm = "CORP.TEAM_.LOCAL"
+			require.NoError(t, krbCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			krbCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
+// fakeSmbServer speaks just enough SMB 2.1 for the smb check: a guest login,
+// listing shares over the srvsvc pipe, and creating, reading, writing and
+// deleting the files in files, keyed by share\name. Reads can be set to
+// "corrupt", which flips the first byte of every read, or "denied".
+func fakeSmbServer(t *testing.T, shares []string, files map[string][]byte, mu *sync.Mutex, reads string) int {
+	le := binary.LittleEndian
+	smbString := func(b []byte) string {
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = le.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+
+	// the srvsvc NetShareEnumAll level 1 reply, with every share as a disk share
+	shareEnum := func(callID []byte) []byte {
+		out := make([]byte, 48+12*len(shares))
+		copy(out, []byte{5, 0, 2, 3, 0x10, 0, 0, 0})
+		copy(out[12:16], callID)
+		le.PutUint32(out[24:], 1)                   // level
+		le.PutUint32(out[28:], 1)                   // ctr
+		le.PutUint32(out[32:], 0x20000)             // ctr1 referent
+		le.PutUint32(out[36:], uint32(len(shares))) // count
+		le.PutUint32(out[40:], 0x20004)             // array referent
+		le.PutUint32(out[44:], uint32(len(shares))) // max count
+		for i, share := range shares {
+			le.PutUint32(out[48+12*i:], 0x20008) // name referent
+			le.PutUint32(out[56+12*i:], 0x2000c) // comment referent
+			name := utf16.Encode([]rune(share))
+			entry := make([]byte, (12+2*len(name)+3)&^3+12)
+			le.PutUint32(entry[0:], uint32(len(name)))
+			le.PutUint32(entry[8:], uint32(len(name)))
+			for j, u := range name {
+				le.PutUint16(entry[12+2*j:], u)
+			}
+			out = append(out, entry...) // with an empty comment after the name
+		}
+		out = append(out, make([]byte, 12)...) // total entries, resume handle, status
+		le.PutUint16(out[8:], uint16(len(out)))
+		le.PutUint32(out[16:], uint32(len(out)-24))
+		return out
+	}
+
+	return serveFake(t, func(conn net.Conn) {
+		trees := map[uint32]string{}
+		handles := map[uint64]string{}
+		nextID := uint32(1)
+		sessionSetups := 0
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(conn, req); err != nil || len(req) < 64 {
+				return
+			}
+			body := req[64:]
+			treeID := le.Uint32(req[36:40])
+			status := uint32(0)
+			var res []byte
+
+			switch le.Uint16(req[12:14]) {
+			case 0: // negotiate
+				res = make([]byte, 64)
+				le.PutUint16(res[0:], 65)
+				le.PutUint16(res[4:], 0x0210)
+				le.PutUint32(res[28:], 65536) // max transact, read and write sizes
+				le.PutUint32(res[32:], 65536)
+				le.PutUint32(res[36:], 65536)
+			case 1: // session setup, taken as a guest whatever the creds
+				sessionSetups++
+				if sessionSetups > 1 {
+					res = make([]byte, 9)
+					le.PutUint16(res[0:], 9)
+					le.PutUint16(res[2:], 1)
+					break
+				}
+				// an NTLM challenge with an empty target name and target info
+				challenge := make([]byte, 60)
+				copy(challenge, "NTLMSSP\x00")
+				le.PutUint32(challenge[8:], 2)
+				le.PutUint32(challenge[16:], 56)
+				le.PutUint32(challenge[20:], 0xe2898215)
+				le.PutUint16(challenge[40:], 4)
+				le.PutUint16(challenge[42:], 4)
+				le.PutUint32(challenge[44:], 56)
+				inner, err := asn1.Marshal(struct {
+					NegState      asn1.Enumerated       `asn1:"explicit,tag:0"`
+					SupportedMech asn1.ObjectIdentifier `asn1:"explicit,tag:1"`
+					ResponseToken []byte                `asn1:"explicit,tag:2"`
+				}{1, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}, challenge})
+				if err != nil {
+					return
+				}
+				token, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: inner})
+				if err != nil {
+					return
+				}
+				status = 0xc0000016 // more processing required
+				res = make([]byte, 8+len(token))
+				le.PutUint16(res[0:], 9)
+				le.PutUint16(res[2:], 1)
+				le.PutUint16(res[4:], 64+8)
+				le.PutUint16(res[6:], uint16(len(token)))
+				copy(res[8:], token)
+			case 2, 4: // logoff, tree disconnect
+				res = make([]byte, 4)
+				le.PutUint16(res[0:], 4)
+			case 3: // tree connect
+				off, n := le.Uint16(body[4:]), le.Uint16(body[6:])
+				path := smbString(req[off : off+n])
+				share := path[strings.LastIndex(path, `\`)+1:]
+				if share != "IPC$" && !slices.Contains(shares, share) {
+					status = 0xc00000cc // bad network name
+					break
+				}
+				treeID = nextID
+				nextID++
+				trees[treeID] = share
+				res = make([]byte, 16)
+				le.PutUint16(res[0:], 16)
+				res[2] = 1
+			case 5: // create
+				off, n := le.Uint16(body[44:]), le.Uint16(body[46:])
+				name := trees[treeID] + `\` + smbString(req[off:off+n])
+				mu.Lock()
+				content, ok := files[name]
+				if le.Uint32(body[36:]) == 5 { // overwrite if
+					files[name] = nil
+					ok = true
+				}
+				mu.Unlock()
+				if !ok && trees[treeID] != "IPC$" {
+					status = 0xc0000034 // object name not found
+					break
+				}
+				id := uint64(nextID)
+				nextID++
+				handles[id] = name
+				res = make([]byte, 88)
+				le.PutUint16(res[0:], 89)
+				le.PutUint32(res[4:], 1)
+				le.PutUint64(res[48:], uint64(len(content)))
+				le.PutUint32(res[56:], 0x80)
+				le.PutUint64(res[64:], id)
+			case 6: // close
+				delete(handles, le.Uint64(body[8:]))
+				res = make([]byte, 60)
+				le.PutUint16(res[0:], 60)
+			case 8: // read
+				length, offset := le.Uint32(body[4:]), le.Uint64(body[8:])
+				if reads == "denied" {
+					status = 0xc0000022 // access denied
+					break
+				}
+				mu.Lock()
+				content := files[handles[le.Uint64(body[16:])]]
+				mu.Unlock()
+				if offset >= uint64(len(content)) {
+					status = 0xc0000011 // end of file
+					break
+				}
+				data := slices.Clone(content[offset:min(offset+uint64(length), uint64(len(content)))])
+				if reads == "corrupt" {
+					data[0] ^= 0xff
+				}
+				res = make([]byte, 16+len(data))
+				le.PutUint16(res[0:], 17)
+				res[2] = 64 + 16
+				le.PutUint32(res[4:], uint32(len(data)))
+				copy(res[16:], data)
+			case 9: // write
+				off, n, offset := le.Uint16(body[2:]), le.Uint32(body[4:]), le.Uint64(body[8:])
+				name := handles[le.Uint64(body[16:])]
+				mu.Lock()
+				files[name] = append(files[name][:offset], req[uint32(off):uint32(off)+n]...)
+				mu.Unlock()
+				res = make([]byte, 16)
+				le.PutUint16(res[0:], 17)
+				le.PutUint32(res[4:], n)
+			case 11: // ioctl, only pipe transceives on srvsvc
+				off, n := le.Uint32(body[24:]), le.Uint32(body[28:])
+				rpc := req[off : off+n]
+				var out []byte
+				if rpc[2] == 11 { // bind, acked with just the header the client reads
+					out = make([]byte, 24)
+					copy(out, []byte{5, 0, 12, 3, 0x10, 0, 0, 0, 24})
+					copy(out[12:16], rpc[12:16])
+				} else {
+					out = shareEnum(rpc[12:16])
+				}
+				res = make([]byte, 48+len(out))
+				le.PutUint16(res[0:], 49)
+				copy(res[4:24], body[4:24]) // ctl code and file id
+				le.PutUint32(res[32:], 64+48)
+				le.PutUint32(res[36:], uint32(len(out)))
+				copy(res[48:], out)
+			case 17: // set info, only ever to delete a file
+				if body[3] == 13 {
+					mu.Lock()
+					delete(files, handles[le.Uint64(body[16:])])
+					mu.Unlock()
+				}
+				res = make([]byte, 2)
+				le.PutUint16(res[0:], 2)
+			default:
+				status = 0xc00000bb // not supported
+			}
+			if status != 0 && status != 0xc0000016 {
+				res = make([]byte, 9)
+				le.PutUint16(res[0:], 9)
+			}
+
+			out := make([]byte, 4+64+len(res))
+			binary.BigEndian.PutUint32(out, uint32(64+len(res)))
+			hdr := out[4:68]
+			copy(hdr, req[:64])
+			le.PutUint32(hdr[8:], status)
+			le.PutUint16(hdr[14:], max(le.Uint16(req[14:16]), 1)) // grant the credits asked for
+			le.PutUint32(hdr[16:], 1)                             // server to redirector
+			le.PutUint32(hdr[36:], treeID)
+			if le.Uint16(req[12:14]) != 0 {
+				le.PutUint64(hdr[40:], 1) // session id
+			}
+			copy(out[68:], res)
+			if _, err := conn.Write(out); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// TestSmbRun_WriteAndShares tests share listing, reading a file and the
+// write, read back and delete round trip against a fake SMB server
+func TestSmbRun_WriteAndShares(t *testing.T) {
+	tests := []struct {
+		name           string
+		check          Smb
+		reads          string
+		expectedStatus bool
+		expectedError  string
+		expectedDebug  string
+	}{
+		{
+			name:           "write, read back and delete",
+			check:          Smb{Share: "data", Write: true},
+			expectedStatus: true,
+			expectedDebug:  "smb write, read and delete of quotient-",
+		},
+		{
+			name:          "written file comes back different",
+			check:         Smb{Share: "data", Write: true},
+			reads:         "corrupt",
+			expectedError: "written file didn't match when read back",
+		},
+		{
+			name:          "written file can't be read back",
+			check:         Smb{Share: "data", Write: true},
+			reads:         "denied",
+			expectedError: "failed to read back written file",
+		},
+		{
+			name:           "reads a file",
+			check:          Smb{Share: "data", File: []smbFile{{Name: "flag.txt", Regex: "quotient\\{\\w+\\}"}}},
+			expectedStatus: true,
+			expectedDebug:  "smb file flag.txt matched regex",
+		},
+		{
+			name:           "shares listed",
+			check:          Smb{Shares: []string{"DATA", "public"}},
+			expectedStatus: true,
+			expectedDebug:  "smb login succeeded",
+		},
+		{
+			name:          "expected share missing",
+			check:         Smb{Shares: []string{"data", "backup"}},
+			expectedError: "expected share missing",
+			expectedDebug: "share backup wasn't listed, found data, public",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			files := map[string][]byte{`data\flag.txt`: []byte("quotient{c0ffee}\n")}
+			port := fakeSmbServer(t, []string{"data", "public"}, files, &mu, tt.reads)
+
+			smbCheck := tt.check
+			smbCheck.Target = "127.0.0.1"
+			smbCheck.Port = port
+			smbCheck.Timeout = 5
+			require.NoError(t, smbCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			smbCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, result.Error+": "+result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+				assert.Contains(t, result.Debug, tt.expectedDebug)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+
+			// the probe file is cleaned up whether the check passed or not
+			assert.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(files) == 1
+			}, 5*time.Second, 10*time.Millisecond, "test file left on the share")
+		})
+	}
+}
+
 // TestTcpRun_ActualExecution tests TCP check Run() with real TCP server
 func TestTcpRun_ActualExecution(t *testing.T) {
 	tests := []struct {
@@ -352,6 +3635,144 @@ func TestDnsRun_ActualExecution(t *testing.T) {
 	}
 }
 
+// TestDnsRun_RecordKinds tests DNS checks for each record kind, over udp and tcp,
+// with DNSSEC and with zone transfers
+func TestDnsRun_RecordKinds(t *testing.T) {
+	zone := "example.test."
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		require.NoError(t, err)
+		return r
+	}
+	records := map[uint16][]dns.RR{
+		dns.TypeA:     {rr("www.example.test. 300 IN A 10.100.101.2")},
+		dns.TypeAAAA:  {rr("www.example.test. 300 IN AAAA 2001:db8::2")},
+		dns.TypeCNAME: {rr("shop.example.test. 300 IN CNAME www.example.test.")},
+		dns.TypeTXT:   {rr(`example.test. 300 IN TXT "v=spf1 " "mx -all"`)},
+		dns.TypePTR:   {rr("2.101.100.10.in-addr.arpa. 300 IN PTR www.example.test.")},
+		dns.TypeNS:    {rr("example.test. 300 IN NS ns1.example.test.")},
+		dns.TypeMX:    {rr("example.test. 300 IN MX 10 mail.example.test.")},
+		dns.TypeSRV:   {rr("_ldap._tcp.example.test. 300 IN SRV 0 100 389 dc01.example.test.")},
+		dns.TypeSOA:   {rr("example.test. 300 IN SOA ns1.example.test. admin.example.test. 1 7200 3600 1209600 300")},
+	}
+
+	// one key signs both the zone and its own DNSKEY record
+	key := &dns.DNSKEY{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 300}, Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+	sign := func(rrset []dns.RR) dns.RR {
+		sig := &dns.RRSIG{Hdr: dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 300},
+			Inception: uint32(time.Now().Add(-time.Hour).Unix()), Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+			KeyTag: key.KeyTag(), SignerName: zone, Algorithm: key.Algorithm}
+		require.NoError(t, sig.Sign(priv.(crypto.Signer), rrset))
+		return sig
+	}
+	records[dns.TypeDNSKEY] = []dns.RR{key}
+	signatures := map[uint16]dns.RR{dns.TypeA: sign(records[dns.TypeA]), dns.TypeDNSKEY: sign(records[dns.TypeDNSKEY])}
+
+	allowTransfer := false
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		if q.Qtype == dns.TypeAXFR {
+			if !allowTransfer {
+				resp.Rcode = dns.RcodeRefused
+				w.WriteMsg(resp)
+				return
+			}
+			resp.Answer = append([]dns.RR{records[dns.TypeSOA][0]}, records[dns.TypeA]...)
+			resp.Answer = append(resp.Answer, records[dns.TypeSOA][0])
+			w.WriteMsg(resp)
+			return
+		}
+		for _, r := range records[q.Qtype] {
+			if strings.EqualFold(r.Header().Name, q.Name) {
+				resp.Answer = append(resp.Answer, r)
+			}
+		}
+		if opt := req.IsEdns0(); opt != nil && opt.Do() && len(resp.Answer) > 0 {
+			if sig, ok := signatures[q.Qtype]; ok {
+				resp.Answer = append(resp.Answer, sig)
+			}
+		}
+		w.WriteMsg(resp)
+	})
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	tcp, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Skip("cannot listen on tcp and udp with the same port")
+	}
+	udpServer := &dns.Server{PacketConn: udp, Handler: handler}
+	tcpServer := &dns.Server{Listener: tcp, Handler: handler}
+	go udpServer.ActivateAndServe()
+	go tcpServer.ActivateAndServe()
+	defer udpServer.Shutdown()
+	defer tcpServer.Shutdown()
+	time.Sleep(100 * time.Millisecond)
+
+	goodAnchor := key.ToDS(dns.SHA256).String()
+	badKey := *key
+	badKey.PublicKey = "bad" + key.PublicKey[3:]
+
+	tests := []struct {
+		name           string
+		record         DnsRecord
+		tcp            bool
+		dnssec         bool
+		anchors        []string
+		allowTransfer  bool
+		expectedStatus bool
+		expectedError  string
+	}{
+		{name: "A", record: DnsRecord{Kind: "A", Domain: "www.example.test", Answer: []string{"10.100.1_.2"}}, expectedStatus: true},
+		{name: "AAAA expanded", record: DnsRecord{Kind: "AAAA", Domain: "www.example.test", Answer: []string{"2001:db8:0:0:0:0:0:2"}}, expectedStatus: true},
+		{name: "CNAME", record: DnsRecord{Kind: "CNAME", Domain: "shop.example.test", Answer: []string{"WWW.example.test"}}, expectedStatus: true},
+		{name: "TXT", record: DnsRecord{Kind: "TXT", Domain: "example.test", Answer: []string{"v=spf1 mx -all"}}, expectedStatus: true},
+		{name: "PTR from an ip", record: DnsRecord{Kind: "PTR", Domain: "10.100.1_.2", Answer: []string{"www.example.test"}}, expectedStatus: true},
+		{name: "NS", record: DnsRecord{Kind: "NS", Domain: "example.test", Answer: []string{"ns1.example.test"}}, expectedStatus: true},
+		{name: "MX host", record: DnsRecord{Kind: "MX", Domain: "example.test", Answer: []string{"mail.example.test"}}, expectedStatus: true},
+		{name: "MX wrong preference", record: DnsRecord{Kind: "MX", Domain: "example.test", Answer: []string{"20 mail.example.test"}}, expectedError: "incorrect answer(s)"},
+		{name: "SRV", record: DnsRecord{Kind: "SRV", Domain: "_ldap._tcp.example.test", Answer: []string{"0 100 389 dc01.example.test"}}, expectedStatus: true},
+		{name: "SOA any", record: DnsRecord{Kind: "SOA", Domain: "example.test"}, expectedStatus: true},
+		{name: "SOA over tcp", record: DnsRecord{Kind: "SOA", Domain: "example.test", Answer: []string{"ns1.example.test admin.example.test"}}, tcp: true, expectedStatus: true},
+		{name: "missing record", record: DnsRecord{Kind: "TXT", Domain: "www.example.test"}, expectedError: "no records received"},
+		{name: "DNSSEC signed", record: DnsRecord{Kind: "A", Domain: "www.example.test"}, dnssec: true, anchors: []string{goodAnchor}, expectedStatus: true},
+		{name: "DNSSEC unsigned", record: DnsRecord{Kind: "MX", Domain: "example.test"}, dnssec: true, anchors: []string{goodAnchor}, expectedError: "dnssec validation failed"},
+		{name: "DNSSEC wrong anchor", record: DnsRecord{Kind: "A", Domain: "www.example.test"}, dnssec: true, anchors: []string{badKey.ToDS(dns.SHA256).String()}, expectedError: "dnssec validation failed"},
+		{name: "AXFR refused", record: DnsRecord{Kind: "AXFR", Domain: "example.test"}, expectedStatus: true},
+		{name: "AXFR allowed", record: DnsRecord{Kind: "AXFR", Domain: "example.test"}, allowTransfer: true, expectedError: "zone transfer allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowTransfer = tt.allowTransfer
+			dnsCheck := &Dns{
+				Service:     Service{Target: "127.0.0.1", Port: port, Timeout: 5},
+				Record:      []DnsRecord{tt.record},
+				Tcp:         tt.tcp,
+				Dnssec:      tt.dnssec,
+				TrustAnchor: tt.anchors,
+			}
+			require.NoError(t, dnsCheck.Verify("box01", "127.0.0.1", 5, 5, 1, 3))
+
+			resultsChan := make(chan Result, 1)
+			dnsCheck.Run(1, "01", 1, resultsChan)
+
+			select {
+			case result := <-resultsChan:
+				assert.Equal(t, tt.expectedStatus, result.Status, "%s: %s", result.Error, result.Debug)
+				assert.Contains(t, result.Error, tt.expectedError)
+			case <-time.After(10 * time.Second):
+				t.Fatal("check timed out")
+			}
+		})
+	}
+}
+
 // TestCustomRun_ActualExecution tests Custom check Run() with real command execution
 func TestCustomRun_ActualExecution(t *testing.T) {
 	tests := []struct {
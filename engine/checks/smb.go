@@ -1,21 +1,44 @@
 package checks
 
 import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"math/rand"
 	"net"
+	"path"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hirochachacha/go-smb2"
 )
 
 type Smb struct {
 	Service
-	Domain string
-	Share  string
-	File   []smbFile
+	Domain   string
+	Share    string
+	File     []smbFile
+	Shares   []string `toml:",omitempty"` // shares that must show up when listing them
+	Write    bool     `toml:",omitempty"` // write a file to Share, read it back and delete it
+	WriteDir string   `toml:",omitempty"` // directory on Share to write the file in
+	Dialect  string   `toml:",omitempty"` // only negotiate this SMB dialect, e.g. "3.1.1"
+	Signing  bool     `toml:",omitempty"` // require message signing
+}
+
+var smbDialects = map[string]uint16{
+	"":      0,
+	"2.0.2": 0x0202,
+	"2.1":   0x0210,
+	"3.0":   0x0300,
+	"3.0.2": 0x0302,
+	"3.1.1": 0x0311,
 }
 
 type smbFile struct {
@@ -40,7 +63,15 @@ func (c Smb) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			}
 		}
 
-		conn, err := net.Dial("tcp", c.Target+":"+strconv.Itoa(c.Port))
+		// a DOMAIN\user or user@domain username overrides the configured domain
+		domain := c.Domain
+		if d, u, ok := strings.Cut(username, `\`); ok {
+			domain, username = d, u
+		} else if u, d, ok := strings.Cut(username, "@"); ok {
+			domain, username = d, u
+		}
+
+		conn, err := net.DialTimeout("tcp", c.Target+":"+strconv.Itoa(c.Port), time.Duration(c.Timeout)*time.Second)
 		if err != nil {
 			checkResult.Error = "smb connection failed"
 			checkResult.Debug = err.Error()
@@ -54,9 +85,14 @@ func (c Smb) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 	}()
 
 		d := &smb2.Dialer{
+			Negotiator: smb2.Negotiator{
+				RequireMessageSigning: c.Signing,
+				SpecifiedDialect:      smbDialects[c.Dialect],
+			},
 			Initiator: &smb2.NTLMInitiator{
 				User:     username,
 				Password: password,
+				Domain:   domain,
 			},
 		}
 
@@ -73,88 +109,162 @@ func (c Smb) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 		}
 		defer s.Logoff()
 
-		if len(c.File) > 0 {
-			fs, err := s.Mount(c.Share)
+		if len(c.Shares) > 0 {
+			names, err := s.ListSharenames()
 			if err != nil {
-				checkResult.Error = "failed to mount share"
-				checkResult.Debug = "share " + c.Share + ", creds " + username + ":" + password
+				checkResult.Error = "failed to list shares"
+				checkResult.Debug = "creds " + username + ":" + password + " (" + err.Error() + ")"
 				response <- checkResult
 				return
 			}
-			defer fs.Umount()
+			for _, want := range c.Shares {
+				if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, want) }) {
+					checkResult.Error = "expected share missing"
+					checkResult.Debug = "share " + want + " wasn't listed, found " + strings.Join(names, ", ")
+					response <- checkResult
+					return
+				}
+			}
+		}
+
+		if len(c.File) == 0 && !c.Write {
+			checkResult.Status = true
+			checkResult.Debug = "smb login succeeded, creds " + username + ":" + password
+			response <- checkResult
+			return
+		}
 
-			file := c.File[rand.Intn(len(c.File))] // #nosec G404 -- non-crypto selection of file to test
+		fs, err := s.Mount(c.Share)
+		if err != nil {
+			checkResult.Error = "failed to mount share"
+			checkResult.Debug = "share " + c.Share + ", creds " + username + ":" + password
+			response <- checkResult
+			return
+		}
+		defer fs.Umount()
 
-			f, err := fs.Open(file.Name)
-			if err != nil {
-				checkResult.Error = "failed to open file"
-				checkResult.Debug = "creds " + username + ":" + password + ", file was " + file.Name + " (" + err.Error() + ")"
+		if c.Write {
+			// random name and content so a stale or faked file can't pass
+			token := make([]byte, 16)
+			if _, err := crand.Read(token); err != nil {
+				checkResult.Error = "error generating test file"
+				checkResult.Debug = err.Error()
 				response <- checkResult
 				return
 			}
+			name := path.Join(c.WriteDir, "quotient-"+hex.EncodeToString(token[:4])+".txt")
+			content := []byte("quotient smb write check " + hex.EncodeToString(token) + "\n")
+			debug := "creds " + username + ":" + password + ", file was " + name + " on share " + c.Share
+
+			if err := fs.WriteFile(name, content, 0o644); err != nil {
+				checkResult.Error = "failed to write file"
+				checkResult.Debug = debug + " (" + err.Error() + ")"
+				response <- checkResult
+				return
+			}
+			// don't leave the file behind if reading it back fails
+			removed := false
 			defer func() {
+				if removed {
+					return
+				}
+				if err := fs.Remove(name); err != nil {
+					slog.Debug("failed to delete smb test file", "file", name, "error", err)
+				}
+			}()
+			readBack, err := fs.ReadFile(name)
+			if err != nil {
+				checkResult.Error = "failed to read back written file"
+				checkResult.Debug = debug + " (" + err.Error() + ")"
+				response <- checkResult
+				return
+			}
+			if !bytes.Equal(readBack, content) {
+				checkResult.Error = "written file didn't match when read back"
+				checkResult.Debug = debug
+				response <- checkResult
+				return
+			}
+			if err := fs.Remove(name); err != nil {
+				checkResult.Error = "failed to delete written file"
+				checkResult.Debug = debug + " (" + err.Error() + ")"
+				response <- checkResult
+				return
+			}
+			removed = true
+			if len(c.File) == 0 {
+				checkResult.Status = true
+				checkResult.Debug = "smb write, read and delete of " + name + " succeeded, creds " + username + ":" + password
+				response <- checkResult
+				return
+			}
+		}
+
+		file := c.File[rand.Intn(len(c.File))] // #nosec G404 -- non-crypto selection of file to test
+
+		f, err := fs.Open(file.Name)
+		if err != nil {
+			checkResult.Error = "failed to open file"
+			checkResult.Debug = "creds " + username + ":" + password + ", file was " + file.Name + " (" + err.Error() + ")"
+			response <- checkResult
+			return
+		}
+		defer func() {
 			if err := f.Close(); err != nil {
 				slog.Error("failed to close smb file", "error", err)
 			}
 		}()
 
-			buf, err := io.ReadAll(f)
+		buf, err := io.ReadAll(f)
+		if err != nil {
+			checkResult.Error = "failed to read file"
+			checkResult.Debug = "creds " + username + ":" + password + ", file was " + file.Name + " (" + err.Error() + ")"
+			response <- checkResult
+			return
+		}
+
+		if file.Regex != "" {
+			re, err := regexp.Compile(file.Regex)
 			if err != nil {
-				checkResult.Error = "failed to read file"
-				checkResult.Debug = "creds " + username + ":" + password + ", file was " + file.Name + " (" + err.Error() + ")"
+				checkResult.Error = "error compiling regex to match for smb file"
+				checkResult.Debug = err.Error()
 				response <- checkResult
 				return
 			}
-
-			if file.Regex != "" {
-				re, err := regexp.Compile(file.Regex)
-				if err != nil {
-					checkResult.Error = "error compiling regex to match for smb file"
-					checkResult.Debug = err.Error()
-					response <- checkResult
-					return
-				}
-				reFind := re.Find(buf)
-				if reFind == nil {
-					checkResult.Error = "couldn't find regex in file"
-					checkResult.Debug = "couldn't find regex \"" + file.Regex + "\" for " + file.Name
-					response <- checkResult
-					return
-				}
-				checkResult.Status = true
-				checkResult.Debug = "smb file " + file.Name + " matched regex, creds " + username + ":" + password
+			reFind := re.Find(buf)
+			if reFind == nil {
+				checkResult.Error = "couldn't find regex in file"
+				checkResult.Debug = "couldn't find regex \"" + file.Regex + "\" for " + file.Name
 				response <- checkResult
 				return
-			} else if file.Hash != "" {
-				fileHash, err := StringHash(string(buf))
-				if err != nil {
-					checkResult.Error = "error calculating file hash"
-					checkResult.Debug = "file " + file.Name + ", " + err.Error()
-					response <- checkResult
-					return
-				} else if fileHash != file.Hash {
-					checkResult.Error = "file hash did not match"
-					checkResult.Debug = "file " + file.Name + " hash " + fileHash + " did not match specified hash " + file.Hash
-					response <- checkResult
-					return
-				}
-
-				checkResult.Status = true
-				checkResult.Debug = "smb file " + file.Name + " matched hash file, creds " + username + ":" + password
+			}
+			checkResult.Status = true
+			checkResult.Debug = "smb file " + file.Name + " matched regex, creds " + username + ":" + password
+			response <- checkResult
+			return
+		} else if file.Hash != "" {
+			fileHash, err := StringHash(string(buf))
+			if err != nil {
+				checkResult.Error = "error calculating file hash"
+				checkResult.Debug = "file " + file.Name + ", " + err.Error()
 				response <- checkResult
 				return
-			} else {
-				checkResult.Status = true
-				checkResult.Debug = "smb file " + file.Name + " retrieval successful, creds " + username + ":" + password
+			} else if fileHash != file.Hash {
+				checkResult.Error = "file hash did not match"
+				checkResult.Debug = "file " + file.Name + " hash " + fileHash + " did not match specified hash " + file.Hash
 				response <- checkResult
 				return
 			}
-		} else {
+
 			checkResult.Status = true
-			checkResult.Debug = "smb login succeeded, creds " + username + ":" + password
+			checkResult.Debug = "smb file " + file.Name + " matched hash file, creds " + username + ":" + password
 			response <- checkResult
 			return
 		}
+
+		checkResult.Status = true
+		checkResult.Debug = "smb file " + file.Name + " retrieval successful, creds " + username + ":" + password
+		response <- checkResult
 	}
 
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
@@ -176,6 +286,18 @@ func (c *Smb) Verify(box string, ip string, points int, timeout int, slapenalty
 	if c.Port == 0 {
 		c.Port = 445
 	}
+	if _, ok := smbDialects[c.Dialect]; !ok {
+		return fmt.Errorf("unknown smb dialect %q, use 2.0.2, 2.1, 3.0, 3.0.2 or 3.1.1", c.Dialect)
+	}
+	if c.Signing && len(c.CredLists) == 0 {
+		return errors.New("smb signing needs credlists, guest sessions can't sign")
+	}
+	if (len(c.File) > 0 || c.Write) && c.Share == "" {
+		return errors.New("smb files and writes need a share")
+	}
+	if c.WriteDir != "" && !c.Write {
+		return errors.New("smb writedir is only used with write")
+	}
 
 	return nil
 }
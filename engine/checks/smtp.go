@@ -38,138 +38,143 @@ func (a unencryptedAuth) Start(server *smtp.ServerInfo) (string, []byte, error)
 	return a.Auth.Start(&s)
 }
 
-func (c Smtp) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
-	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
-		// Create a dialer
-		dialer := net.Dialer{
-			Timeout: time.Duration(c.Timeout) * time.Second,
-		}
-
-		subject, body := generateRandomContent()
+// mailError is a failed step of sending or fetching mail. The step is what the
+// check reports, the wrapped error goes in the debug output.
+type mailError struct {
+	step string
+	err  error
+}
 
-		// ***********************************************
-		// Set up custom auth for bypassing net/smtp protections
-		username, password, err := c.getCreds(teamID)
-		if err != nil {
-			checkResult.Error = "error getting creds"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
-		}
+func (e *mailError) Error() string {
+	return e.step + ": " + e.err.Error()
+}
 
-		toUser, _, err := c.getCreds(teamID)
-		if err != nil {
-			checkResult.Error = "error getting creds"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
-		}
+// send logs in as username, if the check has credlists, and sends message to
+// the to address.
+func (c Smtp) send(username, password, to, message string) *mailError {
+	// Create a dialer
+	dialer := net.Dialer{
+		Timeout: time.Duration(c.Timeout) * time.Second,
+	}
 
-		auth := unencryptedAuth{smtp.PlainAuth("", username+c.Domain, password, c.Target)}
-		// ***********************************************
+	// ***********************************************
+	// Set up custom auth for bypassing net/smtp protections
+	auth := unencryptedAuth{smtp.PlainAuth("", username+c.Domain, password, c.Target)}
+	// ***********************************************
 
-		if c.Domain != "" {
-			username = username + c.Domain
-			toUser = toUser + c.Domain
-		}
+	if c.Domain != "" {
+		username = username + c.Domain
+	}
 
-		// The good way to do auth
-		// auth := smtp.PlainAuth("", d.Username, d.Password, d.Host)
-		// Create TLS config
-		tlsConfig := tls.Config{
-			InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
-		}
+	// The good way to do auth
+	// auth := smtp.PlainAuth("", d.Username, d.Password, d.Host)
+	// Create TLS config
+	tlsConfig := tls.Config{
+		InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+	}
 
-		// Declare these for the below if block
-		var conn net.Conn
+	// Declare these for the below if block
+	var conn net.Conn
+	var err error
 
-		if c.Encrypted {
-			conn, err = tls.DialWithDialer(&dialer, "tcp", fmt.Sprintf("%s:%d", c.Target, c.Port), &tlsConfig)
-		} else {
-			conn, err = dialer.DialContext(context.TODO(), "tcp", fmt.Sprintf("%s:%d", c.Target, c.Port))
-		}
-		if err != nil {
-			checkResult.Error = "connection to server failed"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
-		}
-		defer func() {
+	if c.Encrypted {
+		conn, err = tls.DialWithDialer(&dialer, "tcp", fmt.Sprintf("%s:%d", c.Target, c.Port), &tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(context.TODO(), "tcp", fmt.Sprintf("%s:%d", c.Target, c.Port))
+	}
+	if err != nil {
+		return &mailError{"connection to server failed", err}
+	}
+	defer func() {
 		if err := conn.Close(); err != nil {
-			slog.Error("failed to close smtp connection", "error", err)
+			slog.Debug("failed to close smtp connection", "error", err)
 		}
 	}()
 
-		// Create smtp client
-		sconn, err := smtp.NewClient(conn, c.Target)
-		if err != nil {
-			checkResult.Error = "smtp client creation failed"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
-		}
-		defer sconn.Quit()
-
-		// Login
-		if len(c.CredLists) > 0 {
-			authSupported, _ := sconn.Extension("AUTH")
-			if c.RequireAuth || authSupported {
-				err = sconn.Auth(auth)
-				if err != nil {
-					checkResult.Error = "login failed for " + username + ":" + password
-					checkResult.Debug = err.Error()
-					response <- checkResult
-					return
-				}
+	// Create smtp client
+	sconn, err := smtp.NewClient(conn, c.Target)
+	if err != nil {
+		return &mailError{"smtp client creation failed", err}
+	}
+	defer sconn.Quit()
+
+	// Login
+	if len(c.CredLists) > 0 {
+		authSupported, _ := sconn.Extension("AUTH")
+		if c.RequireAuth || authSupported {
+			err = sconn.Auth(auth)
+			if err != nil {
+				return &mailError{"login failed for " + username + ":" + password, err}
 			}
 		}
+	}
 
-		// Set the sender
-		err = sconn.Mail(username)
-		if err != nil {
-			checkResult.Error = "setting sender failed"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
-		}
+	// Set the sender
+	if err := sconn.Mail(username); err != nil {
+		return &mailError{"setting sender failed", err}
+	}
+
+	// Set the receiver
+	if err := sconn.Rcpt(to); err != nil {
+		return &mailError{"setting receiver failed", err}
+	}
+
+	// Create email writer
+	wc, err := sconn.Data()
+	if err != nil {
+		return &mailError{"creating email writer failed", err}
+	}
+
+	// Write the message using Fprint to avoid treating the contents as a
+	// format string.
+	if _, err := fmt.Fprint(wc, message); err != nil {
+		return &mailError{"writing message failed", err}
+	}
+
+	// the server only accepts the message once the data is finished
+	if err := wc.Close(); err != nil {
+		return &mailError{"server rejected message", err}
+	}
 
-		// Set the receiver
-		err = sconn.Rcpt(toUser)
+	return nil
+}
+
+func (c Smtp) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		subject, body := generateRandomContent()
+
+		// ***********************************************
+		// Set up custom auth for bypassing net/smtp protections
+		username, password, err := c.getCreds(teamID)
 		if err != nil {
-			checkResult.Error = "setting receiver failed"
+			checkResult.Error = "error getting creds"
 			checkResult.Debug = err.Error()
 			response <- checkResult
 			return
 		}
 
-		// Create email writer
-		wc, err := sconn.Data()
+		toUser, _, err := c.getCreds(teamID)
 		if err != nil {
-			checkResult.Error = "creating email writer failed"
+			checkResult.Error = "error getting creds"
 			checkResult.Debug = err.Error()
 			response <- checkResult
 			return
 		}
-		defer func() {
-			if err := wc.Close(); err != nil {
-				slog.Error("failed to close smtp writer", "error", err)
-			}
-		}()
 
 		message := fmt.Sprintf("Subject: %s\n\n%s\n\n", subject, body)
+		if c.Domain != "" {
+			toUser = toUser + c.Domain
+		}
 
-		// Write the message using Fprint to avoid treating the contents as a
-		// format string.
-		_, err = fmt.Fprint(wc, message)
-		if err != nil {
-			checkResult.Error = "writing message failed"
-			checkResult.Debug = err.Error()
+		if err := c.send(username, password, toUser, message); err != nil {
+			checkResult.Error = err.step
+			checkResult.Debug = err.err.Error()
 			response <- checkResult
 			return
 		}
 
 		checkResult.Status = true
-		checkResult.Debug = "successfully wrote '" + message + "' to " + toUser + " from " + username
+		checkResult.Debug = "successfully wrote '" + message + "' to " + toUser + " from " + username + c.Domain
 		response <- checkResult
 	}
 
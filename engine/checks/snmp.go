@@ -0,0 +1,260 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Snmp gets OIDs from an SNMP agent. Version 2c logs in with the community, or
+// the password from a credlist if the check has credlists. Version 3 always
+// uses a credlist, with the password for both authentication and privacy.
+type Snmp struct {
+	Service
+	Version      string    `toml:",omitempty"` // "2c" (the default) or "3"
+	Community    string    `toml:",omitempty"` // v2c community, "public" by default
+	AuthProtocol string    `toml:",omitempty"` // v3 "md5", "sha" (the default), "sha224", "sha256", "sha384" or "sha512"
+	PrivProtocol string    `toml:",omitempty"` // v3 "none" (the default), "des", "aes", "aes192" or "aes256"
+	Oid          []snmpOid `toml:",omitempty"`
+}
+
+// snmpOid is an OID the agent has to return, optionally with a set value
+type snmpOid struct {
+	Oid      string
+	Value    string `toml:",omitempty"` // empty for any value
+	UseRegex bool   `toml:",omitempty"`
+}
+
+// sysDescr is checked when no OIDs are configured
+const sysDescr = "1.3.6.1.2.1.1.1.0"
+
+var snmpOidPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)+$`)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"md5":    gosnmp.MD5,
+	"sha":    gosnmp.SHA,
+	"sha224": gosnmp.SHA224,
+	"sha256": gosnmp.SHA256,
+	"sha384": gosnmp.SHA384,
+	"sha512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"none":   gosnmp.NoPriv,
+	"des":    gosnmp.DES,
+	"aes":    gosnmp.AES,
+	"aes192": gosnmp.AES192,
+	"aes256": gosnmp.AES256,
+}
+
+func (c Snmp) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
+	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		var username, password string
+		if len(c.CredLists) > 0 {
+			var err error
+			username, password, err = c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+		}
+
+		client := &gosnmp.GoSNMP{
+			Target:    c.Target,
+			Port:      uint16(c.Port), // #nosec G115 -- port is checked in Verify
+			Transport: "udp",
+			Timeout:   time.Duration(c.Timeout) * time.Second / 3, // leave time to retry a dropped packet
+			Retries:   1,
+			MaxOids:   gosnmp.MaxOids,
+		}
+		login := "community " + c.Community
+		if c.Version == "3" {
+			msgFlags := gosnmp.AuthNoPriv
+			privPassword := ""
+			if c.PrivProtocol != "none" {
+				msgFlags = gosnmp.AuthPriv
+				privPassword = password
+			}
+			client.Version = gosnmp.Version3
+			client.SecurityModel = gosnmp.UserSecurityModel
+			client.MsgFlags = msgFlags
+			client.SecurityParameters = &gosnmp.UsmSecurityParameters{
+				UserName:                 username,
+				AuthenticationProtocol:   snmpAuthProtocols[c.AuthProtocol],
+				AuthenticationPassphrase: password,
+				PrivacyProtocol:          snmpPrivProtocols[c.PrivProtocol],
+				PrivacyPassphrase:        privPassword,
+			}
+			login = "user " + username + " password " + password
+		} else {
+			client.Version = gosnmp.Version2c
+			client.Community = c.Community
+			if len(c.CredLists) > 0 {
+				client.Community = password
+				login = "community " + password
+			}
+		}
+
+		if err := client.Connect(); err != nil {
+			checkResult.Error = "snmp connection failed"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		defer func() {
+			if err := client.Close(); err != nil {
+				slog.Error("failed to close snmp connection", "error", err)
+			}
+		}()
+
+		oids := make([]string, len(c.Oid))
+		for i, o := range c.Oid {
+			oids[i] = o.Oid
+		}
+		result, err := client.Get(oids)
+		if err != nil {
+			checkResult.Error = "snmp get failed"
+			checkResult.Debug = login + " failed with error: " + err.Error()
+			response <- checkResult
+			return
+		}
+		if result.Error != gosnmp.NoError {
+			checkResult.Error = "snmp get failed"
+			checkResult.Debug = login + " got error " + result.Error.String()
+			response <- checkResult
+			return
+		}
+
+		values := map[string]gosnmp.SnmpPDU{}
+		for _, v := range result.Variables {
+			values[strings.TrimPrefix(v.Name, ".")] = v
+		}
+		var got []string
+		for _, o := range c.Oid {
+			v, ok := values[o.Oid]
+			if !ok || v.Type == gosnmp.NoSuchObject || v.Type == gosnmp.NoSuchInstance || v.Type == gosnmp.EndOfMibView || v.Type == gosnmp.Null {
+				checkResult.Error = "oid not found"
+				checkResult.Debug = "agent has no value for " + o.Oid + ", " + login
+				response <- checkResult
+				return
+			}
+			value := snmpValue(v)
+			if o.Value != "" {
+				matched := value == o.Value
+				if o.UseRegex {
+					matched = regexp.MustCompile(o.Value).MatchString(value)
+				}
+				if !matched {
+					checkResult.Error = "oid value didn't match"
+					checkResult.Debug = fmt.Sprintf("%s is %q, wanted %q", o.Oid, value, o.Value)
+					response <- checkResult
+					return
+				}
+			}
+			got = append(got, fmt.Sprintf("%s is %q", o.Oid, value))
+		}
+
+		checkResult.Status = true
+		checkResult.Debug = login + ", " + strings.Join(got, ", ")
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// snmpValue formats a variable the way snmpget shows its value
+func snmpValue(v gosnmp.SnmpPDU) string {
+	switch value := v.Value.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return strings.TrimPrefix(value, ".")
+	}
+	switch v.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Counter64, gosnmp.Uinteger32:
+		return gosnmp.ToBigInt(v.Value).String()
+	}
+	return fmt.Sprint(v.Value)
+}
+
+func (c *Snmp) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
+	if c.ServiceType == "" {
+		c.ServiceType = "Snmp"
+	}
+	if err := c.Service.Configure(ip, points, timeout, slapenalty, slathreshold); err != nil {
+		return err
+	}
+	if c.Display == "" {
+		c.Display = "snmp"
+	}
+	if c.Name == "" {
+		c.Name = box + "-" + c.Display
+	}
+	if c.Port == 0 {
+		c.Port = 161
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid snmp port %d", c.Port)
+	}
+	if c.Version == "" {
+		c.Version = "2c"
+	}
+	switch c.Version {
+	case "2c":
+		if c.AuthProtocol != "" || c.PrivProtocol != "" {
+			return errors.New("snmp auth and priv protocols need version 3")
+		}
+		if c.Community == "" {
+			c.Community = "public"
+		}
+	case "3":
+		if len(c.CredLists) == 0 {
+			return errors.New("snmp version 3 needs credlists to log in with")
+		}
+		if c.Community != "" {
+			return errors.New("snmp community is only used by version 2c")
+		}
+		if c.AuthProtocol == "" {
+			c.AuthProtocol = "sha"
+		}
+		if c.PrivProtocol == "" {
+			c.PrivProtocol = "none"
+		}
+		if _, ok := snmpAuthProtocols[c.AuthProtocol]; !ok {
+			return fmt.Errorf("unknown snmp auth protocol %q", c.AuthProtocol)
+		}
+		if _, ok := snmpPrivProtocols[c.PrivProtocol]; !ok {
+			return fmt.Errorf("unknown snmp priv protocol %q", c.PrivProtocol)
+		}
+	default:
+		return fmt.Errorf("unknown snmp version %q, use 2c or 3", c.Version)
+	}
+
+	if len(c.Oid) == 0 {
+		c.Oid = []snmpOid{{Oid: sysDescr}}
+	}
+	if len(c.Oid) > gosnmp.MaxOids {
+		return fmt.Errorf("snmp check can get at most %d oids", gosnmp.MaxOids)
+	}
+	for i := range c.Oid {
+		o := &c.Oid[i]
+		o.Oid = strings.TrimPrefix(o.Oid, ".")
+		if !snmpOidPattern.MatchString(o.Oid) {
+			return fmt.Errorf("invalid snmp oid %q", o.Oid)
+		}
+		if o.UseRegex {
+			if _, err := regexp.Compile(o.Value); err != nil {
+				return fmt.Errorf("invalid regex for oid %s: %w", o.Oid, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -3,26 +3,97 @@ package checks
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"net"
+	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
 )
 
 type Sql struct {
 	Service
 	Kind  string
+	Tls   string `toml:",omitempty"` // "disable" (the default), "require" to use TLS without checking the certificate, or "verify"
 	Query []queryData
 }
 
 type queryData struct {
 	UseRegex bool
-	Command  string `toml:",omitempty"`
-	Database string `toml:",omitempty"`
-	Output   string `toml:",omitempty"`
+	Command  string     `toml:",omitempty"`
+	Database string     `toml:",omitempty"`
+	Output   string     `toml:",omitempty"`
+	Column   string     `toml:",omitempty"` // column Output is matched against, the first one if empty
+	Rows     [][]string `toml:",omitempty"` // every row and column the query has to return, in order
+}
+
+// sqlPorts are the default ports for each supported kind of database
+var sqlPorts = map[string]int{
+	"mysql":     3306,
+	"postgres":  5432,
+	"sqlserver": 1433,
+}
+
+var sqlTlsModes = []string{"disable", "require", "verify"}
+
+// dsn builds the connection string for the check's database driver.
+func (c Sql) dsn(username, password, database string) string {
+	host := net.JoinHostPort(c.Target, strconv.Itoa(c.Port))
+	timeout := time.Duration(c.Timeout) * time.Second
+
+	switch c.Kind {
+	case "postgres":
+		sslModes := map[string]string{"disable": "disable", "require": "require", "verify": "verify-full"}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(username, password),
+			Host:     host,
+			Path:     "/" + database,
+			RawQuery: url.Values{"sslmode": {sslModes[c.Tls]}, "connect_timeout": {strconv.Itoa(c.Timeout)}}.Encode(),
+		}
+		return u.String()
+	case "sqlserver":
+		query := url.Values{"dial timeout": {strconv.Itoa(c.Timeout)}}
+		if database != "" {
+			query.Set("database", database)
+		}
+		switch c.Tls {
+		case "disable":
+			query.Set("encrypt", "disable")
+		case "require":
+			query.Set("encrypt", "true")
+			query.Set("TrustServerCertificate", "true")
+		case "verify":
+			query.Set("encrypt", "true")
+		}
+		u := url.URL{
+			Scheme:   "sqlserver",
+			User:     url.UserPassword(username, password),
+			Host:     host,
+			RawQuery: query.Encode(),
+		}
+		return u.String()
+	default:
+		tlsConfigs := map[string]string{"disable": "false", "require": "skip-verify", "verify": "true"}
+		conf := mysql.NewConfig()
+		conf.User = username
+		conf.Passwd = password
+		conf.Net = "tcp"
+		conf.Addr = host
+		conf.DBName = database
+		conf.TLSConfig = tlsConfigs[c.Tls]
+		conf.Timeout = timeout
+		return conf.FormatDSN()
+	}
 }
 
 func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
@@ -43,7 +114,7 @@ func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 		}
 
 		// Open the DB handle
-		db, err := sql.Open(c.Kind, fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", username, password, c.Target, c.Port, q.Database))
+		db, err := sql.Open(c.Kind, c.dsn(username, password, q.Database))
 		if err != nil {
 			checkResult.Error = "creating db handle failed"
 			checkResult.Debug = "error: " + err.Error() + ", creds " + username + ":" + password
@@ -89,15 +160,13 @@ func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 	}()
 
 		// If no output to check, return success
-		if q.Output == "" {
+		if q.Output == "" && len(q.Rows) == 0 {
 			checkResult.Debug = "ran query sucessfully and no output to check against. creds used were " + username + ":" + password
 			checkResult.Status = true
 			response <- checkResult
 			return
 		}
 
-		// Check the rows
-		re := regexp.MustCompile(q.Output)
 		cols, err := rows.Columns()
 		if err != nil {
 			// handle error
@@ -107,13 +176,30 @@ func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			return
 		}
 
+		column := 0
+		if q.Column != "" {
+			column = slices.Index(cols, q.Column)
+			if column < 0 {
+				checkResult.Error = "query didn't return the output column"
+				checkResult.Debug = "no column " + q.Column + " in " + strings.Join(cols, ", ")
+				response <- checkResult
+				return
+			}
+		}
+
 		// Make a slice for the values
-		row := make([][]byte, len(cols))
+		row := make([]sql.RawBytes, len(cols))
 		rowPtr := make([]any, len(cols))
 		for i := range row {
 			rowPtr[i] = &row[i]
 		}
 
+		var re *regexp.Regexp
+		if q.UseRegex && q.Output != "" {
+			re = regexp.MustCompile(q.Output)
+		}
+
+		var got [][]string
 		for rows.Next() {
 			// Grab a value
 			err := rows.Scan(rowPtr...)
@@ -124,20 +210,28 @@ func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 				return
 			}
 
-			// TODO: by default we check against the first column
+			if len(q.Rows) > 0 {
+				values := make([]string, len(row))
+				for i := range row {
+					values[i] = strings.TrimSpace(string(row[i]))
+				}
+				got = append(got, values)
+				continue
+			}
+
 			// Check the regex match
 			if q.UseRegex {
-				if re.Match(row[0]) {
+				if re.Match(row[column]) {
 					checkResult.Status = true
-					checkResult.Debug = "found regex match: " + string(row[0]) + ". creds used were " + username + ":" + password
+					checkResult.Debug = "found regex match: " + string(row[column]) + ". creds used were " + username + ":" + password
 					response <- checkResult
 					return
 				}
 				// Check the direct string match
 			} else {
-				if strings.TrimSpace(string(row[0])) == q.Output {
+				if strings.TrimSpace(string(row[column])) == q.Output {
 					checkResult.Status = true
-					checkResult.Debug = "found exact string match: " + string(row[0]) + ". creds used were " + username + ":" + password
+					checkResult.Debug = "found exact string match: " + string(row[column]) + ". creds used were " + username + ":" + password
 					response <- checkResult
 					return
 				}
@@ -152,6 +246,19 @@ func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			return
 		}
 
+		if len(q.Rows) > 0 {
+			if mismatch := compareRows(q.Rows, got, q.UseRegex); mismatch != "" {
+				checkResult.Error = "query output didn't match expected rows"
+				checkResult.Debug = mismatch + ". creds used were " + username + ":" + password
+				response <- checkResult
+				return
+			}
+			checkResult.Status = true
+			checkResult.Debug = fmt.Sprintf("all %d rows matched. creds used were %s:%s", len(got), username, password)
+			response <- checkResult
+			return
+		}
+
 		// No matches found
 		checkResult.Debug = "no matching output found for query. creds used were " + username + ":" + password
 		response <- checkResult
@@ -160,6 +267,30 @@ func (c Sql) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
 }
 
+// compareRows describes the first difference between the rows a query should
+// return and the ones it did, or returns "" if they match. With useRegex each
+// expected value is a regex the returned value has to match.
+func compareRows(want, got [][]string, useRegex bool) string {
+	if len(got) != len(want) {
+		return fmt.Sprintf("query returned %d rows, wanted %d", len(got), len(want))
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			return fmt.Sprintf("row %d had %d columns, wanted %d", i+1, len(got[i]), len(want[i]))
+		}
+		for j, value := range want[i] {
+			matched := got[i][j] == value
+			if useRegex {
+				matched = regexp.MustCompile(value).MatchString(got[i][j])
+			}
+			if !matched {
+				return fmt.Sprintf("row %d column %d was %q, wanted %q", i+1, j+1, got[i][j], value)
+			}
+		}
+	}
+	return ""
+}
+
 func (c *Sql) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
 	if c.ServiceType == "" {
 		c.ServiceType = "Sql"
@@ -176,12 +307,40 @@ func (c *Sql) Verify(box string, ip string, points int, timeout int, slapenalty
 	if c.Kind == "" {
 		c.Kind = "mysql"
 	}
+	if c.Kind == "mssql" {
+		c.Kind = "sqlserver"
+	}
+	if _, ok := sqlPorts[c.Kind]; !ok {
+		return fmt.Errorf("unknown sql kind %q, use mysql, postgres or sqlserver", c.Kind)
+	}
 	if c.Port == 0 {
-		c.Port = 3306
+		c.Port = sqlPorts[c.Kind]
+	}
+	if c.Tls == "" {
+		c.Tls = "disable"
+	}
+	if !slices.Contains(sqlTlsModes, c.Tls) {
+		return fmt.Errorf("unknown sql tls mode %q, use %s", c.Tls, strings.Join(sqlTlsModes, ", "))
 	}
 	for _, q := range c.Query {
-		if q.UseRegex {
-			regexp.MustCompile(q.Output)
+		if q.Output != "" && len(q.Rows) > 0 {
+			return errors.New("sql query can check output or rows, not both")
+		}
+		if q.Column != "" && len(q.Rows) > 0 {
+			return errors.New("sql query column is only used with output")
+		}
+		if !q.UseRegex {
+			continue
+		}
+		if _, err := regexp.Compile(q.Output); err != nil {
+			return fmt.Errorf("invalid sql output regex %q: %w", q.Output, err)
+		}
+		for _, row := range q.Rows {
+			for _, value := range row {
+				if _, err := regexp.Compile(value); err != nil {
+					return fmt.Errorf("invalid sql rows regex %q: %w", value, err)
+				}
+			}
 		}
 	}
 	return nil
@@ -2,17 +2,23 @@ package checks
 
 import (
 	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"math/rand"
+	"net"
 	"os"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -21,15 +27,42 @@ type Ssh struct {
 	PrivKey     string `toml:",omitempty"`
 	BadAttempts int    `toml:",omitzero"`
 	Command     []commandData
+	File        []sshFile `toml:",omitempty"` // files checked over sftp
+	Write       bool      `toml:",omitempty"` // upload a file over sftp, download it and delete it
+	WriteDir    string    `toml:",omitempty"` // directory to upload the file to, the user's home if empty
+	PinHostKey  bool      `toml:",omitempty"` // fail if the host key isn't the one first seen for the team
+
+	pinnedKey string // host key learned on an earlier round, set by the runner
 }
 
 type commandData struct {
 	UseRegex bool
 	Contains bool
+	Exec     bool   `toml:",omitempty"` // run without a shell and wait for the exit status
+	ExitCode int    `toml:",omitempty"` // exit status an exec command has to return
 	Command  string `toml:",omitempty"`
 	Output   string `toml:",omitempty"`
 }
 
+type sshFile struct {
+	Name  string
+	Hash  string `toml:",omitempty"`
+	Regex string `toml:",omitempty"`
+}
+
+var errHostKeyChanged = errors.New("host key changed")
+
+// PinsHostKey reports whether the check wants the host key it first saw.
+func (c *Ssh) PinsHostKey() bool {
+	return c.PinHostKey
+}
+
+// SetPinnedHostKey sets the host key, in authorized_keys format, the server
+// has to present.
+func (c *Ssh) SetPinnedHostKey(key string) {
+	c.pinnedKey = key
+}
+
 func (c Ssh) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
 	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
 
@@ -42,13 +75,30 @@ func (c Ssh) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			return
 		}
 
+		var hostKey ssh.PublicKey
 		config := &ssh.ClientConfig{
-			User:            username,
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(), // #nosec G106 -- competition hosts have unknown keys
-			Timeout:         time.Duration(c.Timeout) * time.Second,
+			User: username,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				hostKey = key
+				if c.PinHostKey && c.pinnedKey != "" && c.pinnedKey != marshalHostKey(key) {
+					return errHostKeyChanged
+				}
+				return nil
+			},
+			Timeout: time.Duration(c.Timeout) * time.Second,
 		}
 		config.SetDefaults()
 		config.Ciphers = append(config.Ciphers, "3des-cbc")
+		if c.PinHostKey && c.pinnedKey != "" {
+			// ask for the pinned kind of key, so a server with several doesn't
+			// look like it changed
+			if pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.pinnedKey)); err == nil {
+				config.HostKeyAlgorithms = []string{pinned.Type()}
+				if pinned.Type() == ssh.KeyAlgoRSA {
+					config.HostKeyAlgorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+				}
+			}
+		}
 		if c.PrivKey != "" {
 			key, err := os.ReadFile("./config/scoredfiles/" + c.PrivKey)
 			if err != nil {
@@ -91,108 +141,345 @@ func (c Ssh) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			}
 		}
 
-		// Connect to ssh server
-		conn, err := ssh.Dial("tcp", c.Target+":"+strconv.Itoa(c.Port), config)
+		// Connect to ssh server, with a deadline so a stalled server can't
+		// hold the check past its timeout
+		addr := c.Target + ":" + strconv.Itoa(c.Port)
+		netConn, err := net.DialTimeout("tcp", addr, time.Duration(c.Timeout)*time.Second)
+		if err != nil {
+			checkResult.Error = "connection to ssh server failed"
+			checkResult.Debug = "error: " + err.Error()
+			response <- checkResult
+			return
+		}
+		if err := netConn.SetDeadline(time.Now().Add(time.Duration(c.Timeout) * time.Second)); err != nil {
+			checkResult.Error = "connection to ssh server failed"
+			checkResult.Debug = "error: " + err.Error()
+			response <- checkResult
+			return
+		}
+		clientConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+		if hostKey != nil && c.PinHostKey {
+			checkResult.HostKey = marshalHostKey(hostKey)
+		}
 		if err != nil {
-			if c.PrivKey != "" {
+			if err := netConn.Close(); err != nil {
+				slog.Debug("failed to close ssh connection", "error", err)
+			}
+			switch {
+			case errors.Is(err, errHostKeyChanged):
+				checkResult.Error = "host key changed"
+				checkResult.Debug = "server presented " + ssh.FingerprintSHA256(hostKey) + ", pinned key was " + pinnedFingerprint(c.pinnedKey)
+			case c.PinHostKey && c.pinnedKey != "" && strings.Contains(err.Error(), "no common algorithm for host key"):
+				checkResult.Error = "host key changed"
+				checkResult.Debug = "server no longer has a key like the pinned " + pinnedFingerprint(c.pinnedKey) + ": " + err.Error()
+			case c.PrivKey != "":
 				checkResult.Error = "error logging in to ssh server with private key " + c.PrivKey
 				checkResult.Debug = "error: " + err.Error()
-			} else {
+			default:
 				checkResult.Error = "error logging in to ssh server for creds " + username + ":" + password
 				checkResult.Debug = "error: " + err.Error()
 			}
 			response <- checkResult
 			return
 		}
+		conn := ssh.NewClient(clientConn, chans, reqs)
 		defer func() {
-		if err := conn.Close(); err != nil {
-			slog.Error("failed to close ssh connection", "error", err)
-		}
-	}()
+			if err := conn.Close(); err != nil {
+				slog.Debug("failed to close ssh connection", "error", err)
+			}
+		}()
 
-		// Create a session
-		session, err := conn.NewSession()
-		if err != nil {
-			checkResult.Error = "unable to create ssh session"
-			checkResult.Debug = err.Error()
+		// If any commands specified, run a random one
+		var cmd *commandData
+		if len(c.Command) > 0 {
+			cmd = &c.Command[rand.Intn(len(c.Command))] // #nosec G404 -- non-crypto selection of command to test
+		}
+		// without commands the shell still has to start, unless the check is
+		// only about sftp, which servers can allow without a shell
+		sftpOnly := cmd == nil && (c.Write || len(c.File) > 0)
+		if cmd != nil && cmd.Exec {
+			if !c.runExec(conn, cmd, &checkResult) {
+				response <- checkResult
+				return
+			}
+		} else if !sftpOnly && !c.runShell(conn, cmd, &checkResult) {
 			response <- checkResult
 			return
 		}
-		defer session.Close()
 
-		// Set up terminal modes
-		modes := ssh.TerminalModes{
-			ssh.ECHO:          0,     // disable echoing
-			ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
-			ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+		if c.Write || len(c.File) > 0 {
+			if !c.checkSftp(conn, &checkResult) {
+				checkResult.Debug += ", creds " + username + ":" + password
+				response <- checkResult
+				return
+			}
 		}
 
-		// Request pseudo terminal
-		if err := session.RequestPty("xterm", 40, 80, modes); err != nil {
-			checkResult.Error = "couldn't allocate pts"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
+		checkResult.Status = true
+		checkResult.Points = c.Points
+		checkResult.Debug = "creds used were " + username + ":" + password
+		response <- checkResult
+	}
+
+	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+}
+
+// runShell starts a shell in a pty and, if there's a command, types it in and
+// checks what it printed. It fills in checkResult and returns false if
+// anything failed.
+func (c Ssh) runShell(conn *ssh.Client, cmd *commandData, checkResult *Result) bool {
+	// Create a session
+	session, err := conn.NewSession()
+	if err != nil {
+		checkResult.Error = "unable to create ssh session"
+		checkResult.Debug = err.Error()
+		return false
+	}
+	defer session.Close()
+
+	// Set up terminal modes
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,     // disable echoing
+		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
+		ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+	}
+
+	// Request pseudo terminal
+	if err := session.RequestPty("xterm", 40, 80, modes); err != nil {
+		checkResult.Error = "couldn't allocate pts"
+		checkResult.Debug = err.Error()
+		return false
+	}
+
+	// I/O for shell
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		checkResult.Error = "couldn't get stdin pipe"
+		checkResult.Debug = err.Error()
+		return false
+	}
+
+	var stdoutBytes bytes.Buffer
+	var stderrBytes bytes.Buffer
+	session.Stdout = &stdoutBytes
+	session.Stderr = &stderrBytes
+
+	// Start remote shell
+	if err := session.Shell(); err != nil {
+		checkResult.Error = "failed to start shell"
+		checkResult.Debug = "error: " + err.Error()
+		return false
+	}
+
+	if cmd == nil {
+		return true
+	}
+
+	fmt.Fprintln(stdin, cmd.Command)
+	time.Sleep(time.Duration(int(time.Duration(c.Timeout)*time.Second) / 8)) // command wait time
+	if cmd.Contains {
+		if !strings.Contains(stdoutBytes.String(), cmd.Output) {
+			checkResult.Error = "command output didn't contain string"
+			checkResult.Debug = "command output of '" + cmd.Command + "' didn't contain string '" + cmd.Output + "': " + stdoutBytes.String() + ",  " + stderrBytes.String()
+			return false
+		}
+	} else if cmd.UseRegex {
+		re := regexp.MustCompile(cmd.Output)
+		if !re.Match(stdoutBytes.Bytes()) {
+			checkResult.Error = "command output didn't match regex"
+			checkResult.Debug = "command output'" + cmd.Command + "' didn't match regex '" + cmd.Output
+			return false
+		}
+	} else {
+		if stderrBytes.Len() != 0 {
+			checkResult.Error = "command returned an error"
+			checkResult.Debug = "command stderr was not empty: " + stderrBytes.String()
+			return false
 		}
+	}
+	return true
+}
 
-		// I/O for shell
-		stdin, err := session.StdinPipe()
-		if err != nil {
-			checkResult.Error = "couldn't get stdin pipe"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
+// runExec runs a command without a pty and waits for it to exit, then checks
+// its exit status and output.
+func (c Ssh) runExec(conn *ssh.Client, cmd *commandData, checkResult *Result) bool {
+	session, err := conn.NewSession()
+	if err != nil {
+		checkResult.Error = "unable to create ssh session"
+		checkResult.Debug = err.Error()
+		return false
+	}
+	defer session.Close()
+
+	var stdoutBytes bytes.Buffer
+	var stderrBytes bytes.Buffer
+	session.Stdout = &stdoutBytes
+	session.Stderr = &stderrBytes
+
+	exitCode := 0
+	if err := session.Run(cmd.Command); err != nil {
+		var exitErr *ssh.ExitError
+		if !errors.As(err, &exitErr) {
+			checkResult.Error = "command failed to run"
+			checkResult.Debug = "command '" + cmd.Command + "': " + err.Error()
+			return false
 		}
+		exitCode = exitErr.ExitStatus()
+	}
+	if exitCode != cmd.ExitCode {
+		checkResult.Error = "command exited with the wrong status"
+		checkResult.Debug = fmt.Sprintf("command '%s' exited with %d, wanted %d: %s, %s", cmd.Command, exitCode, cmd.ExitCode, stdoutBytes.String(), stderrBytes.String())
+		return false
+	}
 
-		var stdoutBytes bytes.Buffer
-		var stderrBytes bytes.Buffer
-		session.Stdout = &stdoutBytes
-		session.Stderr = &stderrBytes
+	if cmd.Contains {
+		if !strings.Contains(stdoutBytes.String(), cmd.Output) {
+			checkResult.Error = "command output didn't contain string"
+			checkResult.Debug = "command output of '" + cmd.Command + "' didn't contain string '" + cmd.Output + "': " + stdoutBytes.String() + ",  " + stderrBytes.String()
+			return false
+		}
+	} else if cmd.UseRegex {
+		re := regexp.MustCompile(cmd.Output)
+		if !re.Match(stdoutBytes.Bytes()) {
+			checkResult.Error = "command output didn't match regex"
+			checkResult.Debug = "command output'" + cmd.Command + "' didn't match regex '" + cmd.Output
+			return false
+		}
+	}
+	return true
+}
 
-		// Start remote shell
-		if err := session.Shell(); err != nil {
-			checkResult.Error = "failed to start shell"
-			checkResult.Debug = "error: " + err.Error()
-			response <- checkResult
-			return
+// checkSftp uploads, downloads and deletes a probe file if the check writes,
+// then checks one of its files.
+func (c Ssh) checkSftp(conn *ssh.Client, checkResult *Result) bool {
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		checkResult.Error = "couldn't start sftp"
+		checkResult.Debug = err.Error()
+		return false
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Debug("failed to close sftp client", "error", err)
 		}
+	}()
 
-		// If any commands specified, run a random one
-		if len(c.Command) > 0 {
-			r := c.Command[rand.Intn(len(c.Command))] // #nosec G404 -- non-crypto selection of command to test
-			fmt.Fprintln(stdin, r.Command)
-			time.Sleep(time.Duration(int(time.Duration(c.Timeout)*time.Second) / 8)) // command wait time
-			if r.Contains {
-				if !strings.Contains(stdoutBytes.String(), r.Output) {
-					checkResult.Error = "command output didn't contain string"
-					checkResult.Debug = "command output of '" + r.Command + "' didn't contain string '" + r.Output + "': " + stdoutBytes.String() + ",  " + stderrBytes.String()
-					response <- checkResult
-					return
-				}
-			} else if r.UseRegex {
-				re := regexp.MustCompile(r.Output)
-				if !re.Match(stdoutBytes.Bytes()) {
-					checkResult.Error = "command output didn't match regex"
-					checkResult.Debug = "command output'" + r.Command + "' didn't match regex '" + r.Output
-					response <- checkResult
-					return
-				}
-			} else {
-				if stderrBytes.Len() != 0 {
-					checkResult.Error = "command returned an error"
-					checkResult.Debug = "command stderr was not empty: " + stderrBytes.String()
-					response <- checkResult
-					return
-				}
+	if c.Write {
+		// random name and content so a stale or faked file can't pass
+		token := make([]byte, 16)
+		if _, err := crand.Read(token); err != nil {
+			checkResult.Error = "error generating test file"
+			checkResult.Debug = err.Error()
+			return false
+		}
+		name := path.Join(c.WriteDir, "quotient-"+hex.EncodeToString(token[:4])+".txt")
+		content := []byte("quotient sftp write check " + hex.EncodeToString(token) + "\n")
+
+		if err := writeSftpFile(client, name, content); err != nil {
+			checkResult.Error = "failed to upload file"
+			checkResult.Debug = "file " + name + " (" + err.Error() + ")"
+			return false
+		}
+		// don't leave the file behind if downloading it fails
+		removed := false
+		defer func() {
+			if removed {
+				return
+			}
+			if err := client.Remove(name); err != nil {
+				slog.Debug("failed to delete sftp test file", "file", name, "error", err)
 			}
+		}()
+		readBack, err := readSftpFile(client, name)
+		if err != nil {
+			checkResult.Error = "failed to download uploaded file"
+			checkResult.Debug = "file " + name + " (" + err.Error() + ")"
+			return false
 		}
-		checkResult.Status = true
-		checkResult.Points = c.Points
-		checkResult.Debug = "creds used were " + username + ":" + password
-		response <- checkResult
+		if !bytes.Equal(readBack, content) {
+			checkResult.Error = "uploaded file didn't match when downloaded"
+			checkResult.Debug = "file " + name
+			return false
+		}
+		if err := client.Remove(name); err != nil {
+			checkResult.Error = "failed to delete uploaded file"
+			checkResult.Debug = "file " + name + " (" + err.Error() + ")"
+			return false
+		}
+		removed = true
 	}
 
-	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
+	if len(c.File) == 0 {
+		return true
+	}
+
+	file := c.File[rand.Intn(len(c.File))] // #nosec G404 -- non-crypto selection of file to test
+	buf, err := readSftpFile(client, file.Name)
+	if err != nil {
+		checkResult.Error = "failed to read file"
+		checkResult.Debug = "file was " + file.Name + " (" + err.Error() + ")"
+		return false
+	}
+	if file.Regex != "" {
+		re := regexp.MustCompile(file.Regex)
+		if re.Find(buf) == nil {
+			checkResult.Error = "couldn't find regex in file"
+			checkResult.Debug = "couldn't find regex \"" + file.Regex + "\" for " + file.Name
+			return false
+		}
+	}
+	if file.Hash != "" {
+		fileHash, err := StringHash(string(buf))
+		if err != nil {
+			checkResult.Error = "error calculating file hash"
+			checkResult.Debug = "file " + file.Name + ", " + err.Error()
+			return false
+		}
+		if fileHash != file.Hash {
+			checkResult.Error = "file hash did not match"
+			checkResult.Debug = "file " + file.Name + " hash " + fileHash + " did not match specified hash " + file.Hash
+			return false
+		}
+	}
+	return true
+}
+
+func writeSftpFile(client *sftp.Client, name string, content []byte) error {
+	f, err := client.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readSftpFile(client *sftp.Client, name string) ([]byte, error) {
+	f, err := client.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			slog.Debug("failed to close sftp file", "error", err)
+		}
+	}()
+	return io.ReadAll(f)
+}
+
+// marshalHostKey formats a host key the way it's pinned
+func marshalHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func pinnedFingerprint(pinned string) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+	if err != nil {
+		return "unparseable"
+	}
+	return ssh.FingerprintSHA256(key)
 }
 
 func (c *Ssh) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
@@ -216,12 +503,27 @@ func (c *Ssh) Verify(box string, ip string, points int, timeout int, slapenalty
 	}
 	for _, r := range c.Command {
 		if r.UseRegex {
-			regexp.MustCompile(r.Output)
+			if _, err := regexp.Compile(r.Output); err != nil {
+				return fmt.Errorf("invalid ssh command output regex %q: %w", r.Output, err)
+			}
 		}
-		if r.UseRegex {
-			regexp.MustCompile(r.Output)
+		if r.ExitCode != 0 && !r.Exec {
+			return errors.New("ssh command exitcode is only checked for exec commands")
+		}
+	}
+	for _, f := range c.File {
+		if f.Name == "" {
+			return errors.New("ssh file needs a name")
+		}
+		if f.Regex != "" {
+			if _, err := regexp.Compile(f.Regex); err != nil {
+				return fmt.Errorf("invalid ssh file regex %q: %w", f.Regex, err)
+			}
 		}
 	}
+	if c.WriteDir != "" && !c.Write {
+		return errors.New("ssh writedir is only used with write")
+	}
 
 	return nil
 }
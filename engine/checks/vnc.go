@@ -1,50 +1,97 @@
 package checks
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/jpeg" // reference thumbnails can be jpegs
+	_ "image/png"
+	"io"
 	"log/slog"
+	"math/bits"
 	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/go-vnc"
 )
 
 type Vnc struct {
 	Service
+	Security      string `toml:",omitempty"` // "vnc" (password), "none" or "vencrypt"
+	NonBlank      bool   `toml:",omitempty"` // fail if every pixel on the screen is the same color
+	Thumbnail     string `toml:",omitempty"` // an image in config/scoredfiles the screen has to look like
+	MaxDifference int    `toml:",omitempty"` // how many of the 64 thumbnail hash bits can differ
 }
 
+// VeNCrypt security type and the X.509 sub-types. The anonymous TLS sub-types
+// need anonymous Diffie-Hellman, which Go's TLS doesn't do.
+const (
+	vncSecurityVeNCrypt = 19
+	vencryptX509None    = 260
+	vencryptX509Vnc     = 261
+	vencryptX509Plain   = 262
+)
+
 func (c Vnc) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
 	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		// leave a second before the check times out to report a missing framebuffer
+		deadline := time.Now().Add(time.Duration(c.Timeout)*time.Second - time.Second)
 
 		// Configure the vnc client
-		username, password, err := c.getCreds(teamID)
-		if err != nil {
-			checkResult.Error = "error getting creds"
-			checkResult.Debug = err.Error()
-			response <- checkResult
-			return
-		}
-
-		config := vnc.ClientConfig{
-			Auth: []vnc.ClientAuth{
-				&vnc.PasswordAuth{Password: password},
-			},
+		var username, password string
+		if c.Security != "none" {
+			var err error
+			username, password, err = c.getCreds(teamID)
+			if err != nil {
+				checkResult.Error = "error getting creds"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
 		}
 
 		// Dial the vnc server
 		dialer := net.Dialer{}
-		conn, err := dialer.DialContext(context.TODO(), "tcp", fmt.Sprintf("%s:%d", c.Target, c.Port))
+		tcpConn, err := dialer.DialContext(context.TODO(), "tcp", fmt.Sprintf("%s:%d", c.Target, c.Port))
 		if err != nil {
 			checkResult.Error = "connection to vnc server failed"
 			checkResult.Debug = err.Error() + " for creds " + username + ":" + password
 			response <- checkResult
 			return
 		}
+		if err := tcpConn.SetDeadline(deadline); err != nil {
+			slog.Error("failed to set vnc deadline", "error", err)
+		}
+		conn := &vncConn{Conn: tcpConn, r: bufio.NewReader(tcpConn)}
 		defer func() {
-		if err := conn.Close(); err != nil {
-			slog.Error("failed to close vnc connection", "error", err)
+			if err := conn.Close(); err != nil {
+				slog.Debug("failed to close vnc connection", "error", err)
+			}
+		}()
+
+		var auth vnc.ClientAuth
+		switch c.Security {
+		case "none":
+			auth = new(vnc.ClientAuthNone)
+		case "vencrypt":
+			auth = &vencryptAuth{conn: conn, serverName: c.Target, username: username, password: password}
+		default:
+			auth = &vnc.PasswordAuth{Password: password}
+		}
+		// the main loop stops once the connection closes, the buffer keeps it
+		// from blocking on a message nobody reads until then
+		messages := make(chan vnc.ServerMessage, 16)
+		config := vnc.ClientConfig{
+			Auth:            []vnc.ClientAuth{auth},
+			ServerMessageCh: messages,
 		}
-	}()
 
 		vncClient, err := vnc.Client(conn, &config)
 		if err != nil {
@@ -53,20 +100,248 @@ func (c Vnc) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			response <- checkResult
 			return
 		}
-		defer func() {
-		if err := vncClient.Close(); err != nil {
-			slog.Error("failed to close vnc client", "error", err)
+
+		width, height := int(vncClient.FrameBufferWidth), int(vncClient.FrameBufferHeight)
+		screen, err := readFramebuffer(vncClient, messages, deadline)
+		if err != nil {
+			checkResult.Error = "no framebuffer update"
+			checkResult.Debug = fmt.Sprintf("%dx%d desktop %q didn't send its screen: %s", width, height, vncClient.DesktopName, err)
+			response <- checkResult
+			return
+		}
+
+		if c.NonBlank && !slices.ContainsFunc(screen, func(p vnc.Color) bool { return p != screen[0] }) {
+			checkResult.Error = "screen is blank"
+			checkResult.Debug = fmt.Sprintf("every pixel of the %dx%d screen is %v", width, height, screen[0])
+			response <- checkResult
+			return
+		}
+
+		pf := vncClient.PixelFormat
+		hash := thumbnailHash(width, height, func(x, y int) (float64, float64, float64) {
+			p := screen[y*width+x]
+			if !pf.TrueColor {
+				// color map entries are 16 bit
+				return float64(p.R) / 65535, float64(p.G) / 65535, float64(p.B) / 65535
+			}
+			return float64(p.R) / float64(pf.RedMax), float64(p.G) / float64(pf.GreenMax), float64(p.B) / float64(pf.BlueMax)
+		})
+		if c.Thumbnail != "" {
+			want, err := imageThumbnailHash(c.Thumbnail)
+			if err != nil {
+				checkResult.Error = "failed to read thumbnail"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+			if diff := bits.OnesCount64(hash ^ want); diff > c.MaxDifference {
+				checkResult.Error = "screen doesn't match the thumbnail"
+				checkResult.Debug = fmt.Sprintf("screen hash %016x differs from %s's %016x in %d bits, %d allowed", hash, c.Thumbnail, want, diff, c.MaxDifference)
+				response <- checkResult
+				return
+			}
 		}
-	}()
 
 		checkResult.Status = true
-		checkResult.Debug = "creds " + username + ":" + password
+		checkResult.Debug = fmt.Sprintf("creds %s:%s, %dx%d desktop %q, screen hash %016x", username, password, width, height, vncClient.DesktopName, hash)
 		response <- checkResult
 	}
 
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
 }
 
+// readFramebuffer asks for the whole screen and collects updates until every
+// pixel has been sent
+func readFramebuffer(vncClient *vnc.ClientConn, messages chan vnc.ServerMessage, deadline time.Time) ([]vnc.Color, error) {
+	width, height := int(vncClient.FrameBufferWidth), int(vncClient.FrameBufferHeight)
+	if width == 0 || height == 0 {
+		return nil, errors.New("framebuffer is empty")
+	}
+	if err := vncClient.FramebufferUpdateRequest(false, 0, 0, uint16(width), uint16(height)); err != nil {
+		return nil, err
+	}
+
+	screen := make([]vnc.Color, width*height)
+	seen := make([]bool, width*height)
+	missing := width * height
+	timeout := time.After(time.Until(deadline))
+	for missing > 0 {
+		var msg vnc.ServerMessage
+		select {
+		case msg = <-messages:
+		case <-timeout:
+			return nil, fmt.Errorf("%d of %d pixels were sent before the timeout", width*height-missing, width*height)
+		}
+		update, ok := msg.(*vnc.FramebufferUpdateMessage)
+		if !ok {
+			continue
+		}
+		for _, rect := range update.Rectangles {
+			raw, ok := rect.Enc.(*vnc.RawEncoding)
+			if !ok {
+				continue
+			}
+			for y := range int(rect.Height) {
+				for x := range int(rect.Width) {
+					sx, sy := int(rect.X)+x, int(rect.Y)+y
+					if sx >= width || sy >= height {
+						continue
+					}
+					screen[sy*width+sx] = raw.Colors[y*int(rect.Width)+x]
+					if !seen[sy*width+sx] {
+						seen[sy*width+sx] = true
+						missing--
+					}
+				}
+			}
+		}
+	}
+	return screen, nil
+}
+
+// thumbnailHash is a 64 bit average hash of an image: it's shrunk to 8x8 grey
+// pixels, and each bit is whether a pixel is brighter than the average. Small
+// changes, like the clock ticking over, flip few or no bits.
+func thumbnailHash(width, height int, pixel func(x, y int) (r, g, b float64)) uint64 {
+	var grey [64]float64
+	var total float64
+	for ty := range 8 {
+		y0, y1 := ty*height/8, max((ty+1)*height/8, ty*height/8+1)
+		for tx := range 8 {
+			x0, x1 := tx*width/8, max((tx+1)*width/8, tx*width/8+1)
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b := pixel(x, y)
+					sum += 0.299*r + 0.587*g + 0.114*b
+				}
+			}
+			grey[ty*8+tx] = sum / float64((y1-y0)*(x1-x0))
+			total += grey[ty*8+tx]
+		}
+	}
+
+	var hash uint64
+	for i, v := range grey {
+		if v > total/64 {
+			hash |= 1 << (63 - i)
+		}
+	}
+	return hash
+}
+
+// imageThumbnailHash hashes a reference image in config/scoredfiles
+func imageThumbnailHash(fileName string) (uint64, error) {
+	content, err := GetFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	img, _, err := image.Decode(strings.NewReader(content))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %w", fileName, err)
+	}
+	bounds := img.Bounds()
+	return thumbnailHash(bounds.Dx(), bounds.Dy(), func(x, y int) (float64, float64, float64) {
+		r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+		return float64(r) / 65535, float64(g) / 65535, float64(b) / 65535
+	}), nil
+}
+
+// vncConn buffers reads, since go-vnc reads raw framebuffers a pixel at a
+// time, and lets the VeNCrypt handshake swap in a TLS connection
+type vncConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *vncConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// vencryptAuth does the VeNCrypt handshake with one of the X.509 sub-types,
+// then authenticates inside the TLS connection
+type vencryptAuth struct {
+	conn       *vncConn
+	serverName string
+	username   string
+	password   string
+}
+
+func (a *vencryptAuth) SecurityType() uint8 {
+	return vncSecurityVeNCrypt
+}
+
+func (a *vencryptAuth) Handshake(net.Conn) error {
+	var version [2]uint8
+	if _, err := io.ReadFull(a.conn, version[:]); err != nil {
+		return err
+	}
+	if version[0] != 0 || version[1] < 2 {
+		return fmt.Errorf("unsupported vencrypt version %d.%d", version[0], version[1])
+	}
+	if _, err := a.conn.Write([]byte{0, 2}); err != nil {
+		return err
+	}
+	var status [1]uint8
+	if _, err := io.ReadFull(a.conn, status[:]); err != nil {
+		return err
+	}
+	if status[0] != 0 {
+		return errors.New("server refused vencrypt version 0.2")
+	}
+
+	var count uint8
+	if err := binary.Read(a.conn, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	subTypes := make([]uint32, count)
+	if err := binary.Read(a.conn, binary.BigEndian, subTypes); err != nil {
+		return err
+	}
+	var subType uint32
+	for _, t := range []uint32{vencryptX509Plain, vencryptX509Vnc, vencryptX509None} {
+		if slices.Contains(subTypes, t) {
+			subType = t
+			break
+		}
+	}
+	if subType == 0 {
+		return fmt.Errorf("no supported vencrypt sub-type, server offered %v", subTypes)
+	}
+	if err := binary.Write(a.conn, binary.BigEndian, subType); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(a.conn, status[:]); err != nil {
+		return err
+	}
+	if status[0] != 1 {
+		return fmt.Errorf("server refused vencrypt sub-type %d", subType)
+	}
+
+	tlsConn := tls.Client(a.conn.Conn, &tls.Config{
+		InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+		ServerName:         a.serverName,
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("vencrypt tls handshake failed: %w", err)
+	}
+	a.conn.Conn = tlsConn
+	a.conn.r = bufio.NewReader(tlsConn)
+
+	switch subType {
+	case vencryptX509Plain:
+		msg := binary.BigEndian.AppendUint32(nil, uint32(len(a.username)))
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(a.password)))
+		msg = append(msg, a.username...)
+		msg = append(msg, a.password...)
+		_, err := a.conn.Write(msg)
+		return err
+	case vencryptX509Vnc:
+		return (&vnc.PasswordAuth{Password: a.password}).Handshake(a.conn)
+	}
+	return nil
+}
+
 func (c *Vnc) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
 	if c.ServiceType == "" {
 		c.ServiceType = "Vnc"
@@ -83,6 +358,21 @@ func (c *Vnc) Verify(box string, ip string, points int, timeout int, slapenalty
 	if c.Port == 0 {
 		c.Port = 5900
 	}
+	if c.Security == "" {
+		c.Security = "vnc"
+	}
+	if c.Security != "vnc" && c.Security != "none" && c.Security != "vencrypt" {
+		return fmt.Errorf("unknown vnc security %q, use vnc, none or vencrypt", c.Security)
+	}
+	if c.Thumbnail != "" && !filepath.IsLocal(c.Thumbnail) {
+		return fmt.Errorf("thumbnail %q must be a path inside config/scoredfiles", c.Thumbnail)
+	}
+	if c.MaxDifference < 0 || c.MaxDifference > 64 {
+		return errors.New("vnc maxdifference is a number of bits between 0 and 64")
+	}
+	if c.MaxDifference != 0 && c.Thumbnail == "" {
+		return errors.New("vnc maxdifference is only used with a thumbnail")
+	}
 
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"math/rand"
 	"net/http"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,19 +20,25 @@ import (
 type Web struct {
 	Service
 	Url    []urlData
+	Step   []webStep `toml:",omitempty"` // a scripted flow, run instead of checking one of the urls
 	Scheme string
 }
 
 type urlData struct {
 	Path        string
 	Status      int    `toml:",omitempty"`
-	Diff        int    `toml:",omitempty"`
+	Diff        int    `toml:",omitempty"` // how different from CompareFile the page can be, as a percentage
 	Regex       string `toml:",omitempty"`
-	CompareFile string `toml:",omitempty"` // TODO implement
+	CompareFile string `toml:",omitempty"` // a file in config/scoredfiles the page is compared against
 }
 
 func (c Web) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
 	definition := func(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+		if len(c.Step) > 0 {
+			c.runSteps(teamID, teamIdentifier, checkResult, response)
+			return
+		}
+
 		u := c.Url[rand.Intn(len(c.Url))] // #nosec G404 -- non-crypto selection of URL to test
 
 		// random user agent
@@ -98,26 +105,50 @@ func (c Web) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan c
 			return
 		}
 
+		var re *regexp.Regexp
 		if u.Regex != "" {
-			re, err := regexp.Compile(u.Regex)
+			re, err = regexp.Compile(u.Regex)
 			if err != nil {
 				checkResult.Error = "error compiling regex to match for web page"
 				checkResult.Debug = err.Error()
 				response <- checkResult
 				return
 			}
+		}
+
+		if c.Ownership {
+			checkResult.Owner = ownerToken(body, re)
+		}
+
+		if re != nil {
 			reFind := re.Find(body)
 			if reFind == nil {
 				checkResult.Error = "didn't find regex on page"
 				checkResult.Debug = "couldn't find regex \"" + u.Regex + "\" for " + u.Path
 				response <- checkResult
 				return
-			} else {
-				checkResult.Status = true
-				checkResult.Debug = "matched regex \"" + u.Regex + "\" for " + u.Path
+			}
+			checkResult.Debug = "matched regex \"" + u.Regex + "\" for " + u.Path
+		}
+
+		if u.CompareFile != "" {
+			diff, err := FileDifference(u.CompareFile, string(body))
+			if err != nil {
+				checkResult.Error = "error reading compare file"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+			if diff > u.Diff {
+				checkResult.Error = "page didn't match the compare file"
+				checkResult.Debug = fmt.Sprintf("%s was %d%% different from %s, allowed %d%%", u.Path, diff, u.CompareFile, u.Diff)
+				if excerpt, err := DiffExcerpt(u.CompareFile, string(body)); err == nil {
+					checkResult.Debug += "\n" + excerpt
+				}
 				response <- checkResult
 				return
 			}
+			checkResult.Debug = fmt.Sprintf("%s was %d%% different from %s, allowed %d%%", u.Path, diff, u.CompareFile, u.Diff)
 		}
 
 		checkResult.Status = true
@@ -151,16 +182,29 @@ func (c *Web) Verify(box string, ip string, points int, timeout int, slapenalty
 			c.Port = 80
 		}
 	}
-	if len(c.Url) == 0 {
-		return errors.New("no urls defined")
+	if len(c.Url) == 0 && len(c.Step) == 0 {
+		return errors.New("no urls defined, a web check needs urls or steps")
+	}
+	if len(c.Url) > 0 && len(c.Step) > 0 {
+		return errors.New("web check can have urls or steps, not both")
+	}
+	if err := c.verifySteps(); err != nil {
+		return err
 	}
 	if c.Scheme == "" {
 		c.Scheme = "http"
 	}
-	for _, u := range c.Url {
+	for i := range c.Url {
+		u := &c.Url[i]
 		if u.Diff != 0 && u.CompareFile == "" {
 			return errors.New("need compare file for diff in web")
 		}
+		if u.Diff < 0 || u.Diff > 100 {
+			return fmt.Errorf("diff for %s must be a percentage between 0 and 100", u.Path)
+		}
+		if u.CompareFile != "" && !filepath.IsLocal(u.CompareFile) {
+			return fmt.Errorf("compare file %q must be a path inside config/scoredfiles", u.CompareFile)
+		}
 		if u.Path == "" {
 			u.Path = "/"
 		}
@@ -0,0 +1,544 @@
+package checks
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/corpix/uarand"
+	"golang.org/x/net/html"
+)
+
+// maxStepBody caps how much of each response a scripted web check reads
+const maxStepBody = 10 << 20
+
+// webStep is one request in a scripted web check. Steps share a cookie jar and
+// variables, so a later step can use a session or token from an earlier one.
+type webStep struct {
+	Name       string            `toml:",omitempty"`
+	Method     string            `toml:",omitempty"`
+	Path       string            `toml:",omitempty"`
+	Headers    map[string]string `toml:",omitempty"`
+	Body       string            `toml:",omitempty"`
+	Form       map[string]string `toml:",omitempty"` // sent url encoded, instead of Body
+	Status     int               `toml:",omitempty"`
+	NoRedirect bool              `toml:",omitempty"` // check the redirect itself instead of following it
+	Extract    []webExtract      `toml:",omitempty"`
+	Assert     []webAssert       `toml:",omitempty"`
+}
+
+// webSelector picks a value out of a response. With nothing set it's the whole body.
+type webSelector struct {
+	Regex    string `toml:",omitempty"` // the first capture group, or the whole match
+	JSONPath string `toml:",omitempty"` // like $.user.name or $.items[0].id
+	CSS      string `toml:",omitempty"` // the text of the first matching element
+	Attr     string `toml:",omitempty"` // with CSS, an attribute of the element instead of its text
+	Header   string `toml:",omitempty"`
+}
+
+// webExtract saves a value from a response into a variable for later steps
+type webExtract struct {
+	Var string
+	webSelector
+}
+
+// webAssert fails the check unless the selected value is found and matches
+type webAssert struct {
+	webSelector
+	Equals   string `toml:",omitempty"`
+	Contains string `toml:",omitempty"`
+	Absent   bool   `toml:",omitempty"` // the selector must not match at all
+}
+
+var (
+	stepVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+	validVarName = regexp.MustCompile(`^\w+$`)
+	stepMethods  = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+)
+
+// expandVars replaces {{name}} with the variable's value
+func expandVars(s string, vars map[string]string) string {
+	return stepVariable.ReplaceAllStringFunc(s, func(m string) string {
+		return vars[stepVariable.FindStringSubmatch(m)[1]]
+	})
+}
+
+func (s webSelector) String() string {
+	switch {
+	case s.Regex != "":
+		return fmt.Sprintf("regex %q", s.Regex)
+	case s.JSONPath != "":
+		return "jsonpath " + s.JSONPath
+	case s.CSS != "" && s.Attr != "":
+		return fmt.Sprintf("css %s [%s]", s.CSS, s.Attr)
+	case s.CSS != "":
+		return "css " + s.CSS
+	case s.Header != "":
+		return "header " + s.Header
+	}
+	return "body"
+}
+
+func (s webSelector) verify() error {
+	set := 0
+	for _, v := range []string{s.Regex, s.JSONPath, s.CSS, s.Header} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of regex, jsonpath, css or header can be used")
+	}
+	if s.Attr != "" && s.CSS == "" {
+		return errors.New("attr needs a css selector")
+	}
+	if s.Regex != "" {
+		if _, err := regexp.Compile(s.Regex); err != nil {
+			return err
+		}
+	}
+	if s.JSONPath != "" {
+		if _, err := parseJSONPath(s.JSONPath); err != nil {
+			return err
+		}
+	}
+	if s.CSS != "" {
+		if _, err := cascadia.Compile(s.CSS); err != nil {
+			return fmt.Errorf("invalid css selector %q: %w", s.CSS, err)
+		}
+	}
+	return nil
+}
+
+// find returns the selected value and whether the response had it
+func (s webSelector) find(resp *http.Response, body []byte) (string, bool, error) {
+	switch {
+	case s.Regex != "":
+		re, err := regexp.Compile(s.Regex)
+		if err != nil {
+			return "", false, err
+		}
+		match := re.FindSubmatch(body)
+		if match == nil {
+			return "", false, nil
+		}
+		if len(match) > 1 {
+			return string(match[1]), true, nil
+		}
+		return string(match[0]), true, nil
+
+	case s.JSONPath != "":
+		path, err := parseJSONPath(s.JSONPath)
+		if err != nil {
+			return "", false, err
+		}
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return "", false, fmt.Errorf("response isn't json: %w", err)
+		}
+		return walkJSONPath(data, path)
+
+	case s.CSS != "":
+		sel, err := cascadia.Compile(s.CSS)
+		if err != nil {
+			return "", false, err
+		}
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			return "", false, fmt.Errorf("response isn't html: %w", err)
+		}
+		node := sel.MatchFirst(doc)
+		if node == nil {
+			return "", false, nil
+		}
+		if s.Attr != "" {
+			for _, attr := range node.Attr {
+				if attr.Key == s.Attr {
+					return attr.Val, true, nil
+				}
+			}
+			return "", false, nil
+		}
+		return strings.TrimSpace(nodeText(node)), true, nil
+
+	case s.Header != "":
+		values := resp.Header.Values(s.Header)
+		if len(values) == 0 {
+			return "", false, nil
+		}
+		return strings.Join(values, ", "), true, nil
+	}
+	return string(body), true, nil
+}
+
+// nodeText joins the text inside an html node
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(nodeText(child))
+	}
+	return sb.String()
+}
+
+// parseJSONPath splits a simple JSONPath, like $.items[0].name or $["a key"],
+// into object keys (strings) and array indexes (ints)
+func parseJSONPath(path string) ([]any, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", path)
+	}
+
+	parts := []any{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in jsonpath %q", path)
+			}
+			parts = append(parts, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed [ in jsonpath %q", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				parts = append(parts, inner[1:len(inner)-1])
+			} else if n, err := strconv.Atoi(inner); err == nil {
+				parts = append(parts, n)
+			} else {
+				return nil, fmt.Errorf("invalid index %q in jsonpath %q", inner, path)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in jsonpath %q", rest[0], path)
+		}
+	}
+	return parts, nil
+}
+
+// walkJSONPath follows a parsed path through decoded json. Negative indexes
+// count from the end of an array.
+func walkJSONPath(data any, path []any) (string, bool, error) {
+	for _, part := range path {
+		switch p := part.(type) {
+		case string:
+			obj, ok := data.(map[string]any)
+			if !ok {
+				return "", false, nil
+			}
+			if data, ok = obj[p]; !ok {
+				return "", false, nil
+			}
+		case int:
+			arr, ok := data.([]any)
+			if !ok {
+				return "", false, nil
+			}
+			if p < 0 {
+				p += len(arr)
+			}
+			if p < 0 || p >= len(arr) {
+				return "", false, nil
+			}
+			data = arr[p]
+		}
+	}
+
+	switch v := data.(type) {
+	case string:
+		return v, true, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true, nil
+	case bool:
+		return strconv.FormatBool(v), true, nil
+	case nil:
+		return "null", true, nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", false, err
+	}
+	return string(encoded), true, nil
+}
+
+// verifySteps fills in step defaults and checks every variable a step uses is
+// set by then
+func (c *Web) verifySteps() error {
+	defined := map[string]bool{"team": true}
+	if len(c.CredLists) > 0 {
+		defined["username"] = true
+		defined["password"] = true
+	}
+	checkVars := func(label string, fields ...string) error {
+		for _, field := range fields {
+			for _, m := range stepVariable.FindAllStringSubmatch(field, -1) {
+				if !defined[m[1]] {
+					if m[1] == "username" || m[1] == "password" {
+						return fmt.Errorf("%s uses {{%s}} but the web check has no credlists", label, m[1])
+					}
+					return fmt.Errorf("%s uses {{%s}} before it's extracted", label, m[1])
+				}
+			}
+		}
+		return nil
+	}
+
+	for i := range c.Step {
+		step := &c.Step[i]
+		label := stepLabel(i, *step)
+
+		if step.Method == "" {
+			step.Method = "GET"
+		}
+		step.Method = strings.ToUpper(step.Method)
+		if !slices.Contains(stepMethods, step.Method) {
+			return fmt.Errorf("%s has unknown method %q", label, step.Method)
+		}
+		if step.Path == "" {
+			step.Path = "/"
+		}
+		if !strings.HasPrefix(step.Path, "/") {
+			return fmt.Errorf("%s path %q must start with /", label, step.Path)
+		}
+		if step.Body != "" && len(step.Form) > 0 {
+			return fmt.Errorf("%s can have a body or a form, not both", label)
+		}
+
+		fields := []string{step.Path, step.Body}
+		for _, v := range step.Headers {
+			fields = append(fields, v)
+		}
+		for _, v := range step.Form {
+			fields = append(fields, v)
+		}
+		if err := checkVars(label, fields...); err != nil {
+			return err
+		}
+
+		for _, extract := range step.Extract {
+			if !validVarName.MatchString(extract.Var) {
+				return fmt.Errorf("%s extracts into invalid variable name %q", label, extract.Var)
+			}
+			if err := extract.verify(); err != nil {
+				return fmt.Errorf("%s extract %s: %w", label, extract.Var, err)
+			}
+			defined[extract.Var] = true
+		}
+		for _, assert := range step.Assert {
+			if err := assert.verify(); err != nil {
+				return fmt.Errorf("%s assert: %w", label, err)
+			}
+			if assert.Absent && (assert.Equals != "" || assert.Contains != "") {
+				return fmt.Errorf("%s assert can't check the value of something that must be absent", label)
+			}
+			if err := checkVars(label, assert.Equals, assert.Contains); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func stepLabel(i int, step webStep) string {
+	if step.Name != "" {
+		return fmt.Sprintf("step %d (%s)", i+1, step.Name)
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// runSteps runs each step in order, stopping at the first that fails. Debug has
+// a line for every step that ran.
+func (c Web) runSteps(teamID uint, teamIdentifier string, checkResult Result, response chan Result) {
+	vars := map[string]string{"team": teamIdentifier}
+	if len(c.CredLists) > 0 {
+		username, password, err := c.getCreds(teamID)
+		if err != nil {
+			checkResult.Error = "error getting creds"
+			checkResult.Debug = err.Error()
+			response <- checkResult
+			return
+		}
+		vars["username"] = username
+		vars["password"] = password
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		checkResult.Error = "error creating cookie jar"
+		checkResult.Debug = err.Error()
+		response <- checkResult
+		return
+	}
+	noRedirect := false
+	client := &http.Client{
+		Transport: &http.Transport{
+			IdleConnTimeout: time.Duration(c.Timeout) * time.Second,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // #nosec G402 -- competition services may use self-signed certs
+			},
+		},
+		Timeout: time.Duration(c.Timeout) * time.Second,
+		Jar:     jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if noRedirect {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	ua := uarand.GetRandom()
+
+	lines := []string{}
+	fail := func(label string, msg string, debug string) {
+		checkResult.Error = label + ": " + msg
+		if debug != "" {
+			lines = append(lines, label+": "+debug)
+		}
+		checkResult.Debug = strings.Join(lines, "\n")
+		response <- checkResult
+	}
+
+	var lastBody []byte
+	for i, step := range c.Step {
+		label := stepLabel(i, step)
+		noRedirect = step.NoRedirect
+
+		path := expandVars(step.Path, vars)
+		requestURL := fmt.Sprintf("%s://%s:%d%s", c.Scheme, c.Target, c.Port, path)
+		var body io.Reader
+		if len(step.Form) > 0 {
+			form := url.Values{}
+			for k, v := range step.Form {
+				form.Set(k, expandVars(v, vars))
+			}
+			body = strings.NewReader(form.Encode())
+		} else if step.Body != "" {
+			body = strings.NewReader(expandVars(step.Body, vars))
+		}
+
+		req, err := http.NewRequest(step.Method, requestURL, body)
+		if err != nil {
+			fail(label, "error creating web request", err.Error())
+			return
+		}
+		req.Header.Set("User-Agent", ua)
+		if len(step.Form) > 0 {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for k, v := range step.Headers {
+			req.Header.Set(k, expandVars(v, vars))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			fail(label, "web request errored out", fmt.Sprintf("%s %s: %s", step.Method, path, err))
+			return
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxStepBody))
+		if err := resp.Body.Close(); err != nil {
+			slog.Error("failed to close http response body", "error", err)
+		}
+		if err != nil {
+			fail(label, "error reading page content", fmt.Sprintf("%s %s: %s", step.Method, path, err))
+			return
+		}
+		lastBody = respBody
+
+		line := fmt.Sprintf("%s: %s %s returned %d", label, step.Method, path, resp.StatusCode)
+		if step.Status != 0 && resp.StatusCode != step.Status {
+			fail(label, "status returned by webserver was incorrect", fmt.Sprintf("%s %s returned %d, wanted %d", step.Method, path, resp.StatusCode, step.Status))
+			return
+		}
+
+		for _, extract := range step.Extract {
+			value, found, err := extract.find(resp, respBody)
+			if err != nil {
+				fail(label, "couldn't extract "+extract.Var, fmt.Sprintf("%s: %s", extract.webSelector, err))
+				return
+			}
+			if !found {
+				fail(label, "couldn't extract "+extract.Var, fmt.Sprintf("%s didn't match for %s", extract.webSelector, path))
+				return
+			}
+			vars[extract.Var] = value
+			line += ", extracted " + extract.Var
+		}
+
+		for _, assert := range step.Assert {
+			value, found, err := assert.find(resp, respBody)
+			if err != nil {
+				fail(label, "assertion errored", fmt.Sprintf("%s: %s", assert.webSelector, err))
+				return
+			}
+			if assert.Absent {
+				if found {
+					fail(label, "assertion failed", fmt.Sprintf("%s matched but should be absent", assert.webSelector))
+					return
+				}
+				continue
+			}
+			if !found {
+				fail(label, "assertion failed", fmt.Sprintf("%s didn't match", assert.webSelector))
+				return
+			}
+			if want := expandVars(assert.Equals, vars); assert.Equals != "" && value != want {
+				fail(label, "assertion failed", fmt.Sprintf("%s was %q, wanted %q", assert.webSelector, truncate(value), want))
+				return
+			}
+			if want := expandVars(assert.Contains, vars); assert.Contains != "" && !strings.Contains(value, want) {
+				fail(label, "assertion failed", fmt.Sprintf("%s didn't contain %q", assert.webSelector, want))
+				return
+			}
+		}
+		if len(step.Assert) > 0 {
+			line += fmt.Sprintf(", %d assertions passed", len(step.Assert))
+		}
+		lines = append(lines, line)
+	}
+
+	if c.Ownership {
+		if owner, ok := vars["owner"]; ok {
+			checkResult.Owner = ownerToken([]byte(owner), nil)
+		} else {
+			checkResult.Owner = ownerToken(lastBody, nil)
+		}
+	}
+
+	checkResult.Status = true
+	checkResult.Debug = strings.Join(lines, "\n")
+	response <- checkResult
+}
+
+// truncate shortens a value for the debug output
+func truncate(s string) string {
+	if len(s) > 100 {
+		return s[:100] + "..."
+	}
+	return s
+}
@@ -2,14 +2,26 @@ package checks
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"math/rand"
+	"net"
+	"net/http"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/spnego"
 	"github.com/masterzen/winrm"
+	"github.com/masterzen/winrm/soap"
 )
 
 type WinRM struct {
@@ -17,12 +29,25 @@ type WinRM struct {
 	Encrypted   bool
 	BadAttempts int
 	Command     []winCommandData
+	Script      []winScript `toml:",omitempty"` // commands run in order, all of which have to pass
+	Auth        string      `toml:",omitempty"` // "ntlm", "basic" or "kerberos"
+	Realm       string      `toml:",omitempty"` // kerberos realm, e.g. "CORP.TEAM_.LOCAL"
+	Kdc         string      `toml:",omitempty"` // kerberos KDC, host or host:port
+	Spn         string      `toml:",omitempty"` // kerberos service principal, defaults to HTTP/<target>
+	CACert      string      `toml:",omitempty"` // a PEM file in config/scoredfiles the HTTPS cert has to chain to
+	ServerName  string      `toml:",omitempty"` // name to verify the HTTPS cert against, defaults to the target
 }
 
 type winCommandData struct {
-	UseRegex bool `toml:",omitempty"`
-	Command  string
-	Output   string
+	UseRegex    bool `toml:",omitempty"`
+	Command     string
+	Output      string
+	ExitCode    *int `toml:",omitempty"` // status the command has to exit with, not checked if unset
+	AllowStderr bool `toml:",omitempty"` // don't fail because the command wrote to stderr
+}
+
+type winScript struct {
+	Command []winCommandData
 }
 
 func (c WinRM) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan chan Result) {
@@ -36,21 +61,57 @@ func (c WinRM) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan
 		}
 
 		params := *winrm.DefaultParameters
-		params.TransportDecorator = func() winrm.Transporter {
-			return &winrm.ClientNTLM{}
+		switch c.Auth {
+		case "ntlm":
+			params.TransportDecorator = func() winrm.Transporter {
+				return &winrm.ClientNTLM{}
+			}
+		case "kerberos":
+			krb, err := c.kerberosLogin(username, password, teamIdentifier)
+			if err != nil {
+				checkResult.Error = "kerberos login failed for " + username
+				checkResult.Debug = "creds used were " + username + ":" + password + ", error: " + err.Error()
+				response <- checkResult
+				return
+			}
+			defer krb.Destroy()
+			spn := c.Spn
+			if spn == "" {
+				spn = "HTTP/" + c.Target
+			}
+			spn = strings.ReplaceAll(spn, "_", teamIdentifier)
+			params.TransportDecorator = func() winrm.Transporter {
+				return &winrmKerberos{client: krb, spn: spn}
+			}
+		}
+		// basic auth is the library's default transport
+
+		var caCert []byte
+		if c.CACert != "" {
+			cert, err := GetFile(c.CACert)
+			if err != nil {
+				checkResult.Error = "failed to read ca cert"
+				checkResult.Debug = err.Error()
+				response <- checkResult
+				return
+			}
+			caCert = []byte(cert)
+		}
+		newEndpoint := func() *winrm.Endpoint {
+			endpoint := winrm.NewEndpoint(c.Target, c.Port, c.Encrypted, caCert == nil, caCert, nil, nil, time.Duration(c.Timeout)*time.Second)
+			endpoint.TLSServerName = strings.ReplaceAll(c.ServerName, "_", teamIdentifier)
+			return endpoint
 		}
 
 		// Run bad attempts if specified
 		for range c.BadAttempts {
-			endpoint := winrm.NewEndpoint(c.Target, c.Port, c.Encrypted, true, nil, nil, nil, time.Duration(c.Timeout)*time.Second)
-			if _, err := winrm.NewClientWithParameters(endpoint, username, uuid.New().String(), &params); err != nil {
+			if _, err := winrm.NewClientWithParameters(newEndpoint(), username, uuid.New().String(), &params); err != nil {
 				slog.Error("failed bad winrm attempt", "error", err)
 			}
 		}
 
 		// Log in to WinRM
-		endpoint := winrm.NewEndpoint(c.Target, c.Port, c.Encrypted, true, nil, nil, nil, time.Duration(c.Timeout)*time.Second)
-		client, err := winrm.NewClientWithParameters(endpoint, username, password, &params)
+		client, err := winrm.NewClientWithParameters(newEndpoint(), username, password, &params)
 		if err != nil {
 			checkResult.Error = "error creating winrm client"
 			checkResult.Debug = err.Error()
@@ -58,47 +119,62 @@ func (c WinRM) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan
 			return
 		}
 
-		// If any commands specified, run them; otherwise run a simple connectivity test
-		var powershellCmd string
-		if len(c.Command) > 0 {
-			r := c.Command[rand.Intn(len(c.Command))] // #nosec G404 -- non-crypto selection of command to test
-			powershellCmd = winrm.Powershell(r.Command)
-			bufOut := new(bytes.Buffer)
-			bufErr := new(bytes.Buffer)
-			_, err = client.Run(powershellCmd, bufOut, bufErr)
-			output := bufOut.Bytes()
-			errString := bufErr.String()
-			if err != nil {
-				checkResult.Error = "failed with creds " + username + ":" + password
-				checkResult.Debug = err.Error()
-				response <- checkResult
-				return
-			} else if errString != "" {
-				checkResult.Error = "command produced an error message"
-				checkResult.Debug = "error: " + errString
-				response <- checkResult
-				return
+		// If any commands or scripts are specified, run one; otherwise run a simple connectivity test
+		if len(c.Command)+len(c.Script) > 0 {
+			var commands []winCommandData
+			i := rand.Intn(len(c.Command) + len(c.Script)) // #nosec G404 -- non-crypto selection of command to test
+			if i < len(c.Command) {
+				commands = []winCommandData{c.Command[i]}
+			} else {
+				commands = c.Script[i-len(c.Command)].Command
 			}
-			if r.Output != "" {
-				if r.UseRegex {
-					re := regexp.MustCompile(r.Output)
-					if !re.Match(output) {
-						checkResult.Error = "command output didn't match regex"
-						checkResult.Debug = "command output'" + r.Command + "' didn't match regex '" + r.Output
-						response <- checkResult
-						return
-					}
-				} else {
-					if strings.TrimSpace(string(output)) != r.Output {
-						checkResult.Error = "command output didn't match string"
-						checkResult.Debug = "command output of '" + r.Command + "' didn't match string '" + r.Output
-						response <- checkResult
-						return
+
+			for step, r := range commands {
+				bufOut := new(bytes.Buffer)
+				bufErr := new(bytes.Buffer)
+				exitCode, err := client.Run(winrm.Powershell(r.Command), bufOut, bufErr)
+				output := bufOut.Bytes()
+				errString := bufErr.String()
+				if len(commands) > 1 {
+					checkResult.Debug = fmt.Sprintf("script step %d: ", step+1)
+				}
+				if err != nil {
+					checkResult.Error = "failed with creds " + username + ":" + password
+					checkResult.Debug += err.Error()
+					response <- checkResult
+					return
+				} else if r.ExitCode != nil && exitCode != *r.ExitCode {
+					checkResult.Error = "command exited with the wrong status"
+					checkResult.Debug += fmt.Sprintf("command '%s' exited with %d, wanted %d, error: %s", r.Command, exitCode, *r.ExitCode, errString)
+					response <- checkResult
+					return
+				} else if errString != "" && !r.AllowStderr {
+					checkResult.Error = "command produced an error message"
+					checkResult.Debug += "error: " + errString
+					response <- checkResult
+					return
+				}
+				if r.Output != "" {
+					if r.UseRegex {
+						re := regexp.MustCompile(r.Output)
+						if !re.Match(output) {
+							checkResult.Error = "command output didn't match regex"
+							checkResult.Debug += "command output'" + r.Command + "' didn't match regex '" + r.Output
+							response <- checkResult
+							return
+						}
+					} else {
+						if strings.TrimSpace(string(output)) != r.Output {
+							checkResult.Error = "command output didn't match string"
+							checkResult.Debug += "command output of '" + r.Command + "' didn't match string '" + r.Output
+							response <- checkResult
+							return
+						}
 					}
 				}
 			}
 		} else {
-			powershellCmd = winrm.Powershell("hostname")
+			powershellCmd := winrm.Powershell("hostname")
 			bufOut := new(bytes.Buffer)
 			bufErr := new(bytes.Buffer)
 			_, err = client.Run(powershellCmd, bufOut, bufErr)
@@ -118,6 +194,81 @@ func (c WinRM) Run(teamID uint, teamIdentifier string, roundID uint, resultsChan
 	c.Service.Run(teamID, teamIdentifier, roundID, resultsChan, definition)
 }
 
+// kerberosLogin gets a TGT from the team's KDC
+func (c WinRM) kerberosLogin(username, password, teamIdentifier string) (*krbclient.Client, error) {
+	realm := strings.ToUpper(strings.ReplaceAll(c.Realm, "_", teamIdentifier))
+	kdc := strings.ReplaceAll(c.Kdc, "_", teamIdentifier)
+	if _, _, err := net.SplitHostPort(kdc); err != nil {
+		kdc = net.JoinHostPort(kdc, "88")
+	}
+	return krbLogin(realm, kdc, username, password)
+}
+
+// winrmKerberos is a winrm transport that authenticates each request with a
+// SPNEGO token from an already logged in Kerberos client
+type winrmKerberos struct {
+	client    *krbclient.Client
+	spn       string
+	url       string
+	transport http.RoundTripper
+}
+
+func (k *winrmKerberos) Transport(endpoint *winrm.Endpoint) error {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: endpoint.Insecure, // #nosec G402 -- only skipped when no ca cert is configured
+		ServerName:         endpoint.TLSServerName,
+	}
+	if len(endpoint.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(endpoint.CACert) {
+			return errors.New("no certificates in ca cert")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	k.transport = &http.Transport{
+		TLSClientConfig:       tlsConfig,
+		DialContext:           (&net.Dialer{Timeout: endpoint.Timeout}).DialContext,
+		ResponseHeaderTimeout: endpoint.Timeout,
+	}
+
+	scheme := "http"
+	if endpoint.HTTPS {
+		scheme = "https"
+	}
+	k.url = fmt.Sprintf("%s://%s/wsman", scheme, net.JoinHostPort(endpoint.Host, fmt.Sprint(endpoint.Port)))
+	return nil
+}
+
+func (k *winrmKerberos) Post(_ *winrm.Client, request *soap.SoapMessage) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, k.url, strings.NewReader(request.String()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	if err := spnego.SetSPNEGOHeader(k.client, req, k.spn); err != nil {
+		return "", fmt.Errorf("getting a ticket for %s: %w", k.spn, err)
+	}
+
+	resp, err := (&http.Client{Transport: k.transport}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Debug("failed to close winrm response", "error", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http error %d: %s", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
 func (c *WinRM) Verify(box string, ip string, points int, timeout int, slapenalty int, slathreshold int) error {
 	if c.ServiceType == "" {
 		c.ServiceType = "WinRM"
@@ -138,9 +289,43 @@ func (c *WinRM) Verify(box string, ip string, points int, timeout int, slapenalt
 			c.Port = 80
 		}
 	}
-	for _, r := range c.Command {
+	if c.Auth == "" {
+		c.Auth = "ntlm"
+	}
+	switch c.Auth {
+	case "ntlm", "basic":
+		if c.Realm != "" || c.Kdc != "" || c.Spn != "" {
+			return errors.New("winrm realm, kdc and spn are only used with kerberos auth")
+		}
+	case "kerberos":
+		if c.Realm == "" || c.Kdc == "" {
+			return errors.New("winrm kerberos auth needs a realm and a kdc")
+		}
+	default:
+		return fmt.Errorf("unknown winrm auth %q, use ntlm, basic or kerberos", c.Auth)
+	}
+	if (c.CACert != "" || c.ServerName != "") && !c.Encrypted {
+		return errors.New("winrm ca cert and server name need encrypted")
+	}
+	if c.CACert != "" && !filepath.IsLocal(c.CACert) {
+		return fmt.Errorf("ca cert %q must be a path inside config/scoredfiles", c.CACert)
+	}
+
+	commands := slices.Clone(c.Command)
+	for i, s := range c.Script {
+		if len(s.Command) == 0 {
+			return fmt.Errorf("winrm script %d has no commands", i+1)
+		}
+		commands = append(commands, s.Command...)
+	}
+	for _, r := range commands {
+		if r.Command == "" {
+			return errors.New("winrm command can't be empty")
+		}
 		if r.UseRegex {
-			regexp.MustCompile(r.Output)
+			if _, err := regexp.Compile(r.Output); err != nil {
+				return fmt.Errorf("invalid regex for winrm command %q: %w", r.Command, err)
+			}
 		}
 	}
 	return nil
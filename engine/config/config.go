@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"quotient/engine/checks"
+	"quotient/engine/scoring"
 	"slices"
 	"sort"
 	"strings"
@@ -36,6 +37,12 @@ type ConfigSettings struct {
 
 	MiscSettings MiscConfig `toml:"MiscSettings,omitempty" json:"MiscSettings,omitempty"`
 
+	// Red team attack scoring
+	RedTeamSettings RedTeamConfig `toml:"RedTeamSettings,omitempty" json:"RedTeamSettings,omitempty"`
+
+	// Settings for the scoring model picked in MiscSettings
+	ScoringSettings scoring.Settings `toml:"ScoringSettings,omitempty" json:"ScoringSettings,omitempty"`
+
 	// Restrict information
 	UISettings UIConfig `toml:"UISettings,omitempty" json:"UISettings,omitempty"`
 
@@ -125,6 +132,30 @@ type MiscConfig struct {
 	Timeout      int
 	SlaThreshold int
 	SlaPenalty   int
+
+	// How check points are turned into scores, see engine/scoring
+	ScoringModel string
+}
+
+// RedTeamConfig is the policy for turning approved red team attacks into
+// penalties against the attacked blue team
+type RedTeamConfig struct {
+	// One-time penalty for the access level gained
+	UserAccessPenalty  int
+	AdminAccessPenalty int
+
+	// One-time penalty for each category of data accessed
+	PIIPenalty                 int
+	PasswordPenalty            int
+	SystemConfigurationPenalty int
+	DatabasePenalty            int
+
+	// Taken every RecurringInterval rounds while an attack still works
+	RecurringPenalty  int
+	RecurringInterval int
+
+	// Percent of an attack's penalty given back to a team that reported it
+	IncidentReportShare int
 }
 
 type UIConfig struct {
@@ -152,22 +183,32 @@ type Box struct {
 	Runners []checks.Runner `toml:"-" json:"-"`
 
 	// Service check definitions
-	Custom []*checks.Custom `toml:"Custom,omitempty" json:"custom,omitempty"`
-	Dns    []*checks.Dns    `toml:"Dns,omitempty" json:"dns,omitempty"`
-	Ftp    []*checks.Ftp    `toml:"Ftp,omitempty" json:"ftp,omitempty"`
-	Imap   []*checks.Imap   `toml:"Imap,omitempty" json:"imap,omitempty"`
-	Ldap   []*checks.Ldap   `toml:"Ldap,omitempty" json:"ldap,omitempty"`
-	Ping   []*checks.Ping   `toml:"Ping,omitempty" json:"ping,omitempty"`
-	Pop3   []*checks.Pop3   `toml:"Pop3,omitempty" json:"pop3,omitempty"`
-	Rdp    []*checks.Rdp    `toml:"Rdp,omitempty" json:"rdp,omitempty"`
-	Smb    []*checks.Smb    `toml:"Smb,omitempty" json:"smb,omitempty"`
-	Smtp   []*checks.Smtp   `toml:"Smtp,omitempty" json:"smtp,omitempty"`
-	Sql    []*checks.Sql    `toml:"Sql,omitempty" json:"sql,omitempty"`
-	Ssh    []*checks.Ssh    `toml:"Ssh,omitempty" json:"ssh,omitempty"`
-	Tcp    []*checks.Tcp    `toml:"Tcp,omitempty" json:"tcp,omitempty"`
-	Vnc    []*checks.Vnc    `toml:"Vnc,omitempty" json:"vnc,omitempty"`
-	Web    []*checks.Web    `toml:"Web,omitempty" json:"web,omitempty"`
-	WinRM  []*checks.WinRM  `toml:"Winrm,omitempty" json:"winrm,omitempty"`
+	Custom     []*checks.Custom     `toml:"Custom,omitempty" json:"custom,omitempty"`
+	Dns        []*checks.Dns        `toml:"Dns,omitempty" json:"dns,omitempty"`
+	Docker     []*checks.Docker     `toml:"Docker,omitempty" json:"docker,omitempty"`
+	Ftp        []*checks.Ftp        `toml:"Ftp,omitempty" json:"ftp,omitempty"`
+	Imap       []*checks.Imap       `toml:"Imap,omitempty" json:"imap,omitempty"`
+	Kerberos   []*checks.Kerberos   `toml:"Kerberos,omitempty" json:"kerberos,omitempty"`
+	Kubernetes []*checks.Kubernetes `toml:"Kubernetes,omitempty" json:"kubernetes,omitempty"`
+	Ldap       []*checks.Ldap       `toml:"Ldap,omitempty" json:"ldap,omitempty"`
+	Mail       []*checks.Mail       `toml:"Mail,omitempty" json:"mail,omitempty"`
+	Memcached  []*checks.Memcached  `toml:"Memcached,omitempty" json:"memcached,omitempty"`
+	Mongo      []*checks.Mongo      `toml:"Mongo,omitempty" json:"mongo,omitempty"`
+	Mqtt       []*checks.Mqtt       `toml:"Mqtt,omitempty" json:"mqtt,omitempty"`
+	Ntp        []*checks.Ntp        `toml:"Ntp,omitempty" json:"ntp,omitempty"`
+	Ping       []*checks.Ping       `toml:"Ping,omitempty" json:"ping,omitempty"`
+	Pop3       []*checks.Pop3       `toml:"Pop3,omitempty" json:"pop3,omitempty"`
+	Rdp        []*checks.Rdp        `toml:"Rdp,omitempty" json:"rdp,omitempty"`
+	Redis      []*checks.Redis      `toml:"Redis,omitempty" json:"redis,omitempty"`
+	Smb        []*checks.Smb        `toml:"Smb,omitempty" json:"smb,omitempty"`
+	Smtp       []*checks.Smtp       `toml:"Smtp,omitempty" json:"smtp,omitempty"`
+	Snmp       []*checks.Snmp       `toml:"Snmp,omitempty" json:"snmp,omitempty"`
+	Sql        []*checks.Sql        `toml:"Sql,omitempty" json:"sql,omitempty"`
+	Ssh        []*checks.Ssh        `toml:"Ssh,omitempty" json:"ssh,omitempty"`
+	Tcp        []*checks.Tcp        `toml:"Tcp,omitempty" json:"tcp,omitempty"`
+	Vnc        []*checks.Vnc        `toml:"Vnc,omitempty" json:"vnc,omitempty"`
+	Web        []*checks.Web        `toml:"Web,omitempty" json:"web,omitempty"`
+	WinRM      []*checks.WinRM      `toml:"Winrm,omitempty" json:"winrm,omitempty"`
 }
 
 // Load in a config
@@ -335,6 +376,48 @@ func checkConfig(conf *ConfigSettings) error {
 		conf.MiscSettings.SlaPenalty = conf.MiscSettings.SlaThreshold * conf.MiscSettings.Points
 	}
 
+	if conf.MiscSettings.ScoringModel == "" {
+		conf.MiscSettings.ScoringModel = "standard"
+	}
+	if _, err := scoring.New(conf.MiscSettings.ScoringModel, conf.ScoringSettings); err != nil {
+		errResult = errors.Join(errResult, err)
+	}
+	if err := conf.ScoringSettings.Validate(); err != nil {
+		errResult = errors.Join(errResult, err)
+	}
+
+	// red team penalties default to a multiple of check points, but only when
+	// none are configured so explicit zeros can turn a penalty off
+	penalties := conf.RedTeamSettings
+	penalties.IncidentReportShare = 0
+	if penalties == (RedTeamConfig{}) {
+		conf.RedTeamSettings.UserAccessPenalty = 10 * conf.MiscSettings.Points
+		conf.RedTeamSettings.AdminAccessPenalty = 20 * conf.MiscSettings.Points
+		conf.RedTeamSettings.PIIPenalty = 5 * conf.MiscSettings.Points
+		conf.RedTeamSettings.PasswordPenalty = 5 * conf.MiscSettings.Points
+		conf.RedTeamSettings.SystemConfigurationPenalty = 5 * conf.MiscSettings.Points
+		conf.RedTeamSettings.DatabasePenalty = 5 * conf.MiscSettings.Points
+	}
+
+	if conf.RedTeamSettings.RecurringInterval == 0 {
+		conf.RedTeamSettings.RecurringInterval = 1
+	}
+
+	if conf.RedTeamSettings.IncidentReportShare == 0 {
+		conf.RedTeamSettings.IncidentReportShare = 50
+	}
+
+	if conf.RedTeamSettings.IncidentReportShare < 0 || conf.RedTeamSettings.IncidentReportShare > 100 {
+		errResult = errors.Join(errResult, errors.New("incident report share must be a percentage between 0 and 100"))
+	}
+
+	if conf.RedTeamSettings.UserAccessPenalty < 0 || conf.RedTeamSettings.AdminAccessPenalty < 0 ||
+		conf.RedTeamSettings.PIIPenalty < 0 || conf.RedTeamSettings.PasswordPenalty < 0 ||
+		conf.RedTeamSettings.SystemConfigurationPenalty < 0 || conf.RedTeamSettings.DatabasePenalty < 0 ||
+		conf.RedTeamSettings.RecurringPenalty < 0 || conf.RedTeamSettings.RecurringInterval < 0 {
+		errResult = errors.Join(errResult, errors.New("red team penalties and interval must not be negative"))
+	}
+
 	// OIDC settings defaults
 	if conf.OIDCSettings.OIDCEnabled {
 		if conf.OIDCSettings.OIDCIssuerURL == "" {
@@ -408,12 +491,15 @@ func checkConfig(conf *ConfigSettings) error {
 		conf.Box[i].IP = strings.ToLower(conf.Box[i].IP)
 
 		allChecks := []checks.Runner{}
+		ownershipChecks := 0
 		checkSets := [][]checks.Runner{
-			getRunners(conf.Box[i].Custom), getRunners(conf.Box[i].Dns), getRunners(conf.Box[i].Ftp), getRunners(conf.Box[i].Imap),
-			getRunners(conf.Box[i].Ldap), getRunners(conf.Box[i].Ping), getRunners(conf.Box[i].Pop3), getRunners(conf.Box[i].Rdp),
-			getRunners(conf.Box[i].Smb), getRunners(conf.Box[i].Smtp), getRunners(conf.Box[i].Sql), getRunners(conf.Box[i].Ssh),
+			getRunners(conf.Box[i].Custom), getRunners(conf.Box[i].Dns), getRunners(conf.Box[i].Docker), getRunners(conf.Box[i].Ftp), getRunners(conf.Box[i].Imap),
+			getRunners(conf.Box[i].Kerberos), getRunners(conf.Box[i].Kubernetes), getRunners(conf.Box[i].Ldap), getRunners(conf.Box[i].Mail), getRunners(conf.Box[i].Memcached), getRunners(conf.Box[i].Mongo),
+			getRunners(conf.Box[i].Mqtt), getRunners(conf.Box[i].Ntp), getRunners(conf.Box[i].Ping), getRunners(conf.Box[i].Pop3), getRunners(conf.Box[i].Rdp), getRunners(conf.Box[i].Redis),
+			getRunners(conf.Box[i].Smb), getRunners(conf.Box[i].Smtp), getRunners(conf.Box[i].Snmp), getRunners(conf.Box[i].Sql), getRunners(conf.Box[i].Ssh),
 			getRunners(conf.Box[i].Tcp), getRunners(conf.Box[i].Vnc), getRunners(conf.Box[i].Web), getRunners(conf.Box[i].WinRM),
 		}
+
 		for _, checks := range checkSets {
 			for _, check := range checks {
 				if err := check.Verify(
@@ -445,12 +531,29 @@ func checkConfig(conf *ConfigSettings) error {
 					setter.SetCredlists(credPaths)
 				}
 
+				if owner, ok := check.(interface{ IsOwnership() bool }); ok && owner.IsOwnership() {
+					if check.GetType() != "Web" && check.GetType() != "Custom" {
+						errResult = errors.Join(errResult, fmt.Errorf("ownership is only supported by web and custom checks: %s", check.GetName()))
+					} else {
+						ownershipChecks++
+					}
+				}
+
 				allChecks = append(allChecks, check)
 			}
 		}
+		if conf.RequiredSettings.EventType == "koth" && ownershipChecks == 0 {
+			errResult = errors.Join(errResult, fmt.Errorf("koth box %s has no ownership check", conf.Box[i].Name))
+		}
 		conf.Box[i].Runners = allChecks
 	}
 
+	for service := range conf.ScoringSettings.Weights {
+		if !runnerNames[service] {
+			errResult = errors.Join(errResult, fmt.Errorf("scoring weight set for unknown service: %s", service))
+		}
+	}
+
 	// errResult is nil by default if no errors occured
 	return errResult
 }
@@ -471,6 +574,18 @@ func getRunners[T checks.Runner](arr []T) []checks.Runner {
 	return out
 }
 
+// RunnerPools returns the runner pools the checks are split across. The default
+// pool is always included.
+func (conf *ConfigSettings) RunnerPools() []string {
+	pools := []string{"default"}
+	for _, check := range conf.AllChecks() {
+		if p, ok := check.(interface{ GetPool() string }); ok && p.GetPool() != "" && !slices.Contains(pools, p.GetPool()) {
+			pools = append(pools, p.GetPool())
+		}
+	}
+	return pools
+}
+
 // Returns a flat list of all checks across all boxes.
 func (conf *ConfigSettings) AllChecks() []checks.Runner {
 	var out []checks.Runner
@@ -2,7 +2,11 @@ package db
 
 import (
 	"errors"
+	"time"
 
+	"quotient/engine/config"
+
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
@@ -14,6 +18,13 @@ const (
 	ADMIN
 )
 
+// attacks only change scores once an admin approves them
+const (
+	AttackPending  = "pending"
+	AttackApproved = "approved"
+	AttackRejected = "rejected"
+)
+
 // a specific instance of a vector against a team
 type AttackSchema struct {
 	ID             uint
@@ -21,7 +32,7 @@ type AttackSchema struct {
 	Vector         VectorSchema
 	TeamID         uint
 	Narrative      string
-	EvidenceImages []string `gorm:"type:text[]"` // /submissions/red/teamID/boxID/image.png
+	EvidenceImages pq.StringArray `gorm:"type:text[]"` // /submissions/red/teamID/boxID/image.png
 	AccessLevel    int
 
 	StillWorks                    bool
@@ -29,6 +40,69 @@ type AttackSchema struct {
 	DataAccessPassword            bool
 	DataAccessSystemConfiguration bool
 	DataAccessDatabase            bool
+
+	CreatedAt        time.Time
+	Status           string `gorm:"default:pending"`
+	Penalty          int    // one-time penalty, set when approved
+	RecurringPenalty int    // taken every interval while the attack still works, set when approved
+	ApprovedRound    uint   // round that was running when the attack was approved
+	ReviewedBy       string
+	ReviewedAt       time.Time
+}
+
+// AttackPenaltySchema is a recurring penalty taken for an attack that still works
+type AttackPenaltySchema struct {
+	ID       uint
+	AttackID uint `gorm:"index"`
+	TeamID   uint
+	RoundID  uint `gorm:"index"`
+	Round    RoundSchema
+	Points   int
+}
+
+// ScorePenalty works out the one-time penalty for an attack under a scoring policy
+func (attack AttackSchema) ScorePenalty(policy config.RedTeamConfig) int {
+	penalty := 0
+	switch AccessLevel(attack.AccessLevel) {
+	case USER:
+		penalty += policy.UserAccessPenalty
+	case ADMIN:
+		penalty += policy.AdminAccessPenalty
+	}
+	if attack.DataAccessPII {
+		penalty += policy.PIIPenalty
+	}
+	if attack.DataAccessPassword {
+		penalty += policy.PasswordPenalty
+	}
+	if attack.DataAccessSystemConfiguration {
+		penalty += policy.SystemConfigurationPenalty
+	}
+	if attack.DataAccessDatabase {
+		penalty += policy.DatabasePenalty
+	}
+	return penalty
+}
+
+// IncidentAward works out how much of an attack's one-time penalty is given back
+// to a team that reported it, as a percent share rounded down
+func (attack AttackSchema) IncidentAward(share int) int {
+	if attack.Status != AttackApproved || share <= 0 {
+		return 0
+	}
+	return attack.Penalty * min(share, 100) / 100
+}
+
+// RecurringDue reports whether an approved attack that still works owes a
+// recurring penalty in the given round
+func (attack AttackSchema) RecurringDue(round uint, interval int) bool {
+	if attack.Status != AttackApproved || !attack.StillWorks || attack.RecurringPenalty <= 0 || interval <= 0 {
+		return false
+	}
+	if round <= attack.ApprovedRound {
+		return false
+	}
+	return (round-attack.ApprovedRound)%uint(interval) == 0
 }
 
 func GetAttacks() ([]AttackSchema, error) {
@@ -44,6 +118,28 @@ func GetAttacks() ([]AttackSchema, error) {
 	return attacks, nil
 }
 
+func GetAttackByID(id uint) (AttackSchema, error) {
+	var attack AttackSchema
+	result := db.Table("attack_schemas").First(&attack, id)
+	if result.Error != nil {
+		return AttackSchema{}, result.Error
+	}
+	return attack, nil
+}
+
+// GetApprovedAttacks retrieves the attacks that count against teams
+func GetApprovedAttacks() ([]AttackSchema, error) {
+	var attacks []AttackSchema
+	result := db.Table("attack_schemas").Where("status = ?", AttackApproved).Find(&attacks)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return attacks, nil
+		}
+		return nil, result.Error
+	}
+	return attacks, nil
+}
+
 func CreateAttack(attack AttackSchema) (AttackSchema, error) {
 	result := db.Table("attack_schemas").Create(&attack)
 	if result.Error != nil {
@@ -59,3 +155,63 @@ func UpdateAttack(attack AttackSchema) (AttackSchema, error) {
 	}
 	return attack, nil
 }
+
+// ReviewAttack approves or rejects a pending attack. Only pending attacks can be
+// reviewed so a penalty can't be applied twice.
+func ReviewAttack(attack AttackSchema) (AttackSchema, error) {
+	result := db.Table("attack_schemas").Where("id = ? AND status = ?", attack.ID, AttackPending).Updates(map[string]any{
+		"status":            attack.Status,
+		"penalty":           attack.Penalty,
+		"recurring_penalty": attack.RecurringPenalty,
+		"approved_round":    attack.ApprovedRound,
+		"reviewed_by":       attack.ReviewedBy,
+		"reviewed_at":       attack.ReviewedAt,
+	})
+	if result.Error != nil {
+		return AttackSchema{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return AttackSchema{}, errors.New("attack has already been reviewed")
+	}
+	return attack, nil
+}
+
+func CreateAttackPenalties(penalties []AttackPenaltySchema) error {
+	if len(penalties) == 0 {
+		return nil
+	}
+	result := db.Table("attack_penalty_schemas").Omit("Round").Create(&penalties)
+	return result.Error
+}
+
+// approvedAttackPenalties selects every red team penalty as (at, team_id, amount)
+// rows, recurring penalties are timed by the start of the round they were taken in
+const approvedAttackPenalties = `
+	SELECT reviewed_at AS at, team_id, penalty AS amount
+	FROM attack_schemas
+	WHERE status = 'approved'
+	UNION ALL
+	SELECT r.start_time AS at, p.team_id, p.points AS amount
+	FROM attack_penalty_schemas p
+	JOIN round_schemas r ON r.id = p.round_id
+`
+
+// GetAttackPenaltyScores retrieves each team's total red team penalty
+func GetAttackPenaltyScores() (map[uint]int, error) {
+	scores := make(map[uint]int)
+	rows, err := db.Raw(`SELECT team_id, SUM(amount) FROM (` + approvedAttackPenalties + `) p GROUP BY team_id`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID uint
+		var amount int
+		if err := rows.Scan(&teamID, &amount); err != nil {
+			return nil, err
+		}
+		scores[teamID] = amount
+	}
+	return scores, nil
+}
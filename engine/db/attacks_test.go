@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+
+	"quotient/engine/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttackScorePenalty(t *testing.T) {
+	policy := config.RedTeamConfig{
+		UserAccessPenalty:          10,
+		AdminAccessPenalty:         30,
+		PIIPenalty:                 1,
+		PasswordPenalty:            2,
+		SystemConfigurationPenalty: 4,
+		DatabasePenalty:            8,
+	}
+
+	tests := []struct {
+		name     string
+		attack   AttackSchema
+		expected int
+	}{
+		{"no access", AttackSchema{AccessLevel: int(NONE)}, 0},
+		{"user access", AttackSchema{AccessLevel: int(USER)}, 10},
+		{"admin access", AttackSchema{AccessLevel: int(ADMIN)}, 30},
+		{"unknown access level", AttackSchema{AccessLevel: 7}, 0},
+		{"data only", AttackSchema{DataAccessPII: true, DataAccessDatabase: true}, 9},
+		{"everything", AttackSchema{
+			AccessLevel:                   int(ADMIN),
+			DataAccessPII:                 true,
+			DataAccessPassword:            true,
+			DataAccessSystemConfiguration: true,
+			DataAccessDatabase:            true,
+		}, 45},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.attack.ScorePenalty(policy))
+		})
+	}
+}
+
+func TestAttackRecurringDue(t *testing.T) {
+	approved := AttackSchema{Status: AttackApproved, StillWorks: true, RecurringPenalty: 5, ApprovedRound: 10}
+
+	tests := []struct {
+		name     string
+		mutate   func(a *AttackSchema)
+		round    uint
+		interval int
+		expected bool
+	}{
+		{"approval round", nil, 10, 1, false},
+		{"before approval", nil, 3, 1, false},
+		{"next round", nil, 11, 1, true},
+		{"off interval", nil, 12, 3, false},
+		{"on interval", nil, 13, 3, true},
+		{"no interval", nil, 11, 0, false},
+		{"pending", func(a *AttackSchema) { a.Status = AttackPending }, 11, 1, false},
+		{"rejected", func(a *AttackSchema) { a.Status = AttackRejected }, 11, 1, false},
+		{"fixed", func(a *AttackSchema) { a.StillWorks = false }, 11, 1, false},
+		{"no recurring penalty", func(a *AttackSchema) { a.RecurringPenalty = 0 }, 11, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attack := approved
+			if tt.mutate != nil {
+				tt.mutate(&attack)
+			}
+			assert.Equal(t, tt.expected, attack.RecurringDue(tt.round, tt.interval))
+		})
+	}
+}
+
+func TestAttackIncidentAward(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		penalty  int
+		share    int
+		expected int
+	}{
+		{"half", AttackApproved, 100, 50, 50},
+		{"rounds down", AttackApproved, 15, 50, 7},
+		{"all of it", AttackApproved, 40, 100, 40},
+		{"share capped", AttackApproved, 40, 150, 40},
+		{"no share", AttackApproved, 40, 0, 0},
+		{"pending", AttackPending, 40, 50, 0},
+		{"rejected", AttackRejected, 40, 50, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attack := AttackSchema{Status: tt.status, Penalty: tt.penalty}
+			assert.Equal(t, tt.expected, attack.IncidentAward(tt.share))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CheckOverrideSchema records a check an admin ran again after its round. The
+// rerun's result replaces the stored check once it comes back.
+type CheckOverrideSchema struct {
+	ID          uint
+	RoundID     uint `gorm:"index"`
+	TeamID      uint
+	Team        TeamSchema
+	ServiceName string
+	RequestedBy string
+	RequestedAt time.Time
+	Completed   bool
+	CompletedAt time.Time
+	OldResult   bool
+	NewResult   bool
+	Error       string
+	Debug       string
+}
+
+// GetRoundChecks retrieves every stored check in a round
+func GetRoundChecks(roundID uint) ([]ServiceCheckSchema, error) {
+	var checks []ServiceCheckSchema
+	result := db.Table("service_check_schemas").Where("round_id = ?", roundID).Order("team_id, service_name").Find(&checks)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return checks, nil
+		}
+		return nil, result.Error
+	}
+	return checks, nil
+}
+
+func CreateCheckOverride(override CheckOverrideSchema) (CheckOverrideSchema, error) {
+	result := db.Table("check_override_schemas").Omit("Team").Create(&override)
+	if result.Error != nil {
+		return CheckOverrideSchema{}, result.Error
+	}
+	return override, nil
+}
+
+// GetCheckOverrides retrieves every override, newest first
+func GetCheckOverrides() ([]CheckOverrideSchema, error) {
+	var overrides []CheckOverrideSchema
+	result := db.Table("check_override_schemas").Preload("Team", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name")
+	}).Order("requested_at desc, id desc").Find(&overrides)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return overrides, nil
+		}
+		return nil, result.Error
+	}
+	return overrides, nil
+}
+
+// CompleteCheckOverride saves a rerun's result over the stored check and closes
+// every pending override for it. It returns the stored check as it was before.
+func CompleteCheckOverride(check ServiceCheckSchema) (ServiceCheckSchema, error) {
+	var old ServiceCheckSchema
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("service_check_schemas").Where("round_id = ? AND team_id = ? AND service_name = ?", check.RoundID, check.TeamID, check.ServiceName).First(&old).Error; err != nil {
+			return err
+		}
+
+		result := tx.Table("service_check_schemas").Where("round_id = ? AND team_id = ? AND service_name = ?", check.RoundID, check.TeamID, check.ServiceName).Updates(map[string]any{
+			"result": check.Result,
+			"error":  check.Error,
+			"debug":  check.Debug,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Table("check_override_schemas").Where("round_id = ? AND team_id = ? AND service_name = ? AND completed = false", check.RoundID, check.TeamID, check.ServiceName).Updates(map[string]any{
+			"completed":    true,
+			"completed_at": time.Now(),
+			"new_result":   check.Result,
+			"error":        check.Error,
+			"debug":        check.Debug,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("no pending override for this check")
+		}
+		return nil
+	})
+	if err != nil {
+		return ServiceCheckSchema{}, err
+	}
+	return old, nil
+}
+
+// SaveRerunScore saves a rerun check's points and its service's SLA violations
+// from that round on. Violations in rounds that still have one are kept as they
+// were, so only rounds the rerun changed are touched.
+func SaveRerunScore(check ServiceCheckSchema, slas []SLASchema) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("service_check_schemas").Where("round_id = ? AND team_id = ? AND service_name = ?", check.RoundID, check.TeamID, check.ServiceName).Update("earned", check.Earned).Error; err != nil {
+			return err
+		}
+
+		var existing []SLASchema
+		if err := tx.Table("sla_schemas").Where("team_id = ? AND service_name = ? AND round_id >= ?", check.TeamID, check.ServiceName, check.RoundID).Find(&existing).Error; err != nil {
+			return err
+		}
+		violated := make(map[uint]bool, len(slas))
+		for _, sla := range slas {
+			violated[sla.RoundID] = true
+		}
+		saved := make(map[uint]bool, len(existing))
+		for _, sla := range existing {
+			if violated[sla.RoundID] {
+				saved[sla.RoundID] = true
+				continue
+			}
+			if err := tx.Exec("DELETE FROM sla_schemas WHERE team_id = ? AND service_name = ? AND round_id = ?", sla.TeamID, sla.ServiceName, sla.RoundID).Error; err != nil {
+				return err
+			}
+		}
+		for _, sla := range slas {
+			if saved[sla.RoundID] {
+				continue
+			}
+			if err := tx.Table("sla_schemas").Omit("Round").Create(&sla).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -39,31 +39,53 @@ func Connect(connectURL string) {
 
 	slog.Info("Connected to DB")
 
+	// checks saved before the scoring model existed earned their raw points
+	backfillEarned := !db.Migrator().HasColumn(&ServiceCheckSchema{}, "Earned")
+
 	err = db.AutoMigrate(&AnnouncementSchema{},
-		&TeamSchema{}, &RoundSchema{}, &ServiceCheckSchema{}, &SLASchema{}, &ManualAdjustmentSchema{},
-		&InjectSchema{}, &SubmissionSchema{}, &TeamServiceCheckSchema{},
+		&TeamSchema{}, &RoundSchema{}, &ServiceCheckSchema{}, &ScoreBonusSchema{}, &SLASchema{}, &CheckOverrideSchema{}, &ManualAdjustmentSchema{},
+		&InjectSchema{}, &SubmissionSchema{}, &InjectGradeSchema{}, &TeamServiceCheckSchema{}, &KothOwnershipSchema{},
 		// box schema must come first for automigrate to work
-		&VulnSchema{}, &BoxSchema{}, &VectorSchema{}, &AttackSchema{}, &CompetitionStateSchema{})
+		&VulnSchema{}, &BoxSchema{}, &VectorSchema{}, &AttackSchema{}, &AttackPenaltySchema{}, &IncidentReportSchema{}, &CompetitionStateSchema{})
 	if err != nil {
 		log.Fatalln("Failed to auto migrate:", err)
 	}
 
+	if backfillEarned {
+		if err := db.Exec("UPDATE service_check_schemas SET earned = points WHERE result = true").Error; err != nil {
+			log.Fatalln("Failed to backfill earned points:", err)
+		}
+	}
+
 	// Create materialized views
 	createCumulativeScoresView()
 }
 
 // createCumulativeScoresView creates the materialized view for cumulative scores.
+// It adds up what the scoring model awarded, checks and bonuses, per team and round.
 func createCumulativeScoresView() {
-	// Create the materialized view if it doesn't exist
-	// If it does exist, CREATE won't refresh it, so we do that separately
-	err := db.Exec(`
-		CREATE MATERIALIZED VIEW IF NOT EXISTS cumulative_scores AS
-		SELECT DISTINCT 
-			round_id, 
-			team_id, 
-			SUM(CASE WHEN result = '1' THEN points ELSE 0 END) 
-				OVER(PARTITION BY team_id ORDER BY round_id) as cumulative_points
-		FROM service_check_schemas 
+	// Recreate the view so changes to its definition apply to existing databases.
+	// It's repopulated from the tables below so nothing is lost.
+	err := db.Exec(`DROP MATERIALIZED VIEW IF EXISTS cumulative_scores`).Error
+	if err != nil {
+		log.Fatalln("Failed to drop cumulative_scores materialized view:", err)
+	}
+
+	err = db.Exec(`
+		CREATE MATERIALIZED VIEW cumulative_scores AS
+		SELECT
+			round_id,
+			team_id,
+			SUM(points) OVER(PARTITION BY team_id ORDER BY round_id) as cumulative_points
+		FROM (
+			SELECT round_id, team_id, SUM(points) as points
+			FROM (
+				SELECT round_id, team_id, earned as points FROM service_check_schemas
+				UNION ALL
+				SELECT round_id, team_id, points FROM score_bonus_schemas
+			) awarded
+			GROUP BY round_id, team_id
+		) per_round
 		ORDER BY team_id, round_id
 	`).Error
 	if err != nil {
@@ -147,8 +169,8 @@ func AddTeams(conf *config.ConfigSettings) error {
 }
 
 func ResetScores() error {
-	// truncate servicecheckschemas, slaschemas, and roundschemas with cascade
-	if err := db.Exec("TRUNCATE TABLE service_check_schemas, round_schemas, sla_schemas CASCADE").Error; err != nil {
+	// truncate servicecheckschemas, slaschemas, kothownershipschemas, and roundschemas with cascade
+	if err := db.Exec("TRUNCATE TABLE service_check_schemas, round_schemas, sla_schemas, score_bonus_schemas, check_override_schemas, koth_ownership_schemas, attack_penalty_schemas CASCADE").Error; err != nil {
 		return err
 	}
 
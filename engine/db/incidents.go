@@ -0,0 +1,132 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// IncidentReportSchema is a blue team's report of a compromise they detected.
+// Admins can link it to the attack it describes to give back part of the penalty.
+type IncidentReportSchema struct {
+	ID          uint
+	TeamID      uint
+	Team        TeamSchema
+	SubmittedAt time.Time
+	OccurredAt  time.Time
+	BoxName     string
+	Description string
+	Indicators  string
+	Remediation string
+	Attachments pq.StringArray `gorm:"type:text[]"` // submissions/incidents/teamID/reportID/file
+
+	AttackID   *uint `gorm:"uniqueIndex"` // an attack can only be reported for credit once
+	Award      int   // points given back, set when linked
+	ReviewedBy string
+	ReviewedAt time.Time
+}
+
+func CreateIncidentReport(report IncidentReportSchema) (IncidentReportSchema, error) {
+	result := db.Table("incident_report_schemas").Omit("Team").Create(&report)
+	if result.Error != nil {
+		return IncidentReportSchema{}, result.Error
+	}
+	return report, nil
+}
+
+func UpdateIncidentReportAttachments(id uint, attachments []string) error {
+	result := db.Table("incident_report_schemas").Where("id = ?", id).Update("attachments", pq.StringArray(attachments))
+	return result.Error
+}
+
+func DeleteIncidentReport(report IncidentReportSchema) error {
+	result := db.Table("incident_report_schemas").Delete(&report)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func GetIncidentReportByID(id uint) (IncidentReportSchema, error) {
+	var report IncidentReportSchema
+	result := db.Table("incident_report_schemas").First(&report, id)
+	if result.Error != nil {
+		return IncidentReportSchema{}, result.Error
+	}
+	return report, nil
+}
+
+// GetIncidentReports retrieves every report, newest first
+func GetIncidentReports() ([]IncidentReportSchema, error) {
+	var reports []IncidentReportSchema
+	result := db.Table("incident_report_schemas").Preload("Team", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name")
+	}).Order("submitted_at desc, id desc").Find(&reports)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return reports, nil
+		}
+		return nil, result.Error
+	}
+	return reports, nil
+}
+
+// GetTeamIncidentReports retrieves a team's reports, newest first
+func GetTeamIncidentReports(teamID uint) ([]IncidentReportSchema, error) {
+	var reports []IncidentReportSchema
+	result := db.Table("incident_report_schemas").Where("team_id = ?", teamID).Order("submitted_at desc, id desc").Find(&reports)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return reports, nil
+		}
+		return nil, result.Error
+	}
+	return reports, nil
+}
+
+// LinkIncidentReport links a report to the attack it describes and records the
+// award. A report can only be linked once.
+func LinkIncidentReport(report IncidentReportSchema) (IncidentReportSchema, error) {
+	result := db.Table("incident_report_schemas").Where("id = ? AND attack_id IS NULL", report.ID).Updates(map[string]any{
+		"attack_id":   report.AttackID,
+		"award":       report.Award,
+		"reviewed_by": report.ReviewedBy,
+		"reviewed_at": report.ReviewedAt,
+	})
+	if result.Error != nil {
+		return IncidentReportSchema{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return IncidentReportSchema{}, errors.New("incident report is already linked")
+	}
+	return report, nil
+}
+
+// linkedIncidentAwards selects every incident report award as (at, team_id, amount) rows
+const linkedIncidentAwards = `
+	SELECT reviewed_at AS at, team_id, award AS amount
+	FROM incident_report_schemas
+	WHERE attack_id IS NOT NULL
+`
+
+// GetIncidentAwardScores retrieves each team's total incident report awards
+func GetIncidentAwardScores() (map[uint]int, error) {
+	scores := make(map[uint]int)
+	rows, err := db.Raw(`SELECT team_id, SUM(amount) FROM (` + linkedIncidentAwards + `) i GROUP BY team_id`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID uint
+		var amount int
+		if err := rows.Scan(&teamID, &amount); err != nil {
+			return nil, err
+		}
+		scores[teamID] = amount
+	}
+	return scores, nil
+}
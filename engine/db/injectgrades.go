@@ -0,0 +1,99 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InjectGradeSchema is a grader's score for one version of a team's inject submission.
+// Only the highest graded version of a team's submission counts towards their score.
+type InjectGradeSchema struct {
+	ID       uint
+	InjectID uint `gorm:"uniqueIndex:idx_inject_team_version"`
+	Inject   InjectSchema
+	TeamID   uint `gorm:"uniqueIndex:idx_inject_team_version"`
+	Team     TeamSchema
+	Version  int `gorm:"uniqueIndex:idx_inject_team_version"`
+	Grader   string
+	Scores   []CriterionScore `gorm:"serializer:json"`
+	Comments string
+	Raw      int // points before the late penalty
+	Penalty  int // points taken off for lateness
+	Points   int // points awarded
+	GradedAt time.Time
+}
+
+// CriterionScore is the score for a single rubric criterion
+type CriterionScore struct {
+	Criterion string `json:"criterion"`
+	Points    int    `json:"points"`
+	Comment   string `json:"comment"`
+}
+
+// SaveInjectGrade creates a grade, or replaces it if that version was already graded
+func SaveInjectGrade(grade InjectGradeSchema) (InjectGradeSchema, error) {
+	result := db.Table("inject_grade_schemas").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "inject_id"}, {Name: "team_id"}, {Name: "version"}},
+		DoUpdates: clause.AssignmentColumns([]string{"grader", "scores", "comments", "raw", "penalty", "points", "graded_at"}),
+	}).Create(&grade)
+	if result.Error != nil {
+		return InjectGradeSchema{}, result.Error
+	}
+	return grade, nil
+}
+
+// GetInjectGrades retrieves every grade for an inject
+func GetInjectGrades(injectID uint) ([]InjectGradeSchema, error) {
+	var grades []InjectGradeSchema
+	result := db.Table("inject_grade_schemas").Where("inject_id = ?", injectID).Order("team_id, version").Find(&grades)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return grades, nil
+		}
+		return nil, result.Error
+	}
+	return grades, nil
+}
+
+// GetTeamInjectGrades retrieves a team's grades for an inject
+func GetTeamInjectGrades(injectID uint, teamID uint) ([]InjectGradeSchema, error) {
+	var grades []InjectGradeSchema
+	result := db.Table("inject_grade_schemas").Where("inject_id = ? AND team_id = ?", injectID, teamID).Order("version desc").Find(&grades)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return grades, nil
+		}
+		return nil, result.Error
+	}
+	return grades, nil
+}
+
+// latestInjectGrades selects the grade that counts for each inject and team
+const latestInjectGrades = `
+	SELECT DISTINCT ON (inject_id, team_id) inject_id, team_id, points, graded_at
+	FROM inject_grade_schemas
+	ORDER BY inject_id, team_id, version DESC
+`
+
+// GetInjectScores retrieves each team's total inject points
+func GetInjectScores() (map[uint]int, error) {
+	scores := make(map[uint]int)
+	rows, err := db.Raw(`SELECT team_id, SUM(points) FROM (` + latestInjectGrades + `) g GROUP BY team_id`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID uint
+		var points int
+		if err := rows.Scan(&teamID, &points); err != nil {
+			return nil, err
+		}
+		scores[teamID] = points
+	}
+	return scores, nil
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"math"
 	"time"
 
 	"github.com/lib/pq"
@@ -17,6 +18,48 @@ type InjectSchema struct {
 	CloseTime       time.Time
 	InjectFileNames pq.StringArray     `gorm:"type:text[]"`
 	Submissions     []SubmissionSchema `gorm:"foreignKey:InjectID"`
+
+	// grading
+	MaxPoints   int               // total points available, the sum of the rubric if there is one
+	Rubric      []RubricCriterion `gorm:"serializer:json"`
+	LatePolicy  string            // one of the LatePolicy constants
+	LatePenalty int               // percent of the score taken off a late submission
+}
+
+// RubricCriterion is a single line of an inject's rubric
+type RubricCriterion struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MaxPoints   int    `json:"max_points"`
+}
+
+// Submissions between the due time and the close time are late
+const (
+	LatePolicyNone   = "none"   // no penalty
+	LatePolicyFlat   = "flat"   // LatePenalty percent off as soon as it is late
+	LatePolicyLinear = "linear" // grows from nothing at the due time to LatePenalty percent at the close time
+)
+
+// LateDeduction returns how many points to take off a raw score for a submission made at the given time
+func (inject InjectSchema) LateDeduction(raw int, submitted time.Time) int {
+	if raw <= 0 || inject.LatePenalty <= 0 || !submitted.After(inject.DueTime) {
+		return 0
+	}
+
+	percent := float64(inject.LatePenalty)
+	switch inject.LatePolicy {
+	case LatePolicyFlat:
+	case LatePolicyLinear:
+		window := inject.CloseTime.Sub(inject.DueTime)
+		if window > 0 && submitted.Before(inject.CloseTime) {
+			percent *= float64(submitted.Sub(inject.DueTime)) / float64(window)
+		}
+	default:
+		return 0
+	}
+
+	deduction := int(math.Round(float64(raw) * min(percent, 100) / 100))
+	return min(deduction, raw)
 }
 
 // CreateInject creates a new inject in the database using the provided schema
@@ -60,9 +103,12 @@ func UpdateInject(inject InjectSchema) (InjectSchema, error) {
 	return inject, nil
 }
 
-// DeleteInject deletes an inject and its submissions from the database
+// DeleteInject deletes an inject and its submissions and grades from the database
 func DeleteInject(inject InjectSchema) error {
-	// Delete submissions first (foreign key constraint)
+	// Delete grades and submissions first (foreign key constraint)
+	if err := db.Table("inject_grade_schemas").Where("inject_id = ?", inject.ID).Delete(&InjectGradeSchema{}).Error; err != nil {
+		return err
+	}
 	if err := db.Table("submission_schemas").Where("inject_id = ?", inject.ID).Delete(&SubmissionSchema{}).Error; err != nil {
 		return err
 	}
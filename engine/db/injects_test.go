@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectLateDeduction(t *testing.T) {
+	due := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	closeTime := due.Add(4 * time.Hour)
+
+	tests := []struct {
+		name      string
+		policy    string
+		penalty   int
+		raw       int
+		submitted time.Time
+		expected  int
+	}{
+		{"on time", LatePolicyFlat, 50, 100, due.Add(-time.Minute), 0},
+		{"exactly at due time", LatePolicyFlat, 50, 100, due, 0},
+		{"no policy", LatePolicyNone, 50, 100, due.Add(time.Hour), 0},
+		{"unknown policy", "", 50, 100, due.Add(time.Hour), 0},
+		{"flat", LatePolicyFlat, 25, 100, due.Add(time.Minute), 25},
+		{"flat rounds", LatePolicyFlat, 10, 15, due.Add(time.Minute), 2},
+		{"linear halfway", LatePolicyLinear, 50, 100, due.Add(2 * time.Hour), 25},
+		{"linear at close", LatePolicyLinear, 50, 100, closeTime, 50},
+		{"linear after close", LatePolicyLinear, 50, 100, closeTime.Add(time.Hour), 50},
+		{"penalty over 100 percent caps at raw", LatePolicyFlat, 150, 40, due.Add(time.Minute), 40},
+		{"zero raw", LatePolicyFlat, 50, 0, due.Add(time.Minute), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inject := InjectSchema{DueTime: due, CloseTime: closeTime, LatePolicy: tt.policy, LatePenalty: tt.penalty}
+			assert.Equal(t, tt.expected, inject.LateDeduction(tt.raw, tt.submitted))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// KothOwnershipSchema records who held a box during a koth round
+type KothOwnershipSchema struct {
+	ID      uint
+	RoundID uint `gorm:"index"`
+	Round   RoundSchema
+	BoxName string `gorm:"index"`
+	TeamID  uint   // 0 when no team held the box
+	Token   string // token found on the box, kept even if it matched no team
+	Points  int    // points awarded to the owner for this round
+}
+
+func CreateKothOwnership(records []KothOwnershipSchema) error {
+	if len(records) == 0 {
+		return nil
+	}
+	result := db.Table("koth_ownership_schemas").Create(&records)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetKothOwnership retrieves the ownership history of every box ordered by round
+func GetKothOwnership() ([]KothOwnershipSchema, error) {
+	var records []KothOwnershipSchema
+	result := db.Table("koth_ownership_schemas").Order("round_id, box_name").Find(&records)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return records, nil
+		}
+		return nil, result.Error
+	}
+	return records, nil
+}
@@ -1,11 +1,109 @@
 package db
 
-import "time"
+import (
+	"errors"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// ManualAdjustmentSchema is an entry in a team's score ledger made by an admin.
+// Revoked adjustments are kept for the record but no longer count.
 type ManualAdjustmentSchema struct {
+	ID        uint
 	TeamID    uint
 	Team      TeamSchema
 	CreatedAt time.Time
-	Amount    int
+	Amount    int // positive awards points, negative takes them away
 	Reason    string
+	Author    string
+	Revoked   bool
+	RevokedAt time.Time
+	RevokedBy string
+}
+
+func CreateManualAdjustment(adjustment ManualAdjustmentSchema) (ManualAdjustmentSchema, error) {
+	result := db.Table("manual_adjustment_schemas").Omit("Team").Create(&adjustment)
+	if result.Error != nil {
+		return ManualAdjustmentSchema{}, result.Error
+	}
+	return adjustment, nil
+}
+
+// GetManualAdjustments retrieves every adjustment, newest first
+func GetManualAdjustments() ([]ManualAdjustmentSchema, error) {
+	var adjustments []ManualAdjustmentSchema
+	result := db.Table("manual_adjustment_schemas").Preload("Team", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name")
+	}).Order("created_at desc, id desc").Find(&adjustments)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return adjustments, nil
+		}
+		return nil, result.Error
+	}
+	return adjustments, nil
+}
+
+// GetTeamManualAdjustments retrieves a team's ledger, newest first
+func GetTeamManualAdjustments(teamID uint) ([]ManualAdjustmentSchema, error) {
+	var adjustments []ManualAdjustmentSchema
+	result := db.Table("manual_adjustment_schemas").Where("team_id = ?", teamID).Order("created_at desc, id desc").Find(&adjustments)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return adjustments, nil
+		}
+		return nil, result.Error
+	}
+	return adjustments, nil
+}
+
+// RevokeManualAdjustment marks an adjustment as revoked. Revoking twice is an error
+// so the original revoker stays on record.
+func RevokeManualAdjustment(id uint, revokedBy string) (ManualAdjustmentSchema, error) {
+	var adjustment ManualAdjustmentSchema
+	if result := db.Table("manual_adjustment_schemas").First(&adjustment, id); result.Error != nil {
+		return ManualAdjustmentSchema{}, result.Error
+	}
+	if adjustment.Revoked {
+		return adjustment, errors.New("adjustment already revoked")
+	}
+
+	adjustment.Revoked = true
+	adjustment.RevokedAt = time.Now()
+	adjustment.RevokedBy = revokedBy
+	result := db.Table("manual_adjustment_schemas").Where("id = ?", id).Updates(map[string]any{
+		"revoked":    adjustment.Revoked,
+		"revoked_at": adjustment.RevokedAt,
+		"revoked_by": adjustment.RevokedBy,
+	})
+	if result.Error != nil {
+		return ManualAdjustmentSchema{}, result.Error
+	}
+	return adjustment, nil
+}
+
+// GetManualAdjustmentScores retrieves each team's total of adjustments that haven't been revoked
+func GetManualAdjustmentScores() (map[uint]int, error) {
+	scores := make(map[uint]int)
+	rows, err := db.Raw(`
+		SELECT team_id, SUM(amount)
+		FROM manual_adjustment_schemas
+		WHERE revoked = false
+		GROUP BY team_id
+	`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID uint
+		var amount int
+		if err := rows.Scan(&teamID, &amount); err != nil {
+			return nil, err
+		}
+		scores[teamID] = amount
+	}
+	return scores, nil
 }
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// GetScoreHistory retrieves every round with the checks, SLA violations and
+// bonuses that were scored in it, oldest first. Check output is left out.
+func GetScoreHistory() ([]RoundSchema, error) {
+	var rounds []RoundSchema
+	result := db.Table("round_schemas").
+		Preload("Checks", func(db *gorm.DB) *gorm.DB {
+			return db.Select("team_id", "round_id", "service_name", "points", "earned", "result").Order("team_id, service_name")
+		}).
+		Preload("SLAs").
+		Preload("Bonuses").
+		Order("id").Find(&rounds)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return rounds, nil
+		}
+		return nil, result.Error
+	}
+	return rounds, nil
+}
+
+// SaveRescore replaces the scores of every round up to and including the given
+// one. Only checks and koth ownership whose points changed need to be passed in,
+// SLA violations and bonuses are replaced outright.
+func SaveRescore(upTo uint, checks []ServiceCheckSchema, slas []SLASchema, bonuses []ScoreBonusSchema, ownership []KothOwnershipSchema) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, check := range checks {
+			result := tx.Table("service_check_schemas").
+				Where("team_id = ? AND round_id = ? AND service_name = ?", check.TeamID, check.RoundID, check.ServiceName).
+				Updates(map[string]any{"points": check.Points, "earned": check.Earned})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if err := tx.Exec("DELETE FROM sla_schemas WHERE round_id <= ?", upTo).Error; err != nil {
+			return err
+		}
+		if len(slas) > 0 {
+			if err := tx.Table("sla_schemas").Omit("Round").CreateInBatches(&slas, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("DELETE FROM score_bonus_schemas WHERE round_id <= ?", upTo).Error; err != nil {
+			return err
+		}
+		if len(bonuses) > 0 {
+			if err := tx.Table("score_bonus_schemas").Omit("Round").CreateInBatches(&bonuses, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, record := range ownership {
+			if err := tx.Table("koth_ownership_schemas").Where("id = ?", record.ID).Update("points", record.Points).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -15,14 +15,76 @@ type ServiceCheckSchema struct {
 	Round       RoundSchema
 	ServiceName string
 	Points      int
+	Earned      int // points awarded by the scoring model
 	Result      bool
 	Error       string // error
 	Debug       string // informational
 }
 
+// ScoreBonusSchema is a bonus the scoring model awarded a team in a round, on top of its checks
+type ScoreBonusSchema struct {
+	ID      uint
+	RoundID uint `gorm:"index"`
+	Round   RoundSchema
+	TeamID  uint
+	BoxName string
+	Points  int
+}
+
+// GetScoreBonusScores retrieves each team's total scoring model bonuses
+func GetScoreBonusScores() (map[uint]int, error) {
+	scores := make(map[uint]int)
+	rows, err := db.Raw(`SELECT team_id, SUM(points) FROM score_bonus_schemas GROUP BY team_id`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID uint
+		var points int
+		if err := rows.Scan(&teamID, &points); err != nil {
+			return nil, err
+		}
+		scores[teamID] = points
+	}
+	return scores, nil
+}
+
+// LoadStreaks counts how many rounds in a row each team's services have been up
+func LoadStreaks(streaks map[uint]map[string]int) error {
+	rows, err := db.Raw(`
+		SELECT s.team_id, s.service_name, COUNT(*)
+		FROM service_check_schemas s
+		WHERE s.result = true AND s.round_id > COALESCE((
+			SELECT MAX(f.round_id) FROM service_check_schemas f
+			WHERE f.team_id = s.team_id AND f.service_name = s.service_name AND f.result = false
+		), 0)
+		GROUP BY s.team_id, s.service_name
+	`).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID uint
+		var service string
+		var streak int
+		if err := rows.Scan(&teamID, &service, &streak); err != nil {
+			return err
+		}
+		if _, ok := streaks[teamID]; !ok {
+			streaks[teamID] = make(map[string]int)
+		}
+		streaks[teamID][service] = streak
+	}
+	return rows.Err()
+}
+
 func GetServiceCheckSumByTeam() (map[uint]any, error) {
 	result := make(map[uint]any)
-	rows, err := db.Model(ServiceCheckSchema{}).Select("team_id, sum(points) as total").Group("team_id").Having("result = ?", true).Rows()
+	rows, err := db.Model(ServiceCheckSchema{}).Select("team_id, sum(earned) as total").Group("team_id").Rows()
 
 	if err != nil {
 		return nil, err
@@ -89,19 +151,77 @@ func GetServiceCheckSumByRound() ([]map[uint]int, error) {
 		result[roundidx][team] = points
 	}
 
-	rows, err = db.Table("sla_schemas").Select("round_id, team_id, sum(penalty) as penalty").Group("round_id, team_id").Rows()
-	if err != nil {
+	// sla penalties count against the round they happened in and every round after
+	if err := applyFromRound(result, `
+		SELECT round_id, team_id, -SUM(penalty)
+		FROM sla_schemas
+		GROUP BY round_id, team_id
+	`); err != nil {
+		return nil, err
+	}
+
+	// inject grades count from the round that was running when they were graded
+	if err := applyFromRound(result, byRoundAt(`
+		SELECT g.graded_at AS at, g.team_id, g.points AS amount
+		FROM (`+latestInjectGrades+`) g
+	`)); err != nil {
+		return nil, err
+	}
+
+	// manual adjustments count from the round that was running when they were made
+	if err := applyFromRound(result, byRoundAt(`
+		SELECT created_at AS at, team_id, amount
+		FROM manual_adjustment_schemas
+		WHERE revoked = false
+	`)); err != nil {
+		return nil, err
+	}
+
+	// red team penalties count from the round they were approved or taken in
+	if err := applyFromRound(result, byRoundAt(`
+		SELECT at, team_id, -amount AS amount
+		FROM (`+approvedAttackPenalties+`) p
+	`)); err != nil {
+		return nil, err
+	}
+
+	// incident report awards count from the round they were linked in
+	if err := applyFromRound(result, byRoundAt(linkedIncidentAwards)); err != nil {
 		return nil, err
 	}
 
+	return result, nil
+}
+
+// byRoundAt wraps a query returning (at, team_id, amount) rows so each amount is
+// totalled against the round that was running at that time, or the first round
+// if it happened before the competition started
+func byRoundAt(query string) string {
+	return `
+		SELECT round_id, team_id, SUM(amount) FROM (
+			SELECT COALESCE((SELECT MAX(r.id) FROM round_schemas r WHERE r.start_time <= x.at), 1) AS round_id, x.team_id, x.amount
+			FROM (` + query + `) x
+		) y
+		GROUP BY round_id, team_id
+	`
+}
+
+// applyFromRound runs a query returning (round_id, team_id, amount) rows and adds
+// each amount to that team's cumulative score from that round onward
+func applyFromRound(result []map[uint]int, query string, args ...any) error {
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return err
+	}
+
 	defer rows.Close()
 	for rows.Next() {
 		var id uint
 		var team uint
-		var penalty int
+		var amount int
 
-		if err := rows.Scan(&id, &team, &penalty); err != nil {
-			return nil, err
+		if err := rows.Scan(&id, &team, &amount); err != nil {
+			return err
 		}
 
 		// Validate id fits in int and is valid for array indexing
@@ -109,21 +229,17 @@ func GetServiceCheckSumByRound() ([]map[uint]int, error) {
 			continue // Skip invalid round IDs
 		}
 
-		roundidx := int(id) - 1
-		if result[roundidx] == nil {
-			result[roundidx] = make(map[uint]int)
-		}
-
 		// id starts at 1 so 0 index needs -1
+		roundidx := int(id) - 1
 		for i := roundidx; i < len(result); i++ {
 			if result[i] == nil {
 				result[i] = make(map[uint]int)
 			}
-			result[i][team] -= penalty
+			result[i][team] += amount
 		}
 	}
 
-	return result, nil
+	return rows.Err()
 }
 
 // GetServiceAllChecksByTeam returns all checks for a service, which is one per round
@@ -195,7 +311,7 @@ func GetServiceScores() ([]ServiceScoreData, error) {
 
 	// First get the total points per service per team
 	pointsRows, err := db.Raw(`
-		SELECT team_id, service_name, SUM(CASE WHEN result = true THEN points ELSE 0 END) as total_points
+		SELECT team_id, service_name, SUM(earned) as total_points
 		FROM service_check_schemas
 		GROUP BY team_id, service_name
 	`).Rows()
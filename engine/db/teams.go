@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"errors"
 	"log/slog"
 
@@ -115,10 +116,29 @@ func UpdateTeam(teamID uint, identifier string, active bool) error {
 	return nil
 }
 
+func UpdateTeamToken(teamID uint, token string) error {
+	result := db.Table("team_schemas").Where("id = ?", teamID).Update("token", token)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetTeamScore returns the points a team has earned from services, scoring bonuses,
+// injects, manual adjustments and incident reports less red team penalties, along
+// with their SLA violation count and total penalty
 func GetTeamScore(teamID uint) (int, int, int, error) {
-	// get service points
-	servicePoints := 0
-	rows, err := db.Raw("SELECT COALESCE(SUM(points), 0) FROM service_check_schemas WHERE team_id = ? and result = 't'", teamID).Rows()
+	// get earned points
+	earnedPoints := 0
+	rows, err := db.Raw(`
+		SELECT
+			(SELECT COALESCE(SUM(earned), 0) FROM service_check_schemas WHERE team_id = @team) +
+			(SELECT COALESCE(SUM(points), 0) FROM score_bonus_schemas WHERE team_id = @team) +
+			(SELECT COALESCE(SUM(points), 0) FROM (`+latestInjectGrades+`) g WHERE team_id = @team) +
+			(SELECT COALESCE(SUM(amount), 0) FROM manual_adjustment_schemas WHERE team_id = @team AND revoked = false) -
+			(SELECT COALESCE(SUM(amount), 0) FROM (`+approvedAttackPenalties+`) p WHERE team_id = @team) +
+			(SELECT COALESCE(SUM(amount), 0) FROM (`+linkedIncidentAwards+`) i WHERE team_id = @team)
+	`, sql.Named("team", teamID)).Rows()
 	if err != nil {
 		return 0, 0, 0, err
 	}
@@ -128,7 +148,7 @@ func GetTeamScore(teamID uint) (int, int, int, error) {
 		}
 	}()
 	for rows.Next() {
-		if err := rows.Scan(&servicePoints); err != nil {
+		if err := rows.Scan(&earnedPoints); err != nil {
 			slog.Error("failed to scan row", "error", err)
 			continue
 		}
@@ -138,7 +158,7 @@ func GetTeamScore(teamID uint) (int, int, int, error) {
 	var slas []SLASchema
 	if result := db.Table("sla_schemas").Where("team_id = ?", teamID).Find(&slas); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return servicePoints, 0, servicePoints, nil
+			return earnedPoints, 0, earnedPoints, nil
 		} else {
 			return 0, 0, 0, result.Error
 		}
@@ -149,5 +169,5 @@ func GetTeamScore(teamID uint) (int, int, int, error) {
 		slaPoints += sla.Penalty
 	}
 
-	return servicePoints, len(slas), slaPoints, nil
+	return earnedPoints, len(slas), slaPoints, nil
 }
@@ -16,6 +16,7 @@ import (
 	"quotient/engine/checks"
 	"quotient/engine/config"
 	"quotient/engine/db"
+	"quotient/engine/scoring"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -25,6 +26,7 @@ type ScoringEngine struct {
 	CredentialsMutex      map[uint]*sync.Mutex
 	UptimePerService      map[uint]map[string]db.Uptime
 	SlaPerService         map[uint]map[string]int
+	ScoreState            *scoring.State
 	EnginePauseWg         *sync.WaitGroup
 	IsEnginePaused        bool
 	CurrentRound          uint
@@ -35,6 +37,9 @@ type ScoringEngine struct {
 	// Concurrency control for materialized view refresh
 	Refreshing atomic.Bool
 
+	// Held while a round's results are saved, so rescoring doesn't race them
+	resultsMu sync.Mutex
+
 	// Config update handling
 	configPath string
 }
@@ -62,6 +67,7 @@ func NewEngine(conf *config.ConfigSettings, configPath string) *ScoringEngine {
 		CredentialsMutex: make(map[uint]*sync.Mutex),
 		UptimePerService: make(map[uint]map[string]db.Uptime),
 		SlaPerService:    make(map[uint]map[string]int),
+		ScoreState:       scoring.NewState(),
 		RedisClient:      rdb,
 		configPath:       configPath,
 	}
@@ -89,6 +95,11 @@ func (se *ScoringEngine) Start() {
 		slog.Error("failed to load SLAs", "error", err)
 	}
 
+	se.ScoreState = scoring.NewState()
+	if err := db.LoadStreaks(se.ScoreState.Streaks); err != nil {
+		slog.Error("failed to load uptime streaks", "error", err)
+	}
+
 	// load credentials
 	err := se.LoadCredentials()
 	if err != nil {
@@ -119,6 +130,11 @@ func (se *ScoringEngine) Start() {
 	defer events.Close()
 	eventsChannel := events.Channel()
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go se.collectReruns(backgroundCtx)
+	go se.watchRunners(backgroundCtx)
+
 	// engine loop
 	go func() {
 		for {
@@ -213,6 +229,12 @@ func (se *ScoringEngine) GetActiveTasks() (map[string]any, error) {
 		"all_runners": []any{},
 	}
 
+	pools, err := se.GetRunnerPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result["pools"] = pools
+
 	// Get all task keys using a single pattern
 	allKeys, err := se.RedisClient.Keys(ctx, "task:*").Result()
 	if err != nil {
@@ -298,9 +320,12 @@ func (se *ScoringEngine) ResetScores() error {
 		return fmt.Errorf("failed to reset scores: %v", err)
 	}
 
-	// Flush Redis queues
+	// Flush Redis queues, and the pinned host keys so rebuilt boxes start fresh
 	ctx := context.Background()
-	keysToDelete := []string{"tasks", "results"}
+	keysToDelete := []string{"results", "rerun_results", HostKeysKey}
+	for _, pool := range se.Config.RunnerPools() {
+		keysToDelete = append(keysToDelete, TaskQueue(pool))
+	}
 	for _, key := range keysToDelete {
 		if err := se.RedisClient.Del(ctx, key).Err(); err != nil {
 			slog.Error("Failed to clear Redis queue", "queue", key, "error", err)
@@ -314,6 +339,7 @@ func (se *ScoringEngine) ResetScores() error {
 	se.CurrentRound = 1
 	se.UptimePerService = make(map[uint]map[string]db.Uptime)
 	se.SlaPerService = make(map[uint]map[string]int)
+	se.ScoreState = scoring.NewState()
 	slog.Info("Scores reset and Redis queues cleared successfully")
 
 	return nil
@@ -321,37 +347,48 @@ func (se *ScoringEngine) ResetScores() error {
 
 // perform a round of koth
 func (se *ScoringEngine) koth() error {
-	// enginePauseWg.Wait()
+	se.scheduleNextRound()
 
-	// do koth stuff
-	return nil
-}
+	events := se.subscribeEvents()
+	defer events.Close()
 
-// perform a round of rvb
-func (se *ScoringEngine) rvb() error {
-	// reassign the next round start time with jitter
-	// double the jitter and subtract it to get a random number between -jitter and jitter
-	randomJitter := rand.Intn(2*se.Config.MiscSettings.Jitter) - se.Config.MiscSettings.Jitter // #nosec G404 -- non-crypto randomization for timing jitter
-	jitter := time.Duration(randomJitter) * time.Second
-	se.NextRoundStartTime = time.Now().Add(time.Duration(se.Config.MiscSettings.Delay) * time.Second).Add(jitter)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Until(se.NextRoundStartTime))
+	defer cancel()
 
-	slog.Info(fmt.Sprintf("round should take %s", time.Until(se.NextRoundStartTime).String()))
+	slog.Debug("Starting koth checks", "round", se.CurrentRound)
+	se.clearStaleTasks(ctx)
 
-	//
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "quotient_redis:6379"
+	// 1) Enqueue every box check once, there are no per team copies in koth
+	runners := 0
+	for _, r := range se.Config.AllChecks() {
+		if !r.Runnable() {
+			continue
+		}
+		if err := se.enqueueCheck(ctx, 0, "", r); err != nil {
+			slog.Error("failed to enqueue koth check", "service", r.GetName(), "error", err)
+			continue
+		}
+		runners++
 	}
+	slog.Info("Enqueued checks", "count", runners)
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: os.Getenv("REDIS_PASSWORD"),
-	})
+	// 2) Collect results from Redis
+	results, err := se.collectResults(ctx, events.Channel(), runners)
+	if err != nil {
+		return err
+	}
 
-	events := rdb.Subscribe(context.Background(), "events")
+	// 3) Award each box to whoever holds it
+	se.processKothResults(results)
+	return nil
+}
+
+// perform a round of rvb
+func (se *ScoringEngine) rvb() error {
+	se.scheduleNextRound()
+
+	events := se.subscribeEvents()
 	defer events.Close()
-	eventsChannel := events.Channel()
-	//
 
 	// do rvb stuff
 	teams, err := db.GetTeams()
@@ -376,11 +413,7 @@ func (se *ScoringEngine) rvb() error {
 	}
 
 	// Clear any stale tasks from previous rounds before enqueuing new ones
-	staleTasks := se.RedisClient.LLen(ctx, "tasks").Val()
-	if staleTasks > 0 {
-		slog.Warn("Clearing stale tasks from queue", "count", staleTasks, "round", se.CurrentRound)
-		se.RedisClient.Del(ctx, "tasks")
-	}
+	se.clearStaleTasks(ctx)
 
 	// 1) Enqueue
 	for _, team := range teams {
@@ -399,37 +432,128 @@ func (se *ScoringEngine) rvb() error {
 			if !enabled {
 				continue
 			}
-			// serialize the entire check definition to JSON
-			data, err := json.Marshal(r)
-			if err != nil {
-				slog.Error("failed to marshal check definition", "error", err)
+			if err := se.enqueueCheck(ctx, team.ID, team.Identifier, r); err != nil {
+				slog.Error("failed to enqueue service task", "team", team.ID, "service", r.GetName(), "error", err)
 				continue
 			}
+			runners++
+		}
+	}
+	slog.Info("Enqueued checks", "count", runners)
 
-			task := Task{
-				TeamID:         team.ID,
-				TeamIdentifier: team.Identifier,
-				ServiceType:    r.GetType(),
-				ServiceName:    r.GetName(),
-				RoundID:        se.CurrentRound,
-				Deadline:       se.NextRoundStartTime,
-				Attempts:       r.GetAttempts(),
-				CheckData:      data, // the entire specialized struct
-			}
+	// 2) Collect results from Redis
+	results, err := se.collectResults(ctx, events.Channel(), runners)
+	if err != nil {
+		return err
+	}
 
-			payload, err := json.Marshal(task)
-			if err != nil {
-				slog.Error("failed to marshal service task", "error", err)
+	// 3) Process all collected results
+	se.processCollectedResults(results)
+	return nil
+}
+
+// scheduleNextRound reassigns the next round start time with jitter
+func (se *ScoringEngine) scheduleNextRound() {
+	// double the jitter and subtract it to get a random number between -jitter and jitter
+	randomJitter := rand.Intn(2*se.Config.MiscSettings.Jitter) - se.Config.MiscSettings.Jitter // #nosec G404 -- non-crypto randomization for timing jitter
+	jitter := time.Duration(randomJitter) * time.Second
+	se.NextRoundStartTime = time.Now().Add(time.Duration(se.Config.MiscSettings.Delay) * time.Second).Add(jitter)
+
+	slog.Info(fmt.Sprintf("round should take %s", time.Until(se.NextRoundStartTime).String()))
+}
+
+// subscribeEvents opens a fresh subscription to the events channel so a round
+// can notice resets while it waits on results
+func (se *ScoringEngine) subscribeEvents() *redis.PubSub {
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "quotient_redis:6379"
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+
+	return rdb.Subscribe(context.Background(), "events")
+}
+
+// clearStaleTasks drops tasks left over from a previous round. Reruns aren't
+// tied to a round so they stay queued until their deadline.
+func (se *ScoringEngine) clearStaleTasks(ctx context.Context) {
+	for _, pool := range se.Config.RunnerPools() {
+		queue := TaskQueue(pool)
+		if se.RedisClient.LLen(ctx, queue).Val() == 0 {
+			continue
+		}
+
+		var queued *redis.StringSliceCmd
+		if _, err := se.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			queued = pipe.LRange(ctx, queue, 0, -1)
+			pipe.Del(ctx, queue)
+			return nil
+		}); err != nil {
+			slog.Error("failed to clear stale tasks", "queue", queue, "error", err)
+			continue
+		}
+
+		staleTasks := 0
+		for _, payload := range queued.Val() {
+			var task Task
+			if err := json.Unmarshal([]byte(payload), &task); err == nil && task.Rerun && time.Now().Before(task.Deadline) {
+				se.RedisClient.RPush(ctx, queue, payload)
 				continue
 			}
-			se.RedisClient.RPush(ctx, "tasks", payload)
-			runners++
+			staleTasks++
+		}
+		if staleTasks > 0 {
+			slog.Warn("Clearing stale tasks from queue", "count", staleTasks, "queue", queue, "round", se.CurrentRound)
 		}
 	}
-	slog.Info("Enqueued checks", "count", runners)
+}
 
-	// 2) Collect results from Redis
+// newTask serializes a check for a team into a task for the runners
+func newTask(teamID uint, teamIdentifier string, r checks.Runner) (Task, error) {
+	// serialize the entire check definition to JSON
+	data, err := json.Marshal(r)
+	if err != nil {
+		return Task{}, fmt.Errorf("failed to marshal check definition: %w", err)
+	}
+
+	return Task{
+		TeamID:         teamID,
+		TeamIdentifier: teamIdentifier,
+		ServiceType:    r.GetType(),
+		ServiceName:    r.GetName(),
+		Attempts:       r.GetAttempts(),
+		Pool:           checkPool(r),
+		CheckData:      data, // the entire specialized struct
+	}, nil
+}
+
+// enqueueCheck pushes a check for a team in the current round onto the task queue
+func (se *ScoringEngine) enqueueCheck(ctx context.Context, teamID uint, teamIdentifier string, r checks.Runner) error {
+	task, err := newTask(teamID, teamIdentifier, r)
+	if err != nil {
+		return err
+	}
+	task.RoundID = se.CurrentRound
+	task.Deadline = se.NextRoundStartTime
+
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal service task: %w", err)
+	}
+	return se.RedisClient.RPush(ctx, TaskQueue(task.Pool), payload).Err()
+}
+
+// collectResults waits for the expected number of results or the round deadline,
+// whichever comes first. A round that misses its deadline yields no results.
+func (se *ScoringEngine) collectResults(ctx context.Context, eventsChannel <-chan *redis.Message, runners int) ([]checks.Result, error) {
 	results := make([]checks.Result, 0, runners)
+	// a runner that was given up on as dead can still finish its checks after
+	// they were queued again, so only the first result for each check counts
+	seen := make(map[string]struct{}, runners)
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Until(se.NextRoundStartTime))
 	defer cancel()
 
@@ -441,7 +565,7 @@ COLLECTION:
 			slog.Info("Received message", "message", msg.Payload)
 			if msg.Payload == "reset" {
 				slog.Info("Reset event received, quitting...")
-				return fmt.Errorf("reset event received")
+				return nil, fmt.Errorf("reset event received")
 			} else {
 				continue
 			}
@@ -479,15 +603,19 @@ COLLECTION:
 				slog.Warn("Ignoring out of round result", "receivedRound", result.RoundID, "currentRound", se.CurrentRound)
 				continue
 			}
+			key := fmt.Sprintf("%d:%s", result.TeamID, result.ServiceName)
+			if _, ok := seen[key]; ok {
+				slog.Warn("Ignoring duplicate result", "team_id", result.TeamID, "service_name", result.ServiceName)
+				continue
+			}
+			seen[key] = struct{}{}
 			results = append(results, result)
 			i++
 			slog.Debug("service check finished", "round_id", result.RoundID, "team_id", result.TeamID, "service_name", result.ServiceName, "result", result.Status, "debug", result.Debug, "error", result.Error)
 		}
 	}
 
-	// 3) Process all collected results
-	se.processCollectedResults(results)
-	return nil
+	return results, nil
 }
 
 func sanitizeDBString(s string) string {
@@ -501,6 +629,9 @@ func sanitizeDBString(s string) string {
 }
 
 func (se *ScoringEngine) processCollectedResults(results []checks.Result) {
+	se.resultsMu.Lock()
+	defer se.resultsMu.Unlock()
+
 	if len(results) == 0 {
 		slog.Warn("No results collected for round", "round", se.CurrentRound)
 		return
@@ -525,60 +656,60 @@ func (se *ScoringEngine) processCollectedResults(results []checks.Result) {
 		return
 	}
 
+	bonuses := se.scoreRound(dbResults)
+
 	// Save results to database
 	round := db.RoundSchema{
 		ID:        uint(se.CurrentRound),
 		StartTime: se.CurrentRoundStartTime,
 		Checks:    dbResults,
+		Bonuses:   bonuses,
 	}
 	if _, err := db.CreateRound(round); err != nil {
 		slog.Error("failed to create round:", "round", se.CurrentRound, "error", err)
 		return
 	}
+	se.recordStreaks(dbResults)
 
 	for _, result := range results {
 		// Update uptime and SLA maps
-		if _, ok := se.UptimePerService[result.TeamID]; !ok {
-			se.UptimePerService[result.TeamID] = make(map[string]db.Uptime)
-		}
-		if _, ok := se.UptimePerService[result.TeamID][result.ServiceName]; !ok {
-			se.UptimePerService[result.TeamID][result.ServiceName] = db.Uptime{}
-		}
-		newUptime := se.UptimePerService[result.TeamID][result.ServiceName]
-		if result.Status {
-			newUptime.PassedChecks++
-		}
-		newUptime.TotalChecks++
-		se.UptimePerService[result.TeamID][result.ServiceName] = newUptime
-
-		if _, ok := se.SlaPerService[result.TeamID]; !ok {
-			se.SlaPerService[result.TeamID] = make(map[string]int)
-		}
-		if _, ok := se.SlaPerService[result.TeamID][result.ServiceName]; !ok {
-			se.SlaPerService[result.TeamID][result.ServiceName] = 0
-		}
-		if result.Status {
-			se.SlaPerService[result.TeamID][result.ServiceName] = 0
-		} else {
-			se.SlaPerService[result.TeamID][result.ServiceName]++
-			if se.SlaPerService[result.TeamID][result.ServiceName] >= se.Config.MiscSettings.SlaThreshold {
-				sla := db.SLASchema{
-					TeamID:      result.TeamID,
-					ServiceName: result.ServiceName,
-					RoundID:     uint(se.CurrentRound),
-					Penalty:     se.Config.MiscSettings.SlaPenalty,
-				}
-				if _, err := db.CreateSLA(sla); err != nil {
-					slog.Error("failed to create SLA", "team", result.TeamID, "service", result.ServiceName, "error", err)
-				}
-				se.SlaPerService[result.TeamID][result.ServiceName] = 0
+		se.recordUptime(result.TeamID, result.ServiceName, result.Status)
+
+		if countSLA(se.SlaPerService, result.TeamID, result.ServiceName, result.Status, se.Config.MiscSettings.SlaThreshold) {
+			sla := db.SLASchema{
+				TeamID:      result.TeamID,
+				ServiceName: result.ServiceName,
+				RoundID:     uint(se.CurrentRound),
+				Penalty:     se.Config.MiscSettings.SlaPenalty,
+			}
+			if _, err := db.CreateSLA(sla); err != nil {
+				slog.Error("failed to create SLA", "team", result.TeamID, "service", result.ServiceName, "error", err)
 			}
 		}
 	}
 
+	se.takeAttackPenalties()
+
 	slog.Debug("Successfully processed results for round", "round", se.CurrentRound, "total", len(dbResults))
 
-	// Refresh materialized view asynchronously, but avoid concurrent refreshes
+	se.refreshScores()
+}
+
+// recordUptime counts a check against a team's uptime for a service
+func (se *ScoringEngine) recordUptime(teamID uint, serviceName string, status bool) {
+	if _, ok := se.UptimePerService[teamID]; !ok {
+		se.UptimePerService[teamID] = make(map[string]db.Uptime)
+	}
+	newUptime := se.UptimePerService[teamID][serviceName]
+	if status {
+		newUptime.PassedChecks++
+	}
+	newUptime.TotalChecks++
+	se.UptimePerService[teamID][serviceName] = newUptime
+}
+
+// refreshScores refreshes the materialized view asynchronously, but avoids concurrent refreshes
+func (se *ScoringEngine) refreshScores() {
 	currentRound := se.CurrentRound
 	if se.Refreshing.CompareAndSwap(false, true) {
 		go func(round uint) {
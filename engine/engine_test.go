@@ -565,3 +565,34 @@ func TestRvb_HandlesMultipleServices(t *testing.T) {
 	}
 	assert.Equal(t, 30, totalPoints)
 }
+
+func TestResetScores_ClearsQueuesAndHostKeys(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	redis := testutil.StartRedis(t)
+	defer redis.Close()
+
+	pg := testutil.StartPostgres(t)
+	defer pg.Close()
+	db.Connect(pg.ConnectionString())
+
+	ctx := context.Background()
+	redis.Client.FlushDB(ctx)
+
+	engine := newTestEngine(t, redis, 3)
+	engine.CurrentRound = 5
+	require.NoError(t, redis.Client.RPush(ctx, "results", "{}").Err())
+	require.NoError(t, redis.Client.RPush(ctx, "tasks", "{}").Err())
+	require.NoError(t, redis.Client.HSet(ctx, HostKeysKey, HostKeyField(1, "box01-ssh"), "ssh-ed25519 AAAA").Err())
+
+	require.NoError(t, engine.ResetScores())
+
+	for _, key := range []string{"results", "tasks", HostKeysKey} {
+		exists, err := redis.Client.Exists(ctx, key).Result()
+		require.NoError(t, err)
+		assert.Zero(t, exists, "%s should be cleared", key)
+	}
+	assert.Equal(t, uint(1), engine.CurrentRound)
+}
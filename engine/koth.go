@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"log/slog"
+
+	"quotient/engine/checks"
+	"quotient/engine/config"
+	"quotient/engine/db"
+	"quotient/engine/scoring"
+)
+
+// kothOwner works out which team holds a box. The first passing ownership check
+// (in config order) whose token belongs to a team decides it. The token that was
+// read is returned even if it didn't match, so admins can see what's on the box.
+func kothOwner(box config.Box, results map[string]checks.Result, tokens map[string]uint) (uint, string) {
+	seen := ""
+	for _, r := range box.Runners {
+		result, ok := results[r.GetName()]
+		if !ok || !result.Status || result.Owner == "" {
+			continue
+		}
+		if teamID, ok := tokens[result.Owner]; ok {
+			return teamID, result.Owner
+		}
+		if seen == "" {
+			seen = result.Owner
+		}
+	}
+	return 0, seen
+}
+
+func (se *ScoringEngine) processKothResults(results []checks.Result) {
+	se.resultsMu.Lock()
+	defer se.resultsMu.Unlock()
+
+	if len(results) == 0 {
+		slog.Warn("No results collected for round", "round", se.CurrentRound)
+		return
+	}
+
+	teams, err := db.GetTeams()
+	if err != nil {
+		slog.Error("failed to get teams:", "error", err)
+		return
+	}
+	tokens := make(map[string]uint, len(teams))
+	for _, team := range teams {
+		if team.Active && team.Token != "" {
+			tokens[team.Token] = team.ID
+		}
+	}
+
+	resultsByName := make(map[string]checks.Result, len(results))
+	for _, result := range results {
+		resultsByName[result.ServiceName] = result
+	}
+
+	dbResults := []db.ServiceCheckSchema{}
+	ownership := []db.KothOwnershipSchema{}
+	for _, box := range se.Config.Box {
+		owner, token := kothOwner(box, resultsByName, tokens)
+		record := db.KothOwnershipSchema{
+			RoundID: se.CurrentRound,
+			BoxName: box.Name,
+			TeamID:  owner,
+			Token:   sanitizeDBString(token),
+		}
+
+		// the owner earns every service on the box that is up
+		if owner != 0 {
+			for _, r := range box.Runners {
+				result, ok := resultsByName[r.GetName()]
+				if !ok {
+					continue
+				}
+				dbResults = append(dbResults, db.ServiceCheckSchema{
+					TeamID:      owner,
+					RoundID:     se.CurrentRound,
+					ServiceName: sanitizeDBString(result.ServiceName),
+					Points:      result.Points,
+					Result:      result.Status,
+					Error:       sanitizeDBString(result.Error),
+					Debug:       sanitizeDBString(result.Debug),
+				})
+				se.recordUptime(owner, result.ServiceName, result.Status)
+			}
+		}
+
+		ownership = append(ownership, record)
+	}
+
+	// a box is worth whatever the scoring model gave its owner for it
+	if se.ScoreState == nil {
+		se.ScoreState = scoring.NewState()
+	}
+	scorer := se.newScorer()
+	bonuses := scorer.score(se.CurrentRound, se.CurrentRoundStartTime, dbResults, se.ScoreState)
+	earned := scorer.kothPoints(dbResults, bonuses)
+	for i := range ownership {
+		ownership[i].Points = earned[ownership[i].BoxName]
+		slog.Debug("koth box ownership", "round", se.CurrentRound, "box", ownership[i].BoxName, "owner", ownership[i].TeamID, "points", ownership[i].Points)
+	}
+
+	// the round is saved even if nobody owns anything so round ids stay contiguous
+	round := db.RoundSchema{
+		ID:        se.CurrentRound,
+		StartTime: se.CurrentRoundStartTime,
+		Checks:    dbResults,
+		Bonuses:   bonuses,
+	}
+	if _, err := db.CreateRound(round); err != nil {
+		slog.Error("failed to create round:", "round", se.CurrentRound, "error", err)
+		return
+	}
+	se.recordStreaks(dbResults)
+	if err := db.CreateKothOwnership(ownership); err != nil {
+		slog.Error("failed to save koth ownership", "round", se.CurrentRound, "error", err)
+	}
+
+	se.refreshScores()
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"testing"
+
+	"quotient/engine/checks"
+	"quotient/engine/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKothOwner(t *testing.T) {
+	box := config.Box{
+		Name: "hill",
+		Runners: []checks.Runner{
+			&checks.Web{Service: checks.Service{Name: "hill-web"}},
+			&checks.Custom{Service: checks.Service{Name: "hill-flag"}},
+		},
+	}
+	tokens := map[string]uint{"alpha": 1, "bravo": 2}
+
+	tests := []struct {
+		name          string
+		results       map[string]checks.Result
+		expectedOwner uint
+		expectedToken string
+	}{
+		{
+			name:    "no results",
+			results: map[string]checks.Result{},
+		},
+		{
+			name: "token matches a team",
+			results: map[string]checks.Result{
+				"hill-web": {ServiceName: "hill-web", Status: true, Owner: "bravo"},
+			},
+			expectedOwner: 2,
+			expectedToken: "bravo",
+		},
+		{
+			name: "failed check doesn't count",
+			results: map[string]checks.Result{
+				"hill-web": {ServiceName: "hill-web", Status: false, Owner: "alpha"},
+			},
+		},
+		{
+			name: "unknown token is reported without an owner",
+			results: map[string]checks.Result{
+				"hill-web": {ServiceName: "hill-web", Status: true, Owner: "charlie"},
+			},
+			expectedToken: "charlie",
+		},
+		{
+			name: "later check can still claim the box",
+			results: map[string]checks.Result{
+				"hill-web":  {ServiceName: "hill-web", Status: true, Owner: "charlie"},
+				"hill-flag": {ServiceName: "hill-flag", Status: true, Owner: "alpha"},
+			},
+			expectedOwner: 1,
+			expectedToken: "alpha",
+		},
+		{
+			name: "first matching check in config order wins",
+			results: map[string]checks.Result{
+				"hill-web":  {ServiceName: "hill-web", Status: true, Owner: "bravo"},
+				"hill-flag": {ServiceName: "hill-flag", Status: true, Owner: "alpha"},
+			},
+			expectedOwner: 2,
+			expectedToken: "bravo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, token := kothOwner(box, tt.results, tokens)
+			assert.Equal(t, tt.expectedOwner, owner)
+			assert.Equal(t, tt.expectedToken, token)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"quotient/engine/checks"
+	"quotient/engine/db"
+	"quotient/engine/scoring"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// rerunSettle is how long rerun results are left to come in before the score
+// views are refreshed, so rerunning a whole round only refreshes them once
+const rerunSettle = 5 * time.Second
+
+var ErrNoChecks = errors.New("no stored checks to rerun")
+
+// RerunCheck runs a team's check from an earlier round again. The stored result
+// is replaced when the rerun comes back.
+func (se *ScoringEngine) RerunCheck(roundID uint, teamID uint, serviceName string, requestedBy string) (db.CheckOverrideSchema, error) {
+	roundChecks, err := db.GetRoundChecks(roundID)
+	if err != nil {
+		return db.CheckOverrideSchema{}, err
+	}
+	for _, check := range roundChecks {
+		if check.TeamID == teamID && check.ServiceName == serviceName {
+			overrides, err := se.rerun([]db.ServiceCheckSchema{check}, requestedBy)
+			if err != nil {
+				return db.CheckOverrideSchema{}, err
+			}
+			if len(overrides) == 0 {
+				return db.CheckOverrideSchema{}, fmt.Errorf("%s is no longer in the config", serviceName)
+			}
+			return overrides[0], nil
+		}
+	}
+	return db.CheckOverrideSchema{}, ErrNoChecks
+}
+
+// RerunRound runs every check from an earlier round again. Checks that are no
+// longer in the config are skipped.
+func (se *ScoringEngine) RerunRound(roundID uint, requestedBy string) ([]db.CheckOverrideSchema, error) {
+	roundChecks, err := db.GetRoundChecks(roundID)
+	if err != nil {
+		return nil, err
+	}
+	if len(roundChecks) == 0 {
+		return nil, ErrNoChecks
+	}
+	return se.rerun(roundChecks, requestedBy)
+}
+
+// rerun records an override for each check and puts it at the front of the task
+// queue, flagged so the runner sends the result back separately
+func (se *ScoringEngine) rerun(stored []db.ServiceCheckSchema, requestedBy string) ([]db.CheckOverrideSchema, error) {
+	if se.Config.RequiredSettings.EventType == "koth" {
+		return nil, errors.New("reruns aren't supported for koth events")
+	}
+
+	runners := make(map[string]checks.Runner)
+	for _, r := range se.Config.AllChecks() {
+		runners[r.GetName()] = r
+	}
+	teams, err := db.GetTeams()
+	if err != nil {
+		return nil, err
+	}
+	identifiers := make(map[uint]string, len(teams))
+	for _, team := range teams {
+		identifiers[team.ID] = team.Identifier
+	}
+
+	ctx := context.Background()
+	deadline := time.Now().Add(time.Duration(se.Config.MiscSettings.Delay) * time.Second)
+	overrides := []db.CheckOverrideSchema{}
+	for _, check := range stored {
+		r, ok := runners[check.ServiceName]
+		if !ok {
+			slog.Warn("skipping rerun of check that is no longer in the config", "round", check.RoundID, "service", check.ServiceName)
+			continue
+		}
+
+		task, err := newTask(check.TeamID, identifiers[check.TeamID], r)
+		if err != nil {
+			return overrides, err
+		}
+		task.RoundID = check.RoundID
+		task.Deadline = deadline
+		task.Rerun = true
+		payload, err := json.Marshal(task)
+		if err != nil {
+			return overrides, fmt.Errorf("failed to marshal service task: %w", err)
+		}
+
+		override, err := db.CreateCheckOverride(db.CheckOverrideSchema{
+			RoundID:     check.RoundID,
+			TeamID:      check.TeamID,
+			ServiceName: check.ServiceName,
+			RequestedBy: requestedBy,
+			RequestedAt: time.Now(),
+			OldResult:   check.Result,
+		})
+		if err != nil {
+			return overrides, err
+		}
+		if err := se.RedisClient.LPush(ctx, TaskQueue(task.Pool), payload).Err(); err != nil {
+			return overrides, fmt.Errorf("failed to enqueue rerun: %w", err)
+		}
+		overrides = append(overrides, override)
+	}
+
+	slog.Info("checks queued for rerun", "count", len(overrides), "by", requestedBy)
+	return overrides, nil
+}
+
+// collectReruns saves rerun results as they come back. Once they stop coming in,
+// the score views are refreshed to show the new results.
+func (se *ScoringEngine) collectReruns(ctx context.Context) {
+	changed := false
+	for {
+		val, err := se.RedisClient.BLPop(ctx, rerunSettle, "rerun_results").Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == redis.Nil {
+			if changed {
+				if err := db.RefreshScoresMaterializedView(); err != nil {
+					slog.Error("failed to refresh materialized view after reruns", "error", err)
+				}
+				changed = false
+			}
+			continue
+		} else if err != nil {
+			slog.Error("Failed to fetch rerun results from Redis:", "error", err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		// val[0] = "rerun_results", val[1] = JSON checks.Result
+		if len(val) < 2 {
+			slog.Warn("Malformed rerun result from Redis", "val", val)
+			continue
+		}
+		var result checks.Result
+		if err := json.Unmarshal([]byte(val[1]), &result); err != nil {
+			slog.Error("Failed to unmarshal rerun result", "error", err)
+			continue
+		}
+		if se.applyRerun(result) {
+			changed = true
+		}
+	}
+}
+
+// applyRerun saves a rerun result over the stored check. If the result changed,
+// the uptime and the rows scored from the check are fixed up to match.
+func (se *ScoringEngine) applyRerun(result checks.Result) bool {
+	se.resultsMu.Lock()
+	defer se.resultsMu.Unlock()
+
+	old, err := db.CompleteCheckOverride(db.ServiceCheckSchema{
+		TeamID:      result.TeamID,
+		RoundID:     result.RoundID,
+		ServiceName: sanitizeDBString(result.ServiceName),
+		Result:      result.Status,
+		Error:       sanitizeDBString(result.Error),
+		Debug:       sanitizeDBString(result.Debug),
+	})
+	if err != nil {
+		slog.Error("failed to save rerun result", "round", result.RoundID, "team", result.TeamID, "service", result.ServiceName, "error", err)
+		return false
+	}
+
+	// the check was already counted, so only a changed result moves the uptime
+	if old.Result != result.Status {
+		if _, ok := se.UptimePerService[result.TeamID]; !ok {
+			se.UptimePerService[result.TeamID] = make(map[string]db.Uptime)
+		}
+		uptime := se.UptimePerService[result.TeamID][result.ServiceName]
+		if result.Status {
+			uptime.PassedChecks++
+		} else {
+			uptime.PassedChecks--
+		}
+		se.UptimePerService[result.TeamID][result.ServiceName] = uptime
+
+		if err := se.rescoreRerun(old, result.Status); err != nil {
+			slog.Error("failed to rescore rerun check", "round", result.RoundID, "team", result.TeamID, "service", result.ServiceName, "error", err)
+		}
+	}
+
+	slog.Info("check rerun finished", "round", result.RoundID, "team", result.TeamID, "service", result.ServiceName, "was", old.Result, "now", result.Status)
+	return true
+}
+
+// rescoreRerun recomputes what a check's new result feeds into: the points the
+// check earned, and its service's SLA violations and uptime streak from that
+// round on. Other checks keep their points, even in later rounds whose streak
+// bonus depended on this one, and the config isn't applied to anything else.
+// That's left to a full Rescore.
+func (se *ScoringEngine) rescoreRerun(old db.ServiceCheckSchema, passed bool) error {
+	history, err := db.GetServiceAllChecksByTeam(old.TeamID, old.ServiceName)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(history)
+
+	check := old
+	check.Result = passed
+	state := scoring.NewState()
+	slaCounts := make(map[uint]map[string]int)
+	slas := []db.SLASchema{}
+	for _, stored := range history {
+		if stored.RoundID == check.RoundID {
+			// points stay what they were when the round ran, only the result is new
+			stored.Result = passed
+			scored := []db.ServiceCheckSchema{check}
+			se.newScorer().score(check.RoundID, stored.Round.StartTime, scored, state)
+			check.Earned = scored[0].Earned
+		}
+		recordStreaks(state, []db.ServiceCheckSchema{stored})
+
+		if countSLA(slaCounts, check.TeamID, check.ServiceName, stored.Result, se.Config.MiscSettings.SlaThreshold) && stored.RoundID >= check.RoundID {
+			slas = append(slas, db.SLASchema{
+				TeamID:      check.TeamID,
+				RoundID:     stored.RoundID,
+				ServiceName: check.ServiceName,
+				Penalty:     se.Config.MiscSettings.SlaPenalty,
+			})
+		}
+	}
+
+	if err := db.SaveRerunScore(check, slas); err != nil {
+		return err
+	}
+
+	if _, ok := se.SlaPerService[check.TeamID]; !ok {
+		se.SlaPerService[check.TeamID] = make(map[string]int)
+	}
+	se.SlaPerService[check.TeamID][check.ServiceName] = slaCounts[check.TeamID][check.ServiceName]
+	if se.ScoreState == nil {
+		se.ScoreState = scoring.NewState()
+	}
+	if _, ok := se.ScoreState.Streaks[check.TeamID]; !ok {
+		se.ScoreState.Streaks[check.TeamID] = make(map[string]int)
+	}
+	se.ScoreState.Streaks[check.TeamID][check.ServiceName] = state.Streak(check.TeamID, check.ServiceName)
+	return nil
+}
@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"quotient/engine/checks"
+	"quotient/engine/config"
+	"quotient/engine/db"
+	"quotient/tests/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearStaleTasks_KeepsReruns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	redis := testutil.StartRedis(t)
+	defer redis.Close()
+
+	ctx := context.Background()
+	redis.Client.FlushDB(ctx)
+
+	engine := newTestEngine(t, redis, 3)
+	for _, task := range []Task{
+		{ServiceName: "stale", RoundID: 1, Deadline: time.Now().Add(time.Minute)},
+		{ServiceName: "rerun", RoundID: 1, Deadline: time.Now().Add(time.Minute), Rerun: true},
+		{ServiceName: "expired-rerun", RoundID: 1, Deadline: time.Now().Add(-time.Minute), Rerun: true},
+	} {
+		payload, err := json.Marshal(task)
+		require.NoError(t, err)
+		require.NoError(t, redis.Client.RPush(ctx, "tasks", payload).Err())
+	}
+
+	engine.clearStaleTasks(ctx)
+
+	queued, err := redis.Client.LRange(ctx, "tasks", 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	var task Task
+	require.NoError(t, json.Unmarshal([]byte(queued[0]), &task))
+	assert.Equal(t, "rerun", task.ServiceName)
+}
+
+func TestRerunCheck_OverridesStoredResult(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	redis := testutil.StartRedis(t)
+	defer redis.Close()
+
+	pg := testutil.StartPostgres(t)
+	defer pg.Close()
+	db.Connect(pg.ConnectionString())
+
+	ctx := context.Background()
+	redis.Client.FlushDB(ctx)
+	db.ResetScores()
+
+	team := createTestTeam(t, "Team Rerun", "01")
+
+	engine := newTestEngine(t, redis, 1)
+	engine.Config.Box = []config.Box{{
+		Name: "box01",
+		Runners: []checks.Runner{&mockRunner{Service: checks.Service{
+			Display:     "web",
+			Name:        "box01-web",
+			ServiceType: "Mock",
+			Points:      10,
+		}}},
+	}}
+	engine.CurrentRound = 1
+	engine.CurrentRoundStartTime = time.Now()
+
+	// the check failed during the round, which was an SLA violation
+	engine.processCollectedResults([]checks.Result{
+		{TeamID: team.ID, ServiceName: "box01-web", ServiceType: "Mock", RoundID: 1, Status: false, Points: 10},
+	})
+	_, slaCount, slaPenalty, err := db.GetTeamScore(team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, slaCount)
+	assert.Equal(t, 30, slaPenalty)
+
+	override, err := engine.RerunCheck(1, team.ID, "box01-web", "admin")
+	require.NoError(t, err)
+	assert.False(t, override.Completed)
+	assert.False(t, override.OldResult)
+
+	// the rerun is flagged and goes to the front of the queue
+	payload, err := redis.Client.LPop(ctx, "tasks").Result()
+	require.NoError(t, err)
+	var task Task
+	require.NoError(t, json.Unmarshal([]byte(payload), &task))
+	assert.True(t, task.Rerun)
+	assert.Equal(t, uint(1), task.RoundID)
+	assert.Equal(t, team.ID, task.TeamID)
+
+	// config changes since the round only apply once an admin runs Rescore
+	engine.Config.Box[0].Runners[0].(*mockRunner).Points = 50
+
+	require.True(t, engine.applyRerun(checks.Result{TeamID: team.ID, ServiceName: "box01-web", RoundID: 1, Status: true}))
+
+	earned, slaCount, slaPenalty, err := db.GetTeamScore(team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 10, earned)
+	assert.Equal(t, 0, slaCount)
+	assert.Equal(t, 0, slaPenalty)
+	assert.Equal(t, 0, engine.SlaPerService[team.ID]["box01-web"])
+	assert.Equal(t, 1, engine.ScoreState.Streak(team.ID, "box01-web"))
+	assert.Equal(t, 1, engine.UptimePerService[team.ID]["box01-web"].PassedChecks)
+	assert.Equal(t, 1, engine.UptimePerService[team.ID]["box01-web"].TotalChecks)
+
+	overrides, err := db.GetCheckOverrides()
+	require.NoError(t, err)
+	require.Len(t, overrides, 1)
+	assert.True(t, overrides[0].Completed)
+	assert.True(t, overrides[0].NewResult)
+
+	// a result nobody asked for is ignored
+	assert.False(t, engine.applyRerun(checks.Result{TeamID: team.ID, ServiceName: "box01-web", RoundID: 1, Status: false}))
+}
+
+func TestCollectReruns_OnlyChangesRerunRound(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	redis := testutil.StartRedis(t)
+	defer redis.Close()
+
+	pg := testutil.StartPostgres(t)
+	defer pg.Close()
+	db.Connect(pg.ConnectionString())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	redis.Client.FlushDB(ctx)
+	db.ResetScores()
+
+	team := createTestTeam(t, "Team Collect", "01")
+
+	engine := newTestEngine(t, redis, 3)
+	engine.Config.Box = []config.Box{{
+		Name: "box01",
+		Runners: []checks.Runner{&mockRunner{Service: checks.Service{
+			Display:     "web",
+			Name:        "box01-web",
+			ServiceType: "Mock",
+			Points:      10,
+		}}},
+	}}
+
+	// the check failed in round 1 and passed in round 2
+	for _, round := range []struct {
+		id     uint
+		status bool
+	}{{1, false}, {2, true}} {
+		engine.CurrentRound = round.id
+		engine.CurrentRoundStartTime = time.Now()
+		engine.processCollectedResults([]checks.Result{
+			{TeamID: team.ID, ServiceName: "box01-web", ServiceType: "Mock", RoundID: round.id, Status: round.status, Points: 10},
+		})
+	}
+
+	_, err := engine.RerunCheck(1, team.ID, "box01-web", "admin")
+	require.NoError(t, err)
+	require.NoError(t, redis.Client.Del(ctx, "tasks").Err())
+
+	// a config change that only a full Rescore should apply to the other rounds
+	engine.Config.Box[0].Runners[0].(*mockRunner).Points = 50
+
+	go engine.collectReruns(ctx)
+
+	payload, err := json.Marshal(checks.Result{TeamID: team.ID, ServiceName: "box01-web", ServiceType: "Mock", RoundID: 1, Status: true})
+	require.NoError(t, err)
+	require.NoError(t, redis.Client.RPush(ctx, "rerun_results", payload).Err())
+
+	// the view is refreshed once the results stop coming in
+	assert.Eventually(t, func() bool {
+		sums, err := db.GetServiceCheckSumByRound()
+		return err == nil && len(sums) == 2 && sums[0][team.ID] == 10
+	}, 3*rerunSettle, 500*time.Millisecond)
+
+	roundOne, err := db.GetRoundChecks(1)
+	require.NoError(t, err)
+	require.Len(t, roundOne, 1)
+	assert.True(t, roundOne[0].Result)
+	assert.Equal(t, 10, roundOne[0].Earned)
+
+	roundTwo, err := db.GetRoundChecks(2)
+	require.NoError(t, err)
+	require.Len(t, roundTwo, 1)
+	assert.True(t, roundTwo[0].Result)
+	assert.Equal(t, 10, roundTwo[0].Earned)
+
+	sums, err := db.GetServiceCheckSumByRound()
+	require.NoError(t, err)
+	require.Len(t, sums, 2)
+	assert.Equal(t, 20, sums[1][team.ID])
+}
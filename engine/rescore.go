@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"quotient/engine/db"
+	"quotient/engine/scoring"
+)
+
+// RescoreTotals are the parts of a team's score that a rescore rebuilds
+type RescoreTotals struct {
+	ServicePoints int `json:"service_points"`
+	BonusPoints   int `json:"bonus_points"`
+	SlaViolations int `json:"sla_violations"`
+	SlaPenalty    int `json:"sla_penalty"`
+	Total         int `json:"total"`
+}
+
+// RescoreDiff is a team's score before and after a rescore
+type RescoreDiff struct {
+	TeamID   uint          `json:"team_id"`
+	TeamName string        `json:"team_name"`
+	Before   RescoreTotals `json:"before"`
+	After    RescoreTotals `json:"after"`
+	Change   int           `json:"change"`
+}
+
+type RescoreReport struct {
+	DryRun        bool          `json:"dry_run"`
+	Rounds        int           `json:"rounds"`
+	ChangedChecks int           `json:"changed_checks"`
+	Teams         []RescoreDiff `json:"teams"`
+}
+
+// rescored is the result of replaying the stored check results
+type rescored struct {
+	checks    []db.ServiceCheckSchema // checks whose points changed
+	slas      []db.SLASchema
+	bonuses   []db.ScoreBonusSchema
+	ownership []db.KothOwnershipSchema // koth ownership whose points changed
+	slaCounts map[uint]map[string]int
+	streaks   *scoring.State
+	before    map[uint]*RescoreTotals
+	after     map[uint]*RescoreTotals
+}
+
+// Rescore rebuilds check points, scoring bonuses and SLA violations from the stored
+// check results using the current config. A dry run only reports what would change.
+// Rounds keep running during a rescore, their results just wait for it to finish.
+func (se *ScoringEngine) Rescore(dryRun bool) (RescoreReport, error) {
+	se.resultsMu.Lock()
+	defer se.resultsMu.Unlock()
+
+	rounds, err := db.GetScoreHistory()
+	if err != nil {
+		return RescoreReport{}, fmt.Errorf("failed to load score history: %w", err)
+	}
+	var ownership []db.KothOwnershipSchema
+	if se.Config.RequiredSettings.EventType == "koth" {
+		if ownership, err = db.GetKothOwnership(); err != nil {
+			return RescoreReport{}, fmt.Errorf("failed to load koth ownership: %w", err)
+		}
+	}
+
+	replay := se.replayScores(rounds, ownership)
+
+	report := RescoreReport{
+		DryRun:        dryRun,
+		Rounds:        len(rounds),
+		ChangedChecks: len(replay.checks),
+		Teams:         []RescoreDiff{},
+	}
+	teams := maps.Clone(replay.before)
+	maps.Copy(teams, replay.after)
+	for _, id := range slices.Sorted(maps.Keys(teams)) {
+		diff := RescoreDiff{TeamID: id}
+		if before, ok := replay.before[id]; ok {
+			diff.Before = *before
+		}
+		if after, ok := replay.after[id]; ok {
+			diff.After = *after
+		}
+		diff.Change = diff.After.Total - diff.Before.Total
+		report.Teams = append(report.Teams, diff)
+	}
+
+	if dryRun || len(rounds) == 0 {
+		return report, nil
+	}
+
+	upTo := rounds[len(rounds)-1].ID
+	if err := db.SaveRescore(upTo, replay.checks, replay.slas, replay.bonuses, replay.ownership); err != nil {
+		return RescoreReport{}, fmt.Errorf("failed to save rescore: %w", err)
+	}
+	if se.Config.RequiredSettings.EventType != "koth" {
+		se.SlaPerService = replay.slaCounts
+	}
+	se.ScoreState = replay.streaks
+	if err := db.RefreshScoresMaterializedView(); err != nil {
+		slog.Error("failed to refresh materialized view after rescore", "error", err)
+	}
+	slog.Info("scores rebuilt", "rounds", len(rounds), "changed_checks", len(replay.checks), "slas", len(replay.slas), "bonuses", len(replay.bonuses))
+
+	return report, nil
+}
+
+// replayScores scores stored rounds again with the current config, the same way
+// the rounds were scored when they ran. Checks that are no longer in the config
+// keep their points, and checks that are disabled or outside their launch and
+// stop times earn nothing and don't count towards SLAs.
+func (se *ScoringEngine) replayScores(rounds []db.RoundSchema, ownership []db.KothOwnershipSchema) rescored {
+	type configuredCheck interface {
+		GetPoints() int
+		RunnableAt(time.Time) bool
+	}
+	configured := make(map[string]configuredCheck)
+	for _, box := range se.Config.Box {
+		for _, r := range box.Runners {
+			if c, ok := r.(configuredCheck); ok {
+				configured[r.GetName()] = c
+			}
+		}
+	}
+
+	koth := se.Config.RequiredSettings.EventType == "koth"
+	scorer := se.newScorer()
+	state := scoring.NewState()
+	out := rescored{
+		slaCounts: make(map[uint]map[string]int),
+		before:    make(map[uint]*RescoreTotals),
+		after:     make(map[uint]*RescoreTotals),
+	}
+	totals := func(m map[uint]*RescoreTotals, teamID uint) *RescoreTotals {
+		if _, ok := m[teamID]; !ok {
+			m[teamID] = &RescoreTotals{}
+		}
+		return m[teamID]
+	}
+
+	ownershipByRound := make(map[uint][]db.KothOwnershipSchema)
+	for _, record := range ownership {
+		ownershipByRound[record.RoundID] = append(ownershipByRound[record.RoundID], record)
+	}
+
+	for _, round := range rounds {
+		for _, check := range round.Checks {
+			totals(out.before, check.TeamID).ServicePoints += check.Earned
+		}
+		for _, bonus := range round.Bonuses {
+			totals(out.before, bonus.TeamID).BonusPoints += bonus.Points
+		}
+		for _, sla := range round.SLAs {
+			before := totals(out.before, sla.TeamID)
+			before.SlaViolations++
+			before.SlaPenalty += sla.Penalty
+		}
+
+		checks := slices.Clone(round.Checks)
+		scored := []db.ServiceCheckSchema{}
+		indexes := []int{}
+		for i := range checks {
+			checks[i].Earned = 0
+			if c, ok := configured[checks[i].ServiceName]; ok {
+				checks[i].Points = c.GetPoints()
+				if !c.RunnableAt(round.StartTime) {
+					continue
+				}
+			}
+			scored = append(scored, checks[i])
+			indexes = append(indexes, i)
+		}
+
+		bonuses := scorer.score(round.ID, round.StartTime, scored, state)
+		recordStreaks(state, round.Checks)
+		out.bonuses = append(out.bonuses, bonuses...)
+
+		for j, i := range indexes {
+			checks[i].Earned = scored[j].Earned
+		}
+		for i, check := range checks {
+			if check.Points != round.Checks[i].Points || check.Earned != round.Checks[i].Earned {
+				out.checks = append(out.checks, check)
+			}
+			totals(out.after, check.TeamID).ServicePoints += check.Earned
+		}
+		for _, bonus := range bonuses {
+			totals(out.after, bonus.TeamID).BonusPoints += bonus.Points
+		}
+
+		if koth {
+			points := scorer.kothPoints(scored, bonuses)
+			for _, record := range ownershipByRound[round.ID] {
+				newPoints := 0
+				if record.TeamID != 0 {
+					newPoints = points[record.BoxName]
+				}
+				if newPoints != record.Points {
+					record.Points = newPoints
+					out.ownership = append(out.ownership, record)
+				}
+			}
+			continue // koth rounds don't have SLAs
+		}
+
+		for _, check := range scored {
+			if countSLA(out.slaCounts, check.TeamID, check.ServiceName, check.Result, se.Config.MiscSettings.SlaThreshold) {
+				out.slas = append(out.slas, db.SLASchema{
+					TeamID:      check.TeamID,
+					RoundID:     round.ID,
+					ServiceName: check.ServiceName,
+					Penalty:     se.Config.MiscSettings.SlaPenalty,
+				})
+				after := totals(out.after, check.TeamID)
+				after.SlaViolations++
+				after.SlaPenalty += se.Config.MiscSettings.SlaPenalty
+			}
+		}
+	}
+
+	for _, m := range []map[uint]*RescoreTotals{out.before, out.after} {
+		for _, t := range m {
+			t.Total = t.ServicePoints + t.BonusPoints - t.SlaPenalty
+		}
+	}
+	out.streaks = state
+	return out
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"quotient/engine/checks"
+	"quotient/engine/config"
+	"quotient/engine/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayScores(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	se := &ScoringEngine{Config: &config.ConfigSettings{
+		RequiredSettings: config.RequiredConfig{EventType: "rvb"},
+		MiscSettings:     config.MiscConfig{SlaThreshold: 2, SlaPenalty: 50},
+		Box: []config.Box{{
+			Name: "box1",
+			Runners: []checks.Runner{
+				&checks.Web{Service: checks.Service{Name: "box1-web", Points: 10}},
+				&checks.Ssh{Service: checks.Service{Name: "box1-ssh", Points: 5, StopTime: start.Add(30 * time.Second)}},
+			},
+		}},
+	}}
+
+	// web used to be worth 5, ssh was stopped after the first round and the
+	// removed service keeps what it was worth
+	check := func(round uint, service string, points int, passed bool) db.ServiceCheckSchema {
+		earned := 0
+		if passed {
+			earned = points
+		}
+		return db.ServiceCheckSchema{TeamID: 1, RoundID: round, ServiceName: service, Points: points, Earned: earned, Result: passed}
+	}
+	rounds := []db.RoundSchema{
+		{ID: 1, StartTime: start, Checks: []db.ServiceCheckSchema{
+			check(1, "box1-web", 5, true), check(1, "box1-ssh", 5, false), check(1, "box1-old", 3, true),
+		}},
+		{ID: 2, StartTime: start.Add(time.Minute), Checks: []db.ServiceCheckSchema{
+			check(2, "box1-web", 5, false), check(2, "box1-ssh", 5, true), check(2, "box1-old", 3, true),
+		}},
+		{ID: 3, StartTime: start.Add(2 * time.Minute), Checks: []db.ServiceCheckSchema{
+			check(3, "box1-web", 5, false), check(3, "box1-ssh", 5, false), check(3, "box1-old", 3, false),
+		}, SLAs: []db.SLASchema{{TeamID: 1, RoundID: 3, ServiceName: "box1-web", Penalty: 10}}},
+		{ID: 4, StartTime: start.Add(3 * time.Minute), Checks: []db.ServiceCheckSchema{
+			check(4, "box1-ssh", 5, false), check(4, "box1-old", 3, false),
+		}},
+	}
+
+	replay := se.replayScores(rounds, nil)
+
+	require.Contains(t, replay.before, uint(1))
+	assert.Equal(t, RescoreTotals{ServicePoints: 16, SlaViolations: 1, SlaPenalty: 10, Total: 6}, *replay.before[1])
+	require.Contains(t, replay.after, uint(1))
+	assert.Equal(t, RescoreTotals{ServicePoints: 16, SlaViolations: 2, SlaPenalty: 100, Total: -84}, *replay.after[1])
+
+	// web's points changed every round, ssh lost what it earned in round 2
+	changed := map[uint][]string{}
+	for _, c := range replay.checks {
+		changed[c.RoundID] = append(changed[c.RoundID], c.ServiceName)
+	}
+	assert.Equal(t, map[uint][]string{1: {"box1-web"}, 2: {"box1-web", "box1-ssh"}, 3: {"box1-web"}}, changed)
+
+	// ssh failures after it was stopped don't count, so only web and the removed check break their SLAs
+	assert.Equal(t, []db.SLASchema{
+		{TeamID: 1, RoundID: 3, ServiceName: "box1-web", Penalty: 50},
+		{TeamID: 1, RoundID: 4, ServiceName: "box1-old", Penalty: 50},
+	}, replay.slas)
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RunnerHeartbeat is how often runners report in to the registry
+	RunnerHeartbeat = 10 * time.Second
+
+	// runnerDeadAfter is how long a runner can go without reporting in before
+	// it's considered dead and the tasks it claimed are queued again
+	runnerDeadAfter = 3 * RunnerHeartbeat
+)
+
+// RunnerInfo is what a runner reports about itself in the registry
+type RunnerInfo struct {
+	ID          string    `json:"id"`
+	Version     string    `json:"version"`
+	Pools       []string  `json:"pools"`
+	Concurrency int       `json:"concurrency"` // most checks run at once
+	Load        int       `json:"load"`        // checks running now
+	QueueDepth  int64     `json:"queue_depth"` // tasks waiting in the runner's pools
+	StartedAt   time.Time `json:"started_at"`
+	LastSeen    time.Time `json:"last_seen"`
+	Dead        bool      `json:"dead"`
+}
+
+// RunnersKey is the Redis hash of runner ID to RunnerInfo
+const RunnersKey = "runners"
+
+// ClaimsKey is the Redis hash of the tasks a runner has taken off the queue
+// but not finished, keyed by Task.Key
+func ClaimsKey(runnerID string) string {
+	return "runner_claims:" + runnerID
+}
+
+// GetRunners returns every registered runner, flagging the ones that have
+// stopped reporting in
+func (se *ScoringEngine) GetRunners(ctx context.Context) ([]RunnerInfo, error) {
+	registry, err := se.RedisClient.HGetAll(ctx, RunnersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runners: %w", err)
+	}
+
+	runners := make([]RunnerInfo, 0, len(registry))
+	for _, id := range slices.Sorted(maps.Keys(registry)) {
+		var info RunnerInfo
+		if err := json.Unmarshal([]byte(registry[id]), &info); err != nil {
+			slog.Warn("skipping malformed runner registration", "runner", id, "error", err)
+			continue
+		}
+		info.ID = id
+		info.Dead = time.Since(info.LastSeen) > runnerDeadAfter
+		runners = append(runners, info)
+	}
+	return runners, nil
+}
+
+var (
+	ErrRunnerNotFound = errors.New("runner not found")
+	ErrRunnerAlive    = errors.New("runner is still alive")
+)
+
+// RemoveRunner drops a dead runner from the registry, queueing anything it
+// claimed again first
+func (se *ScoringEngine) RemoveRunner(ctx context.Context, runnerID string) error {
+	runners, err := se.GetRunners(ctx)
+	if err != nil {
+		return err
+	}
+	for _, runner := range runners {
+		if runner.ID != runnerID {
+			continue
+		}
+		if !runner.Dead {
+			return ErrRunnerAlive
+		}
+		if err := se.requeueClaims(ctx, runner); err != nil {
+			return err
+		}
+		return se.RedisClient.HDel(ctx, RunnersKey, runnerID).Err()
+	}
+	return ErrRunnerNotFound
+}
+
+// RunnerPool is a runner pool's queued tasks and the runners that serve it
+type RunnerPool struct {
+	Name    string   `json:"name"`
+	Backlog int64    `json:"backlog"`
+	Runners []string `json:"runners"`
+}
+
+// GetRunnerPools returns the pools checks are queued on, along with any pools
+// runners have joined that no check uses yet. Dead runners aren't counted.
+func (se *ScoringEngine) GetRunnerPools(ctx context.Context) ([]RunnerPool, error) {
+	registered, err := se.GetRunners(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runners := make(map[string][]string)
+	for _, pool := range se.Config.RunnerPools() {
+		runners[pool] = []string{}
+	}
+	for _, runner := range registered {
+		for _, pool := range runner.Pools {
+			if _, ok := runners[pool]; !ok {
+				runners[pool] = []string{}
+			}
+			if !runner.Dead {
+				runners[pool] = append(runners[pool], runner.ID)
+			}
+		}
+	}
+
+	pools := make([]RunnerPool, 0, len(runners))
+	for _, name := range slices.Sorted(maps.Keys(runners)) {
+		pools = append(pools, RunnerPool{
+			Name:    name,
+			Backlog: se.RedisClient.LLen(ctx, TaskQueue(name)).Val(),
+			Runners: runners[name],
+		})
+	}
+	return pools, nil
+}
+
+// watchRunners periodically looks for dead runners until the context is done
+func (se *ScoringEngine) watchRunners(ctx context.Context) {
+	ticker := time.NewTicker(RunnerHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := se.requeueDeadRunnerTasks(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("failed to requeue tasks from dead runners", "error", err)
+			}
+		}
+	}
+}
+
+// requeueDeadRunnerTasks puts the tasks dead runners claimed back at the front
+// of their queues, as long as there's still time left to run them
+func (se *ScoringEngine) requeueDeadRunnerTasks(ctx context.Context) error {
+	runners, err := se.GetRunners(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, runner := range runners {
+		if !runner.Dead {
+			continue
+		}
+		if err := se.requeueClaims(ctx, runner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeueClaims queues the unfinished tasks a runner claimed again
+func (se *ScoringEngine) requeueClaims(ctx context.Context, runner RunnerInfo) error {
+	// take the claims in one go so a runner coming back can't finish a task
+	// while it's being queued again
+	var claims *redis.MapStringStringCmd
+	if _, err := se.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		claims = pipe.HGetAll(ctx, ClaimsKey(runner.ID))
+		pipe.Del(ctx, ClaimsKey(runner.ID))
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to get tasks claimed by %s: %w", runner.ID, err)
+	}
+
+	requeued := 0
+	for key, payload := range claims.Val() {
+		var task Task
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			slog.Warn("dropping malformed task claim", "runner", runner.ID, "task", key, "error", err)
+			continue
+		}
+		if time.Now().After(task.Deadline) {
+			continue
+		}
+		if err := se.RedisClient.LPush(ctx, TaskQueue(task.Pool), payload).Err(); err != nil {
+			return fmt.Errorf("failed to requeue %s: %w", key, err)
+		}
+		requeued++
+	}
+	if requeued > 0 {
+		slog.Warn("requeued tasks claimed by dead runner", "runner", runner.ID, "count", requeued, "last_seen", runner.LastSeen)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"quotient/tests/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequeueDeadRunnerTasks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	redis := testutil.StartRedis(t)
+	defer redis.Close()
+
+	ctx := context.Background()
+	redis.Client.FlushDB(ctx)
+
+	engine := newTestEngine(t, redis, 3)
+	register := func(info RunnerInfo) {
+		payload, err := json.Marshal(info)
+		require.NoError(t, err)
+		require.NoError(t, redis.Client.HSet(ctx, RunnersKey, info.ID, payload).Err())
+	}
+	claim := func(runnerID string, task Task) {
+		payload, err := json.Marshal(task)
+		require.NoError(t, err)
+		require.NoError(t, redis.Client.HSet(ctx, ClaimsKey(runnerID), task.Key(), payload).Err())
+	}
+
+	register(RunnerInfo{ID: "alive", Pools: []string{"default"}, LastSeen: time.Now()})
+	register(RunnerInfo{ID: "dead", Pools: []string{"default", "windows"}, LastSeen: time.Now().Add(-time.Minute)})
+	claim("alive", Task{ServiceName: "busy", RoundID: 1, Deadline: time.Now().Add(time.Minute)})
+	claim("dead", Task{ServiceName: "unfinished", RoundID: 1, Deadline: time.Now().Add(time.Minute), Pool: "windows"})
+	claim("dead", Task{ServiceName: "too-late", RoundID: 1, Deadline: time.Now().Add(-time.Second)})
+
+	runners, err := engine.GetRunners(ctx)
+	require.NoError(t, err)
+	require.Len(t, runners, 2)
+	assert.False(t, runners[0].Dead)
+	assert.True(t, runners[1].Dead)
+
+	// only the alive runner counts towards the pools
+	pools, err := engine.GetRunnerPools(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []RunnerPool{
+		{Name: "default", Runners: []string{"alive"}},
+		{Name: "windows", Runners: []string{}},
+	}, pools)
+
+	require.NoError(t, engine.requeueDeadRunnerTasks(ctx))
+
+	queued, err := redis.Client.LRange(ctx, TaskQueue("windows"), 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	var task Task
+	require.NoError(t, json.Unmarshal([]byte(queued[0]), &task))
+	assert.Equal(t, "unfinished", task.ServiceName)
+	assert.Zero(t, redis.Client.LLen(ctx, TaskQueue("default")).Val())
+	assert.Zero(t, redis.Client.Exists(ctx, ClaimsKey("dead")).Val())
+	assert.Equal(t, int64(1), redis.Client.HLen(ctx, ClaimsKey("alive")).Val())
+
+	assert.ErrorIs(t, engine.RemoveRunner(ctx, "alive"), ErrRunnerAlive)
+	assert.ErrorIs(t, engine.RemoveRunner(ctx, "missing"), ErrRunnerNotFound)
+	require.NoError(t, engine.RemoveRunner(ctx, "dead"))
+	assert.Equal(t, []string{"alive"}, redis.Client.HKeys(ctx, RunnersKey).Val())
+}
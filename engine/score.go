@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"log/slog"
+	"time"
+
+	"quotient/engine/db"
+	"quotient/engine/scoring"
+)
+
+// scorer scores rounds with the scoring model from the current config
+type scorer struct {
+	model scoring.Model
+	boxes map[string]string // check name to box name
+}
+
+func (se *ScoringEngine) newScorer() scorer {
+	model, err := scoring.New(se.Config.MiscSettings.ScoringModel, se.Config.ScoringSettings)
+	if err != nil {
+		// the config is validated on load so this shouldn't happen, but don't lose the round
+		slog.Error("failed to load scoring model, using standard scoring", "model", se.Config.MiscSettings.ScoringModel, "error", err)
+		model = scoring.Standard{}
+	}
+
+	boxes := make(map[string]string)
+	for _, box := range se.Config.Box {
+		for _, r := range box.Runners {
+			boxes[r.GetName()] = box.Name
+		}
+	}
+	return scorer{model: model, boxes: boxes}
+}
+
+// score sets the points each check in a round earned and returns the bonuses the
+// model gave out
+func (s scorer) score(roundID uint, start time.Time, results []db.ServiceCheckSchema, state *scoring.State) []db.ScoreBonusSchema {
+	scored := make([]scoring.Check, len(results))
+	for i, result := range results {
+		scored[i] = scoring.Check{
+			TeamID:  result.TeamID,
+			Service: result.ServiceName,
+			Box:     s.boxes[result.ServiceName],
+			Points:  result.Points,
+			Passed:  result.Result,
+		}
+	}
+
+	bonuses := s.model.Score(start, scored, state)
+
+	for i := range results {
+		results[i].Earned = scored[i].Earned
+	}
+	dbBonuses := make([]db.ScoreBonusSchema, 0, len(bonuses))
+	for _, bonus := range bonuses {
+		dbBonuses = append(dbBonuses, db.ScoreBonusSchema{
+			RoundID: roundID,
+			TeamID:  bonus.TeamID,
+			BoxName: bonus.Box,
+			Points:  bonus.Points,
+		})
+	}
+	return dbBonuses
+}
+
+// kothPoints adds up what each box was worth to its owner in a koth round
+func (s scorer) kothPoints(results []db.ServiceCheckSchema, bonuses []db.ScoreBonusSchema) map[string]int {
+	points := make(map[string]int)
+	for _, result := range results {
+		points[s.boxes[result.ServiceName]] += result.Earned
+	}
+	for _, bonus := range bonuses {
+		points[bonus.BoxName] += bonus.Points
+	}
+	return points
+}
+
+// scoreRound runs the current round's checks through the configured scoring model
+func (se *ScoringEngine) scoreRound(results []db.ServiceCheckSchema) []db.ScoreBonusSchema {
+	if se.ScoreState == nil {
+		se.ScoreState = scoring.NewState()
+	}
+	return se.newScorer().score(se.CurrentRound, se.CurrentRoundStartTime, results, se.ScoreState)
+}
+
+// recordStreaks moves the uptime streaks on once a round has been saved
+func (se *ScoringEngine) recordStreaks(results []db.ServiceCheckSchema) {
+	if se.ScoreState == nil {
+		se.ScoreState = scoring.NewState()
+	}
+	recordStreaks(se.ScoreState, results)
+}
+
+func recordStreaks(state *scoring.State, results []db.ServiceCheckSchema) {
+	scored := make([]scoring.Check, len(results))
+	for i, result := range results {
+		scored[i] = scoring.Check{TeamID: result.TeamID, Service: result.ServiceName, Passed: result.Result}
+	}
+	state.Record(scored)
+}
+
+// countSLA counts a check towards its service's SLA and reports whether that
+// makes a violation. The count starts over after a violation or a passing check.
+func countSLA(counts map[uint]map[string]int, teamID uint, serviceName string, status bool, threshold int) bool {
+	if _, ok := counts[teamID]; !ok {
+		counts[teamID] = make(map[string]int)
+	}
+	if status {
+		counts[teamID][serviceName] = 0
+		return false
+	}
+	counts[teamID][serviceName]++
+	if counts[teamID][serviceName] >= threshold {
+		counts[teamID][serviceName] = 0
+		return true
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// Package scoring decides how many points each service check is worth. The
+// engine scores every round through the model selected in the config, and the
+// score views are built from what the model awarded rather than raw check points.
+package scoring
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Check is a single check result in a round
+type Check struct {
+	TeamID  uint
+	Service string
+	Box     string
+	Points  int // base points from the check config
+	Passed  bool
+	Earned  int // set by the model
+}
+
+// Bonus is awarded on top of the checks in a round
+type Bonus struct {
+	TeamID uint
+	Box    string
+	Points int
+}
+
+// Model scores a round. Score sets Earned on every check and returns any bonuses.
+// The state holds uptime streaks from before the round and must not be changed by
+// the model, the caller records the round once it's scored.
+type Model interface {
+	Score(start time.Time, checks []Check, state *State) []Bonus
+}
+
+var models = map[string]func(Settings) Model{
+	"standard": func(Settings) Model { return Standard{} },
+	"weighted": func(s Settings) Model { return Weighted{Settings: s} },
+}
+
+// Names lists the available scoring models
+func Names() []string {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the named scoring model, or the standard model if no name is given
+func New(name string, settings Settings) (Model, error) {
+	if name == "" {
+		name = "standard"
+	}
+	newModel, ok := models[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring model %q, must be one of %v", name, Names())
+	}
+	return newModel(settings), nil
+}
+
+// State tracks how many rounds in a row each team's services have been up
+type State struct {
+	Streaks map[uint]map[string]int
+}
+
+func NewState() *State {
+	return &State{Streaks: make(map[uint]map[string]int)}
+}
+
+// Streak returns how many rounds in a row a service was up before this round
+func (s *State) Streak(teamID uint, service string) int {
+	return s.Streaks[teamID][service]
+}
+
+// Record updates the streaks with a scored round
+func (s *State) Record(checks []Check) {
+	for _, c := range checks {
+		if _, ok := s.Streaks[c.TeamID]; !ok {
+			s.Streaks[c.TeamID] = make(map[string]int)
+		}
+		if c.Passed {
+			s.Streaks[c.TeamID][c.Service]++
+		} else {
+			s.Streaks[c.TeamID][c.Service] = 0
+		}
+	}
+}
+
+// Standard awards a check's points when it passes and nothing otherwise
+type Standard struct{}
+
+func (Standard) Score(start time.Time, checks []Check, state *State) []Bonus {
+	for i := range checks {
+		checks[i].Earned = 0
+		if checks[i].Passed {
+			checks[i].Earned = checks[i].Points
+		}
+	}
+	return nil
+}
+
+// boxesUp returns each team's boxes where every check in the round passed, in
+// the order they first appear
+func boxesUp(checks []Check) []Bonus {
+	type key struct {
+		team uint
+		box  string
+	}
+	up := map[key]bool{}
+	order := []key{}
+	for _, c := range checks {
+		if c.Box == "" {
+			continue
+		}
+		k := key{c.TeamID, c.Box}
+		if _, seen := up[k]; !seen {
+			up[k] = true
+			order = append(order, k)
+		}
+		up[k] = up[k] && c.Passed
+	}
+
+	bonuses := []Bonus{}
+	for _, k := range order {
+		if up[k] {
+			bonuses = append(bonuses, Bonus{TeamID: k.team, Box: k.box})
+		}
+	}
+	return bonuses
+}
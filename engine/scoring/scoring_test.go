@@ -0,0 +1,179 @@
+package scoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func earned(checks []Check) []int {
+	points := make([]int, len(checks))
+	for i, c := range checks {
+		points[i] = c.Earned
+	}
+	return points
+}
+
+func TestNew(t *testing.T) {
+	model, err := New("", Settings{})
+	require.NoError(t, err)
+	assert.IsType(t, Standard{}, model)
+
+	model, err = New("weighted", Settings{BoxBonus: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 5, model.(Weighted).BoxBonus)
+
+	_, err = New("nope", Settings{})
+	assert.Error(t, err)
+}
+
+func TestStandardScore(t *testing.T) {
+	checks := []Check{
+		{TeamID: 1, Service: "web", Box: "box1", Points: 10, Passed: true},
+		{TeamID: 1, Service: "ssh", Box: "box1", Points: 5, Passed: false, Earned: 5},
+	}
+	bonuses := Standard{}.Score(time.Now(), checks, NewState())
+	assert.Equal(t, []int{10, 0}, earned(checks))
+	assert.Empty(t, bonuses)
+}
+
+func TestWeightedScore(t *testing.T) {
+	// 2024-01-01 is a monday, times are UTC
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)
+	earlyMorning := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		settings Settings
+		start    time.Time
+		streaks  map[string]int
+		checks   []Check
+		earned   []int
+		bonuses  []Bonus
+	}{
+		{
+			name:   "no settings is standard scoring",
+			start:  noon,
+			checks: []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}, {TeamID: 1, Service: "ssh", Points: 10}},
+			earned: []int{10, 0},
+		},
+		{
+			name:     "service weights",
+			settings: Settings{Weights: map[string]float64{"web": 2, "ssh": 0.5}},
+			start:    noon,
+			checks:   []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}, {TeamID: 1, Service: "ssh", Points: 5, Passed: true}, {TeamID: 1, Service: "dns", Points: 10, Passed: true}},
+			earned:   []int{20, 3, 10},
+		},
+		{
+			name:     "time window",
+			settings: Settings{Timezone: "UTC", TimeMultipliers: []TimeMultiplier{{Start: "09:00", End: "17:00", Multiplier: 1.5}}},
+			start:    noon,
+			checks:   []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}},
+			earned:   []int{15},
+		},
+		{
+			name:     "outside time window",
+			settings: Settings{Timezone: "UTC", TimeMultipliers: []TimeMultiplier{{Start: "09:00", End: "17:00", Multiplier: 1.5}}},
+			start:    night,
+			checks:   []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}},
+			earned:   []int{10},
+		},
+		{
+			name:     "time window past midnight",
+			settings: Settings{Timezone: "UTC", TimeMultipliers: []TimeMultiplier{{Start: "22:00", End: "06:00", Multiplier: 3}}},
+			start:    earlyMorning,
+			checks:   []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}},
+			earned:   []int{30},
+		},
+		{
+			name:     "streak bonus",
+			settings: Settings{StreakRounds: 2, StreakBonus: 0.5},
+			start:    noon,
+			streaks:  map[string]int{"web": 3, "ssh": 0},
+			checks:   []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}, {TeamID: 1, Service: "ssh", Points: 10, Passed: true}},
+			earned:   []int{20, 10},
+		},
+		{
+			name:     "streak bonus is capped",
+			settings: Settings{StreakRounds: 1, StreakBonus: 1, StreakMaxMultiplier: 2.5},
+			start:    noon,
+			streaks:  map[string]int{"web": 100},
+			checks:   []Check{{TeamID: 1, Service: "web", Points: 10, Passed: true}},
+			earned:   []int{25},
+		},
+		{
+			name:     "box bonus only for fully up boxes",
+			settings: Settings{BoxBonus: 20, Timezone: "UTC", TimeMultipliers: []TimeMultiplier{{Start: "09:00", End: "17:00", Multiplier: 1.5}}},
+			start:    noon,
+			checks: []Check{
+				{TeamID: 1, Service: "web", Box: "box1", Points: 10, Passed: true},
+				{TeamID: 1, Service: "ssh", Box: "box1", Points: 10, Passed: true},
+				{TeamID: 2, Service: "web", Box: "box1", Points: 10, Passed: true},
+				{TeamID: 2, Service: "ssh", Box: "box1", Points: 10, Passed: false},
+			},
+			earned:  []int{15, 15, 15, 0},
+			bonuses: []Bonus{{TeamID: 1, Box: "box1", Points: 30}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.settings.Validate())
+			state := NewState()
+			if tt.streaks != nil {
+				state.Streaks[1] = tt.streaks
+			}
+
+			model, err := New("weighted", tt.settings)
+			require.NoError(t, err)
+			bonuses := model.Score(tt.start, tt.checks, state)
+			assert.Equal(t, tt.earned, earned(tt.checks))
+			if tt.bonuses == nil {
+				assert.Empty(t, bonuses)
+			} else {
+				assert.Equal(t, tt.bonuses, bonuses)
+			}
+		})
+	}
+}
+
+func TestStateRecord(t *testing.T) {
+	state := NewState()
+	state.Record([]Check{{TeamID: 1, Service: "web", Passed: true}, {TeamID: 1, Service: "ssh", Passed: true}})
+	state.Record([]Check{{TeamID: 1, Service: "web", Passed: true}, {TeamID: 1, Service: "ssh", Passed: false}})
+	assert.Equal(t, 2, state.Streak(1, "web"))
+	assert.Equal(t, 0, state.Streak(1, "ssh"))
+	assert.Equal(t, 0, state.Streak(2, "web"))
+}
+
+func TestSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		wantErr  bool
+	}{
+		{name: "empty", settings: Settings{}},
+		{name: "negative weight", settings: Settings{Weights: map[string]float64{"web": -1}}, wantErr: true},
+		{name: "bad timezone", settings: Settings{Timezone: "Mars/Olympus"}, wantErr: true},
+		{name: "bad window", settings: Settings{TimeMultipliers: []TimeMultiplier{{Start: "9am", End: "17:00", Multiplier: 2}}}, wantErr: true},
+		{name: "negative window", settings: Settings{TimeMultipliers: []TimeMultiplier{{Start: "09:00", End: "17:00", Multiplier: -1}}}, wantErr: true},
+		{name: "negative streak", settings: Settings{StreakRounds: -1}, wantErr: true},
+		{name: "streak cap below one", settings: Settings{StreakMaxMultiplier: 0.5}, wantErr: true},
+		{name: "negative box bonus", settings: Settings{BoxBonus: -5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 2.0, tt.settings.StreakMaxMultiplier)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Settings configure the weighted scoring model
+type Settings struct {
+	// Multiplier for each service by name, services without one have a weight of 1
+	Weights map[string]float64 `toml:",omitempty" json:",omitempty"`
+
+	// Multipliers for rounds that start during a time of day
+	TimeMultipliers []TimeMultiplier `toml:",omitempty" json:",omitempty"`
+	// Timezone for the time of day windows, defaults to the server's
+	Timezone string `toml:",omitempty" json:",omitempty"`
+
+	// Every StreakRounds rounds a service stays up its points go up by StreakBonus
+	// (as a fraction of its points) until they reach StreakMaxMultiplier times
+	StreakRounds        int     `toml:",omitempty" json:",omitempty"`
+	StreakBonus         float64 `toml:",omitempty" json:",omitempty"`
+	StreakMaxMultiplier float64 `toml:",omitempty" json:",omitempty"`
+
+	// Points for each box where every service is up in a round
+	BoxBonus int `toml:",omitempty" json:",omitempty"`
+
+	location *time.Location
+}
+
+// TimeMultiplier applies to rounds starting between Start and End, given as
+// "15:04". Windows that end before they start wrap past midnight.
+type TimeMultiplier struct {
+	Start      string
+	End        string
+	Multiplier float64
+
+	start, end time.Duration
+}
+
+// Validate checks the settings and sets defaults
+func (s *Settings) Validate() error {
+	var errResult error
+
+	for service, weight := range s.Weights {
+		if weight < 0 {
+			errResult = errors.Join(errResult, fmt.Errorf("scoring weight for %s must not be negative", service))
+		}
+	}
+
+	s.location = time.Local
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			errResult = errors.Join(errResult, fmt.Errorf("invalid scoring timezone %q: %w", s.Timezone, err))
+		} else {
+			s.location = location
+		}
+	}
+
+	for i := range s.TimeMultipliers {
+		window := &s.TimeMultipliers[i]
+		start, startErr := parseTimeOfDay(window.Start)
+		end, endErr := parseTimeOfDay(window.End)
+		if startErr != nil || endErr != nil {
+			errResult = errors.Join(errResult, fmt.Errorf("time multiplier %d needs a start and end as HH:MM", i))
+			continue
+		}
+		if window.Multiplier < 0 {
+			errResult = errors.Join(errResult, fmt.Errorf("time multiplier %d must not be negative", i))
+		}
+		window.start, window.end = start, end
+	}
+
+	if s.StreakRounds < 0 || s.StreakBonus < 0 {
+		errResult = errors.Join(errResult, errors.New("streak rounds and bonus must not be negative"))
+	}
+	if s.StreakMaxMultiplier == 0 {
+		s.StreakMaxMultiplier = 2
+	}
+	if s.StreakMaxMultiplier < 1 {
+		errResult = errors.Join(errResult, errors.New("streak max multiplier must be at least 1"))
+	}
+
+	if s.BoxBonus < 0 {
+		errResult = errors.Join(errResult, errors.New("box bonus must not be negative"))
+	}
+
+	return errResult
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether a time of day falls in the window
+func (window TimeMultiplier) contains(timeOfDay time.Duration) bool {
+	if window.start <= window.end {
+		return timeOfDay >= window.start && timeOfDay < window.end
+	}
+	return timeOfDay >= window.start || timeOfDay < window.end
+}
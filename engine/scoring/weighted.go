@@ -0,0 +1,71 @@
+package scoring
+
+import (
+	"math"
+	"time"
+)
+
+// Weighted scales a check's points by its service weight, the time of day and how
+// long the service has been up, and gives a bonus for boxes that are fully up
+type Weighted struct {
+	Settings
+}
+
+func (m Weighted) Score(start time.Time, checks []Check, state *State) []Bonus {
+	timeMultiplier := m.timeMultiplier(start)
+
+	for i := range checks {
+		c := &checks[i]
+		c.Earned = 0
+		if !c.Passed {
+			continue
+		}
+
+		weight := 1.0
+		if w, ok := m.Weights[c.Service]; ok {
+			weight = w
+		}
+		streak := state.Streak(c.TeamID, c.Service) + 1 // this round counts towards the streak
+		c.Earned = int(math.Round(float64(c.Points) * weight * timeMultiplier * m.streakMultiplier(streak)))
+	}
+
+	if m.BoxBonus <= 0 {
+		return nil
+	}
+	bonuses := boxesUp(checks)
+	for i := range bonuses {
+		bonuses[i].Points = int(math.Round(float64(m.BoxBonus) * timeMultiplier))
+	}
+	return bonuses
+}
+
+// timeMultiplier returns the multiplier of the first window the round starts in
+func (m Weighted) timeMultiplier(start time.Time) float64 {
+	if len(m.TimeMultipliers) == 0 {
+		return 1
+	}
+	location := m.location
+	if location == nil {
+		location = time.Local
+	}
+	local := start.In(location)
+	timeOfDay := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	for _, window := range m.TimeMultipliers {
+		if window.contains(timeOfDay) {
+			return window.Multiplier
+		}
+	}
+	return 1
+}
+
+// streakMultiplier grows by StreakBonus for every StreakRounds rounds of uptime
+func (m Weighted) streakMultiplier(streak int) float64 {
+	if m.StreakRounds <= 0 || m.StreakBonus <= 0 {
+		return 1
+	}
+	multiplier := 1 + float64(streak/m.StreakRounds)*m.StreakBonus
+	if m.StreakMaxMultiplier >= 1 {
+		multiplier = math.Min(multiplier, m.StreakMaxMultiplier)
+	}
+	return multiplier
+}
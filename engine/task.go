@@ -2,7 +2,10 @@ package engine
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
+
+	"quotient/engine/checks"
 )
 
 type Task struct {
@@ -14,4 +17,37 @@ type Task struct {
 	RoundID        uint            `json:"round_id"`
 	Attempts       int             `json:"attempts"`
 	CheckData      json.RawMessage `json:"check_data"`
+	Rerun          bool            `json:"rerun,omitempty"` // an admin rerun of a check from an earlier round
+	Pool           string          `json:"pool,omitempty"`
+}
+
+// TaskQueue is the Redis list a runner pool's tasks are queued on. The default
+// pool keeps the original tasks list.
+func TaskQueue(pool string) string {
+	if pool == "" || pool == "default" {
+		return "tasks"
+	}
+	return "tasks:" + pool
+}
+
+// checkPool returns the runner pool a check asked for
+func checkPool(r checks.Runner) string {
+	if p, ok := r.(interface{ GetPool() string }); ok && p.GetPool() != "" {
+		return p.GetPool()
+	}
+	return "default"
+}
+
+// Key identifies the task while a runner works on it
+func (t Task) Key() string {
+	return fmt.Sprintf("task:%d:%d:%s:%s", t.RoundID, t.TeamID, t.ServiceType, t.ServiceName)
+}
+
+// HostKeysKey is the Redis hash of ssh host keys pinned by checks, keyed by
+// HostKeyField
+const HostKeysKey = "host_keys"
+
+// HostKeyField identifies a team's service in the pinned host keys
+func HostKeyField(teamID uint, serviceName string) string {
+	return fmt.Sprintf("%d:%s", teamID, serviceName)
 }
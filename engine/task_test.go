@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"testing"
+
+	"quotient/engine/checks"
+	"quotient/engine/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskQueue(t *testing.T) {
+	assert.Equal(t, "tasks", TaskQueue(""))
+	assert.Equal(t, "tasks", TaskQueue("default"))
+	assert.Equal(t, "tasks:windows", TaskQueue("windows"))
+}
+
+func TestCheckPools(t *testing.T) {
+	conf := config.ConfigSettings{Box: []config.Box{{
+		Name: "dc01",
+		Runners: []checks.Runner{
+			&checks.Ping{Service: checks.Service{Name: "dc01-ping"}},
+			&checks.WinRM{Service: checks.Service{Name: "dc01-winrm", Pool: "windows"}},
+			&checks.Smb{Service: checks.Service{Name: "dc01-smb", Pool: "windows"}},
+		},
+	}}}
+
+	assert.Equal(t, "default", checkPool(conf.Box[0].Runners[0]))
+	assert.Equal(t, "windows", checkPool(conf.Box[0].Runners[1]))
+	assert.Equal(t, []string{"default", "windows"}, conf.RunnerPools())
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"quotient/engine"
@@ -18,6 +23,19 @@ import (
 // Global variable to store the runner ID
 var runnerID string
 
+// taskQueues are the queues of the runner pools this runner is in
+var taskQueues []string
+
+// version is reported to the engine, set with -ldflags "-X main.version=..."
+var version = ""
+
+// running counts the checks this runner is working on
+var running atomic.Int64
+
+// defaultConcurrency is how many checks a runner works on at once when
+// RUNNER_CONCURRENCY isn't set
+const defaultConcurrency = 20
+
 func main() {
 	// Use WithReaper to run reaper as PID 1 and application code in a child process
 	// This prevents the reaper from interfering with processes we're actively managing
@@ -51,7 +69,49 @@ func runApp(err error) int {
 	})
 	ctx := context.Background()
 
-	log.Printf("[Runner] Started with ID %s, listening for tasks on Redis at: %s", runnerID, redisAddr)
+	// Use environment variable RUNNER_POOLS (comma separated) to join runner pools,
+	// otherwise only run checks from the default pool
+	pools := []string{}
+	for _, pool := range strings.Split(os.Getenv("RUNNER_POOLS"), ",") {
+		if pool = strings.TrimSpace(pool); pool != "" {
+			pools = append(pools, pool)
+		}
+	}
+	if len(pools) == 0 {
+		pools = []string{"default"}
+	}
+	for _, pool := range pools {
+		taskQueues = append(taskQueues, engine.TaskQueue(pool))
+	}
+
+	// Use environment variable RUNNER_CONCURRENCY to limit how many checks run at
+	// once, so one runner can't take a whole round's tasks from the others
+	concurrency := defaultConcurrency
+	if v := os.Getenv("RUNNER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Printf("[Runner] Invalid RUNNER_CONCURRENCY %q, using %d", v, defaultConcurrency)
+		} else {
+			concurrency = n
+		}
+	}
+
+	// register with the engine and keep reporting in so it knows we're alive
+	info := engine.RunnerInfo{
+		ID:          runnerID,
+		Version:     runnerVersion(),
+		Pools:       pools,
+		Concurrency: concurrency,
+		StartedAt:   time.Now(),
+	}
+	heartbeat(ctx, rdb, info)
+	go func() {
+		for range time.Tick(engine.RunnerHeartbeat) {
+			heartbeat(ctx, rdb, info)
+		}
+	}()
+
+	log.Printf("[Runner] Started with ID %s (version %s) in pools %v running %d checks at once, listening for tasks on Redis at: %s", runnerID, info.Version, pools, concurrency, redisAddr)
 
 	go func() {
 		events := rdb.Subscribe(context.Background(), "events")
@@ -62,6 +122,7 @@ func runApp(err error) int {
 			log.Printf("[Runner] Received message: %v", msg)
 			if msg.Payload == "reset" {
 				log.Printf("[Runner] Reset event received, quitting...")
+				rdb.HDel(context.Background(), engine.RunnersKey, runnerID)
 				os.Exit(0)
 			} else {
 				continue
@@ -69,31 +130,76 @@ func runApp(err error) int {
 		}
 	}()
 
+	// only take a task when a worker is free, leaving the rest of the queue to
+	// other runners
+	workers := make(chan struct{}, concurrency)
 	for {
+		workers <- struct{}{}
+
 		task, err := getNextTask(ctx, rdb)
 		if err != nil {
 			log.Printf("[Runner] Error getting task: %v", err)
+			<-workers
+			time.Sleep(time.Second)
 			continue
 		}
 
 		runner, err := createRunner(task)
 		if err != nil {
 			log.Printf("[Runner] Error creating runner: %v", err)
+			rdb.HDel(ctx, engine.ClaimsKey(runnerID), task.Key())
+			<-workers
 			continue
 		}
 
-		go handleTask(ctx, rdb, runner, task)
+		go func() {
+			defer func() { <-workers }()
+			handleTask(ctx, rdb, runner, task)
+		}()
+	}
+}
+
+// heartbeat writes this runner's registration with its current load and how
+// many tasks are waiting in its pools
+func heartbeat(ctx context.Context, rdb *redis.Client, info engine.RunnerInfo) {
+	info.Load = int(running.Load())
+	for _, queue := range taskQueues {
+		info.QueueDepth += rdb.LLen(ctx, queue).Val()
+	}
+	info.LastSeen = time.Now()
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		log.Printf("[Runner] Failed to marshal runner info: %v", err)
+		return
+	}
+	if err := rdb.HSet(ctx, engine.RunnersKey, runnerID, infoJSON).Err(); err != nil {
+		log.Printf("[Runner] Failed to send heartbeat: %v", err)
 	}
 }
 
+// runnerVersion is the version set at build time, or the commit it was built from
+func runnerVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+				return setting.Value[:7]
+			}
+		}
+	}
+	return "dev"
+}
+
 func getNextTask(ctx context.Context, rdb *redis.Client) (*engine.Task, error) {
-	// Block until we get a task from the "tasks" list
-	val, err := rdb.BLPop(ctx, 0, "tasks").Result()
+	// Block until we get a task from one of our pools' lists
+	val, err := rdb.BLPop(ctx, 0, taskQueues...).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to pop task: %w", err)
 	}
 
-	// val[0] = "tasks", val[1] = the JSON payload
+	// val[0] = the queue, val[1] = the JSON payload
 	if len(val) < 2 {
 		return nil, fmt.Errorf("invalid BLPop response: %v", val)
 	}
@@ -103,6 +209,11 @@ func getNextTask(ctx context.Context, rdb *redis.Client) (*engine.Task, error) {
 		return nil, fmt.Errorf("invalid task format: %w", err)
 	}
 
+	// claim the task so the engine can queue it again if this runner dies
+	if err := rdb.HSet(ctx, engine.ClaimsKey(runnerID), task.Key(), val[1]).Err(); err != nil {
+		log.Printf("[Runner] Failed to claim task %s: %v", task.Key(), err)
+	}
+
 	log.Printf("[Runner] Received task: RoundID=%d TeamID=%d TeamIdentifier=%s ServiceType=%s",
 		task.RoundID, task.TeamID, task.TeamIdentifier, task.ServiceType)
 
@@ -117,22 +228,42 @@ func createRunner(task *engine.Task) (checks.Runner, error) {
 		runner = &checks.Custom{}
 	case "Dns":
 		runner = &checks.Dns{}
+	case "Docker":
+		runner = &checks.Docker{}
 	case "Ftp":
 		runner = &checks.Ftp{}
 	case "Imap":
 		runner = &checks.Imap{}
+	case "Kerberos":
+		runner = &checks.Kerberos{}
+	case "Kubernetes":
+		runner = &checks.Kubernetes{}
 	case "Ldap":
 		runner = &checks.Ldap{}
+	case "Mail":
+		runner = &checks.Mail{}
+	case "Memcached":
+		runner = &checks.Memcached{}
+	case "Mongo":
+		runner = &checks.Mongo{}
+	case "Mqtt":
+		runner = &checks.Mqtt{}
+	case "Ntp":
+		runner = &checks.Ntp{}
 	case "Ping":
 		runner = &checks.Ping{}
 	case "Pop3":
 		runner = &checks.Pop3{}
 	case "Rdp":
 		runner = &checks.Rdp{}
+	case "Redis":
+		runner = &checks.Redis{}
 	case "Smb":
 		runner = &checks.Smb{}
 	case "Smtp":
 		runner = &checks.Smtp{}
+	case "Snmp":
+		runner = &checks.Snmp{}
 	case "Sql":
 		runner = &checks.Sql{}
 	case "Ssh":
@@ -159,7 +290,12 @@ func createRunner(task *engine.Task) (checks.Runner, error) {
 
 func handleTask(ctx context.Context, rdb *redis.Client, runner checks.Runner, task *engine.Task) {
 	// Create a task key to identify the check
-	taskKey := fmt.Sprintf("task:%d:%d:%s:%s", task.RoundID, task.TeamID, task.ServiceType, task.ServiceName)
+	taskKey := task.Key()
+
+	running.Add(1)
+	defer running.Add(-1)
+	// the task is finished with one way or another, so it's no longer claimed
+	defer rdb.HDel(ctx, engine.ClaimsKey(runnerID), taskKey)
 
 	// Create a result
 	result := checks.Result{
@@ -177,6 +313,21 @@ func handleTask(ctx context.Context, rdb *redis.Client, runner checks.Runner, ta
 	statusJSON, _ := json.Marshal(result)
 	rdb.Set(ctx, taskKey, statusJSON, time.Until(task.Deadline))
 
+	// checks that pin a host key get the one learned the first time they ran
+	pinner, pins := runner.(interface {
+		PinsHostKey() bool
+		SetPinnedHostKey(key string)
+	})
+	pins = pins && pinner.PinsHostKey()
+	hostKeyField := engine.HostKeyField(task.TeamID, task.ServiceName)
+	if pins {
+		key, err := rdb.HGet(ctx, engine.HostKeysKey, hostKeyField).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("[Runner] Failed to get pinned host key for %s: %v", hostKeyField, err)
+		}
+		pinner.SetPinnedHostKey(key)
+	}
+
 	resultsChan := make(chan checks.Result, 1)
 
 	// this currently discards all failed attempts
@@ -221,6 +372,12 @@ func handleTask(ctx context.Context, rdb *redis.Client, runner checks.Runner, ta
 		}
 	}
 
+	if pins && result.HostKey != "" {
+		if err := rdb.HSetNX(ctx, engine.HostKeysKey, hostKeyField, result.HostKey).Err(); err != nil {
+			log.Printf("[Runner] Failed to pin host key for %s: %v", hostKeyField, err)
+		}
+	}
+
 	// Marshal and store result
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
@@ -228,7 +385,12 @@ func handleTask(ctx context.Context, rdb *redis.Client, runner checks.Runner, ta
 		return
 	}
 
-	if err := rdb.RPush(ctx, "results", resultJSON).Err(); err != nil {
+	// reruns go to their own queue so the round that's running doesn't pick them up
+	resultsQueue := "results"
+	if task.Rerun {
+		resultsQueue = "rerun_results"
+	}
+	if err := rdb.RPush(ctx, resultsQueue, resultJSON).Err(); err != nil {
 		log.Printf("[Runner] Failed to push result to Redis: %v", err)
 		return
 	}
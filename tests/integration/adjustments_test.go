@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"quotient/engine/db"
+	"quotient/tests/testutil"
+	"quotient/www/api"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdjustmentValidation tests the admin adjustment API turns away bad
+// adjustments and only lets one be revoked once
+func TestAdjustmentValidation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	pgContainer := testutil.StartPostgres(t)
+	defer pgContainer.Close()
+	db.Connect(pgContainer.ConnectionString())
+
+	team := createTestTeam(t, "Adjustment Team", "01")
+
+	asAdmin := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), "username", "admin"))
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{name: "zero amount", body: fmt.Sprintf(`{"team_id":%d,"amount":0,"reason":"nothing"}`, team.ID), expected: http.StatusBadRequest},
+		{name: "missing reason", body: fmt.Sprintf(`{"team_id":%d,"amount":5}`, team.ID), expected: http.StatusBadRequest},
+		{name: "blank reason", body: fmt.Sprintf(`{"team_id":%d,"amount":5,"reason":"   "}`, team.ID), expected: http.StatusBadRequest},
+		{name: "unknown team", body: fmt.Sprintf(`{"team_id":%d,"amount":5,"reason":"late start"}`, team.ID+1000), expected: http.StatusNotFound},
+		{name: "malformed body", body: `{"team_id":`, expected: http.StatusBadRequest},
+		{name: "valid", body: fmt.Sprintf(`{"team_id":%d,"amount":-5,"reason":"  broke the rules  "}`, team.ID), expected: http.StatusCreated},
+	}
+
+	var created db.ManualAdjustmentSchema
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := asAdmin(httptest.NewRequest("POST", "/api/admin/adjustments", strings.NewReader(tt.body)))
+			rr := httptest.NewRecorder()
+
+			api.CreateAdjustment(rr, req)
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+			if tt.expected == http.StatusCreated {
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+			}
+		})
+	}
+
+	// only the valid adjustment was saved
+	adjustments, err := db.GetTeamManualAdjustments(team.ID)
+	require.NoError(t, err)
+	require.Len(t, adjustments, 1)
+	assert.Equal(t, created.ID, adjustments[0].ID)
+	assert.Equal(t, -5, adjustments[0].Amount)
+	assert.Equal(t, "broke the rules", adjustments[0].Reason)
+	assert.Equal(t, "admin", adjustments[0].Author)
+
+	revoke := func(id string) *httptest.ResponseRecorder {
+		req := asAdmin(httptest.NewRequest("POST", "/api/admin/adjustments/"+id+"/revoke", nil))
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		api.RevokeAdjustment(rr, req)
+		return rr
+	}
+
+	id := fmt.Sprintf("%d", created.ID)
+	rr := revoke(id)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// the second revoke is turned away and the first revoker stays on record
+	rr = revoke(id)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	adjustments, err = db.GetTeamManualAdjustments(team.ID)
+	require.NoError(t, err)
+	require.Len(t, adjustments, 1)
+	assert.True(t, adjustments[0].Revoked)
+	assert.Equal(t, "admin", adjustments[0].RevokedBy)
+
+	assert.Equal(t, http.StatusNotFound, revoke(fmt.Sprintf("%d", created.ID+1000)).Code)
+	assert.Equal(t, http.StatusBadRequest, revoke("abc").Code)
+}
@@ -0,0 +1,89 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"quotient/engine/config"
+	"quotient/engine/db"
+	"quotient/tests/testutil"
+	"quotient/www/api"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAttackEvidenceImages tests an attack with evidence images can be approved
+// and read back by every query the red team pages use
+func TestAttackEvidenceImages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	pgContainer := testutil.StartPostgres(t)
+	defer pgContainer.Close()
+	db.Connect(pgContainer.ConnectionString())
+
+	api.SetConfig(&config.ConfigSettings{RedTeamSettings: config.RedTeamConfig{AdminAccessPenalty: 20, PasswordPenalty: 5}})
+	t.Cleanup(func() { api.SetConfig(nil) })
+
+	team := createTestTeam(t, "Attack Team", "01")
+	vector, err := db.CreateVector(db.VectorSchema{Port: 22, Protocol: "tcp"})
+	require.NoError(t, err)
+
+	images := pq.StringArray{"/submissions/red/1/1/whoami.png", "/submissions/red/1/1/shadow.png"}
+	attack, err := db.CreateAttack(db.AttackSchema{
+		VectorID:           vector.ID,
+		TeamID:             team.ID,
+		Narrative:          "reused ssh key",
+		EvidenceImages:     images,
+		AccessLevel:        int(db.ADMIN),
+		DataAccessPassword: true,
+	})
+	require.NoError(t, err)
+
+	// approve it the way an admin does, which reads it back first
+	id := fmt.Sprintf("%d", attack.ID)
+	req := httptest.NewRequest("POST", "/api/admin/attacks/"+id+"/review", strings.NewReader(`{"approve":true}`))
+	req.SetPathValue("id", id)
+	req = req.WithContext(context.WithValue(req.Context(), "username", "admin"))
+	rr := httptest.NewRecorder()
+	api.ReviewAttack(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	got, err := db.GetAttackByID(attack.ID)
+	require.NoError(t, err)
+	assert.Equal(t, images, got.EvidenceImages)
+	assert.Equal(t, db.AttackApproved, got.Status)
+	assert.Equal(t, 25, got.Penalty)
+
+	all, err := db.GetAttacks()
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	for _, a := range all {
+		if a.ID == attack.ID {
+			assert.Equal(t, images, a.EvidenceImages)
+		}
+	}
+
+	approved, err := db.GetApprovedAttacks()
+	require.NoError(t, err)
+	require.NotEmpty(t, approved)
+	for _, a := range approved {
+		if a.ID == attack.ID {
+			assert.Equal(t, images, a.EvidenceImages)
+		}
+	}
+
+	// saving it back, as toggling whether it still works does, keeps the images
+	got.StillWorks = false
+	_, err = db.UpdateAttack(got)
+	require.NoError(t, err)
+	got, err = db.GetAttackByID(attack.ID)
+	require.NoError(t, err)
+	assert.Equal(t, images, got.EvidenceImages)
+}
@@ -0,0 +1,115 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"quotient/engine/config"
+	"quotient/engine/db"
+	"quotient/tests/testutil"
+	"quotient/www/api"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIncidentReportAttachments tests reports with attachments can be read back
+// by every query the incident pages use
+func TestIncidentReportAttachments(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	pgContainer := testutil.StartPostgres(t)
+	defer pgContainer.Close()
+	db.Connect(pgContainer.ConnectionString())
+
+	team := createTestTeam(t, "Incident Team", "01")
+
+	// attachments are saved after the report, once its upload directory exists
+	report, err := db.CreateIncidentReport(db.IncidentReportSchema{TeamID: team.ID, SubmittedAt: time.Now(), OccurredAt: time.Now(), BoxName: "box01", Description: "webshell in uploads"})
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateIncidentReportAttachments(report.ID, []string{"access.log", "shell.php.txt"}))
+
+	// and a report created with them already set
+	other, err := db.CreateIncidentReport(db.IncidentReportSchema{TeamID: team.ID, SubmittedAt: time.Now(), OccurredAt: time.Now(), BoxName: "box01", Description: "new admin user",
+		Attachments: pq.StringArray{"users.png"}})
+	require.NoError(t, err)
+
+	got, err := db.GetIncidentReportByID(report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pq.StringArray{"access.log", "shell.php.txt"}, got.Attachments)
+
+	teamReports, err := db.GetTeamIncidentReports(team.ID)
+	require.NoError(t, err)
+	require.Len(t, teamReports, 2)
+	assert.Equal(t, pq.StringArray{"users.png"}, teamReports[0].Attachments)
+	assert.Equal(t, other.ID, teamReports[0].ID)
+
+	allReports, err := db.GetIncidentReports()
+	require.NoError(t, err)
+	found := 0
+	for _, r := range allReports {
+		if r.TeamID == team.ID {
+			assert.NotEmpty(t, r.Attachments)
+			found++
+		}
+	}
+	assert.Equal(t, 2, found)
+}
+
+// TestIncidentReportAttachmentFailure tests a report whose attachments can't be
+// saved is taken back out instead of being left without them
+func TestIncidentReportAttachmentFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	pgContainer := testutil.StartPostgres(t)
+	defer pgContainer.Close()
+	db.Connect(pgContainer.ConnectionString())
+	t.Chdir(t.TempDir())
+
+	api.SetConfig(&config.ConfigSettings{Box: []config.Box{{Name: "box01"}}})
+	t.Cleanup(func() { api.SetConfig(nil) })
+
+	team := createTestTeam(t, "Incident Team", "01")
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	require.NoError(t, form.WriteField("occurred-at", time.Now().UTC().Format(time.RFC3339)))
+	require.NoError(t, form.WriteField("box", "box01"))
+	require.NoError(t, form.WriteField("description", "webshell in uploads"))
+	part, err := form.CreateFormFile("attachments", "access.log")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("GET /uploads/shell.php"))
+	require.NoError(t, err)
+	// a name that can't be written as a file
+	part, err = form.CreateFormFile("attachments", ".")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("nothing"))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest("POST", "/api/incidents", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), "username", team.Name))
+	rr := httptest.NewRecorder()
+	api.CreateIncidentReport(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+
+	reports, err := db.GetTeamIncidentReports(team.ID)
+	require.NoError(t, err)
+	assert.Empty(t, reports)
+
+	entries, err := os.ReadDir(fmt.Sprintf("submissions/incidents/%d", team.ID))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "attachments left behind")
+}
@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"quotient/engine/db"
+	"quotient/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTeamScoreMatchesScoreboard tests a team's total counts manual adjustments,
+// red team penalties and incident awards the same way the per-round scoreboard does
+func TestTeamScoreMatchesScoreboard(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	pgContainer := testutil.StartPostgres(t)
+	defer pgContainer.Close()
+	db.Connect(pgContainer.ConnectionString())
+	require.NoError(t, db.ResetScores())
+
+	team := createTestTeam(t, "Score Team", "01")
+
+	_, err := db.CreateRound(db.RoundSchema{
+		ID:        1,
+		StartTime: time.Now().Add(-time.Minute),
+		Checks:    []db.ServiceCheckSchema{{TeamID: team.ID, RoundID: 1, ServiceName: "box01-web", Points: 10, Earned: 10, Result: true}},
+	})
+	require.NoError(t, err)
+
+	// an adjustment that counts and one that was revoked
+	_, err = db.CreateManualAdjustment(db.ManualAdjustmentSchema{TeamID: team.ID, CreatedAt: time.Now(), Amount: 5, Reason: "late start", Author: "admin"})
+	require.NoError(t, err)
+	revoked, err := db.CreateManualAdjustment(db.ManualAdjustmentSchema{TeamID: team.ID, CreatedAt: time.Now(), Amount: -2, Reason: "wrong team", Author: "admin"})
+	require.NoError(t, err)
+	_, err = db.RevokeManualAdjustment(revoked.ID, "admin")
+	require.NoError(t, err)
+
+	// a recurring red team penalty
+	require.NoError(t, db.CreateAttackPenalties([]db.AttackPenaltySchema{{AttackID: 1, TeamID: team.ID, RoundID: 1, Points: 4}}))
+
+	// an incident report linked for credit
+	report, err := db.CreateIncidentReport(db.IncidentReportSchema{TeamID: team.ID, SubmittedAt: time.Now(), OccurredAt: time.Now(), BoxName: "box01", Description: "webshell"})
+	require.NoError(t, err)
+	attackID := uint(1)
+	report.AttackID = &attackID
+	report.Award = 3
+	report.ReviewedBy = "admin"
+	report.ReviewedAt = time.Now()
+	_, err = db.LinkIncidentReport(report)
+	require.NoError(t, err)
+
+	earned, _, _, err := db.GetTeamScore(team.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 14, earned)
+
+	require.NoError(t, db.RefreshScoresMaterializedView())
+	sums, err := db.GetServiceCheckSumByRound()
+	require.NoError(t, err)
+	require.NotEmpty(t, sums)
+	assert.Equal(t, earned, sums[len(sums)-1][team.ID])
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"quotient/engine/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func GetAdjustments(w http.ResponseWriter, r *http.Request) {
+	adjustments, err := db.GetManualAdjustments()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve adjustments"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, adjustments)
+}
+
+func CreateAdjustment(w http.ResponseWriter, r *http.Request) {
+	type Form struct {
+		TeamID uint   `json:"team_id"`
+		Amount int    `json:"amount"`
+		Reason string `json:"reason"`
+	}
+
+	var form Form
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		return
+	}
+
+	form.Reason = strings.TrimSpace(form.Reason)
+	if form.Amount == 0 || form.Reason == "" {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "An adjustment needs a non-zero amount and a reason"})
+		return
+	}
+
+	teams, err := db.GetTeams()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve teams"})
+		return
+	}
+	if !slices.ContainsFunc(teams, func(team db.TeamSchema) bool { return team.ID == form.TeamID }) {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Team not found"})
+		return
+	}
+
+	adjustment, err := db.CreateManualAdjustment(db.ManualAdjustmentSchema{
+		TeamID:    form.TeamID,
+		CreatedAt: time.Now(),
+		Amount:    form.Amount,
+		Reason:    form.Reason,
+		Author:    r.Context().Value("username").(string),
+	})
+	if err != nil {
+		slog.Error("failed to create manual adjustment", "team", form.TeamID, "error", err)
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to create adjustment"})
+		return
+	}
+	slog.Info("manual adjustment created", "id", adjustment.ID, "team", adjustment.TeamID, "amount", adjustment.Amount, "author", adjustment.Author)
+
+	WriteJSON(w, http.StatusCreated, adjustment)
+}
+
+func RevokeAdjustment(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid adjustment ID"})
+		return
+	}
+
+	username := r.Context().Value("username").(string)
+	adjustment, err := db.RevokeManualAdjustment(uint(temp), username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Adjustment not found"})
+			return
+		}
+		if adjustment.Revoked {
+			WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Adjustment already revoked"})
+			return
+		}
+		slog.Error("failed to revoke manual adjustment", "id", temp, "error", err)
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to revoke adjustment"})
+		return
+	}
+	slog.Info("manual adjustment revoked", "id", adjustment.ID, "team", adjustment.TeamID, "by", username)
+
+	WriteJSON(w, http.StatusOK, adjustment)
+}
+
+// GetTeamAdjustments returns a team's own adjustment ledger
+func GetTeamAdjustments(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("team_id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid team ID"})
+		return
+	}
+	teamID := uint(temp)
+
+	if !canViewTeam(r, teamID) {
+		WriteJSON(w, http.StatusForbidden, map[string]any{"error": "Forbidden"})
+		return
+	}
+
+	adjustments, err := db.GetTeamManualAdjustments(teamID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve adjustments"})
+		return
+	}
+
+	total := 0
+	for _, adjustment := range adjustments {
+		if !adjustment.Revoked {
+			total += adjustment.Amount
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{"total": total, "adjustments": adjustments})
+}
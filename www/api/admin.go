@@ -2,10 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"quotient/engine"
 	"quotient/engine/db"
 	"regexp"
+	"strings"
 )
 
 var validIdentifierRegex = regexp.MustCompile(`^[0-9]{1,3}$`)
@@ -48,6 +51,43 @@ func ResetScores(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, map[string]any{"status": "success"})
 }
 
+// Rescore rebuilds scores from the stored check results with the current config.
+// A dry run returns the same per team diff without saving anything.
+func Rescore(w http.ResponseWriter, r *http.Request) {
+	type Form struct {
+		DryRun bool `json:"dry_run"`
+	}
+
+	var form Form
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		return
+	}
+
+	slog.Info("rescore requested", "dry_run", form.DryRun, "by", r.Context().Value("username").(string))
+	report, err := eng.Rescore(form.DryRun)
+	if err != nil {
+		slog.Error("failed to rescore", "error", err)
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to rescore"})
+		return
+	}
+
+	teams, err := db.GetTeams()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve teams"})
+		return
+	}
+	names := make(map[uint]string, len(teams))
+	for _, team := range teams {
+		names[team.ID] = team.Name
+	}
+	for i := range report.Teams {
+		report.Teams[i].TeamName = names[report.Teams[i].TeamID]
+	}
+
+	WriteJSON(w, http.StatusOK, report)
+}
+
 func SetCompetitionStarted(w http.ResponseWriter, r *http.Request) {
 	type Form struct {
 		Started bool `json:"started"`
@@ -84,6 +124,11 @@ func ExportScores(w http.ResponseWriter, r *http.Request) {
 		GrossPoints        int            `json:"gross_points"`
 		TotalSLAPenalty    int            `json:"total_sla_penalty"`
 		TotalSLAViolations int            `json:"total_sla_violations"`
+		InjectPoints       int            `json:"inject_points"`
+		AdjustmentPoints   int            `json:"adjustment_points"`
+		RedTeamPenalty     int            `json:"red_team_penalty"`
+		IncidentPoints     int            `json:"incident_points"`
+		BonusPoints        int            `json:"bonus_points"`
 	}
 
 	teams, err := db.GetTeams()
@@ -123,6 +168,71 @@ func ExportScores(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	injectScores, err := db.GetInjectScores()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve inject scores"})
+		return
+	}
+
+	for teamID, points := range injectScores {
+		if team, ok := teamScores[teamID]; ok {
+			team.InjectPoints = points
+			team.TotalPoints += points
+		}
+	}
+
+	adjustmentScores, err := db.GetManualAdjustmentScores()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve manual adjustments"})
+		return
+	}
+
+	for teamID, points := range adjustmentScores {
+		if team, ok := teamScores[teamID]; ok {
+			team.AdjustmentPoints = points
+			team.TotalPoints += points
+		}
+	}
+
+	attackPenalties, err := db.GetAttackPenaltyScores()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve red team penalties"})
+		return
+	}
+
+	for teamID, penalty := range attackPenalties {
+		if team, ok := teamScores[teamID]; ok {
+			team.RedTeamPenalty = penalty
+			team.TotalPoints -= penalty
+		}
+	}
+
+	incidentAwards, err := db.GetIncidentAwardScores()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve incident report awards"})
+		return
+	}
+
+	for teamID, points := range incidentAwards {
+		if team, ok := teamScores[teamID]; ok {
+			team.IncidentPoints = points
+			team.TotalPoints += points
+		}
+	}
+
+	bonusScores, err := db.GetScoreBonusScores()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve scoring bonuses"})
+		return
+	}
+
+	for teamID, points := range bonusScores {
+		if team, ok := teamScores[teamID]; ok {
+			team.BonusPoints = points
+			team.TotalPoints += points
+		}
+	}
+
 	var data []TeamScore
 	for _, score := range teamScores {
 		data = append(data, *score)
@@ -165,9 +275,10 @@ func GetEngine(w http.ResponseWriter, r *http.Request) {
 func UpdateTeams(w http.ResponseWriter, r *http.Request) {
 	type Form struct {
 		Teams []struct {
-			TeamID     uint   `json:"id"`
-			Identifier string `json:"identifier"`
-			Active     bool   `json:"active"`
+			TeamID     uint    `json:"id"`
+			Identifier string  `json:"identifier"`
+			Active     bool    `json:"active"`
+			Token      *string `json:"token,omitempty"`
 		} `json:"teams"`
 	}
 
@@ -188,7 +299,46 @@ func UpdateTeams(w http.ResponseWriter, r *http.Request) {
 			WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to update team"})
 			return
 		}
+
+		// a missing token leaves the saved one alone, so clients that don't know
+		// about tokens can't wipe them
+		if team.Token != nil {
+			if err := db.UpdateTeamToken(uint(team.TeamID), strings.TrimSpace(*team.Token)); err != nil {
+				WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to update team token"})
+				return
+			}
+		}
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]any{"status": "success"})
 }
+
+func GetRunners(w http.ResponseWriter, r *http.Request) {
+	runners, err := eng.GetRunners(r.Context())
+	if err != nil {
+		slog.Error("failed to get runners", "error", err)
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve runners"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, runners)
+}
+
+// RemoveRunner forgets a dead runner, such as one that was scaled down
+func RemoveRunner(w http.ResponseWriter, r *http.Request) {
+	err := eng.RemoveRunner(r.Context(), r.PathValue("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, engine.ErrRunnerNotFound):
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Runner not found"})
+		case errors.Is(err, engine.ErrRunnerAlive):
+			WriteJSON(w, http.StatusConflict, map[string]any{"error": "Runner is still alive"})
+		default:
+			slog.Error("failed to remove runner", "runner", r.PathValue("id"), "error", err)
+			WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to remove runner"})
+		}
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{"message": "Runner removed"})
+}
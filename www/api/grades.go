@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"quotient/engine/db"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// parseInjectGrading applies the grading fields of an inject form. Fields that
+// aren't in the form are left alone so updates don't have to resend them.
+func parseInjectGrading(r *http.Request, inject *db.InjectSchema) error {
+	if maxPointsStr := r.FormValue("max-points"); maxPointsStr != "" {
+		maxPoints, err := strconv.Atoi(maxPointsStr)
+		if err != nil || maxPoints < 0 {
+			return errors.New("Invalid max points")
+		}
+		inject.MaxPoints = maxPoints
+	}
+
+	if latePolicy := r.FormValue("late-policy"); latePolicy != "" {
+		if !slices.Contains([]string{db.LatePolicyNone, db.LatePolicyFlat, db.LatePolicyLinear}, latePolicy) {
+			return errors.New("Invalid late policy")
+		}
+		inject.LatePolicy = latePolicy
+	}
+	if inject.LatePolicy == "" {
+		inject.LatePolicy = db.LatePolicyNone
+	}
+
+	if latePenaltyStr := r.FormValue("late-penalty"); latePenaltyStr != "" {
+		latePenalty, err := strconv.Atoi(latePenaltyStr)
+		if err != nil || latePenalty < 0 || latePenalty > 100 {
+			return errors.New("Late penalty must be a percentage between 0 and 100")
+		}
+		inject.LatePenalty = latePenalty
+	}
+
+	if rubricStr := r.FormValue("rubric"); rubricStr != "" {
+		var rubric []db.RubricCriterion
+		if err := json.Unmarshal([]byte(rubricStr), &rubric); err != nil {
+			return errors.New("Invalid rubric format")
+		}
+		seen := make(map[string]bool)
+		for _, criterion := range rubric {
+			if criterion.Name == "" || criterion.MaxPoints <= 0 {
+				return errors.New("Rubric criteria need a name and positive max points")
+			}
+			if seen[criterion.Name] {
+				return fmt.Errorf("Duplicate rubric criterion %q", criterion.Name)
+			}
+			seen[criterion.Name] = true
+		}
+		inject.Rubric = rubric
+	}
+
+	// the rubric decides the max points when there is one
+	if len(inject.Rubric) > 0 {
+		inject.MaxPoints = 0
+		for _, criterion := range inject.Rubric {
+			inject.MaxPoints += criterion.MaxPoints
+		}
+	}
+
+	return nil
+}
+
+// scoreRubric totals a grade against an inject's rubric. Injects without a rubric
+// are graded with a single overall score.
+func scoreRubric(inject db.InjectSchema, scores []db.CriterionScore, overall int) (int, error) {
+	if len(inject.Rubric) == 0 {
+		if overall < 0 || overall > inject.MaxPoints {
+			return 0, fmt.Errorf("Points must be between 0 and %d", inject.MaxPoints)
+		}
+		return overall, nil
+	}
+
+	if len(scores) != len(inject.Rubric) {
+		return 0, errors.New("Every rubric criterion needs a score")
+	}
+
+	total := 0
+	for _, criterion := range inject.Rubric {
+		i := slices.IndexFunc(scores, func(s db.CriterionScore) bool { return s.Criterion == criterion.Name })
+		if i == -1 {
+			return 0, fmt.Errorf("Missing score for %q", criterion.Name)
+		}
+		if scores[i].Points < 0 || scores[i].Points > criterion.MaxPoints {
+			return 0, fmt.Errorf("Score for %q must be between 0 and %d", criterion.Name, criterion.MaxPoints)
+		}
+		total += scores[i].Points
+	}
+	return total, nil
+}
+
+func GradeSubmission(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid inject id"})
+		return
+	}
+	injectID := uint(temp)
+
+	type Form struct {
+		TeamID   uint                `json:"team_id"`
+		Version  int                 `json:"version"`
+		Scores   []db.CriterionScore `json:"scores"`
+		Points   int                 `json:"points"` // only used by injects without a rubric
+		Comments string              `json:"comments"`
+	}
+
+	var form Form
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		return
+	}
+
+	inject, err := db.GetInjectByID(injectID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Inject not found"})
+			return
+		}
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving the inject"})
+		return
+	}
+
+	submissions, err := db.GetSubmissionsForInject(injectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving submissions"})
+		return
+	}
+	i := slices.IndexFunc(submissions, func(s db.SubmissionSchema) bool {
+		return s.TeamID == form.TeamID && s.Version == form.Version
+	})
+	if i == -1 {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Submission not found"})
+		return
+	}
+	submission := submissions[i]
+
+	raw, err := scoreRubric(inject, form.Scores, form.Points)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	penalty := inject.LateDeduction(raw, submission.SubmissionTime)
+
+	grade, err := db.SaveInjectGrade(db.InjectGradeSchema{
+		InjectID: injectID,
+		TeamID:   submission.TeamID,
+		Version:  submission.Version,
+		Grader:   r.Context().Value("username").(string),
+		Scores:   form.Scores,
+		Comments: form.Comments,
+		Raw:      raw,
+		Penalty:  penalty,
+		Points:   raw - penalty,
+		GradedAt: time.Now(),
+	})
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error saving the grade"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{"message": "Submission graded successfully", "points": grade.Points, "penalty": grade.Penalty})
+}
+
+func GetInjectGrades(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid inject id"})
+		return
+	}
+
+	grades, err := db.GetInjectGrades(uint(temp))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving grades"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, grades)
+}
+
+// GetInjectFeedback shows a team the grades and comments on their own submissions
+func GetInjectFeedback(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid inject id"})
+		return
+	}
+	injectID := uint(temp)
+
+	teamID, err := getUserTeamID(r.Context().Value("username").(string))
+	if err != nil {
+		WriteJSON(w, http.StatusForbidden, map[string]any{"error": "User is not on a team"})
+		return
+	}
+
+	inject, err := db.GetInjectByID(injectID)
+	if err != nil || time.Now().Before(inject.OpenTime) {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Inject not found"})
+		return
+	}
+
+	grades, err := db.GetTeamInjectGrades(injectID, teamID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving grades"})
+		return
+	}
+
+	type Feedback struct {
+		Version  int                 `json:"version"`
+		Scores   []db.CriterionScore `json:"scores"`
+		Comments string              `json:"comments"`
+		Raw      int                 `json:"raw"`
+		Penalty  int                 `json:"penalty"`
+		Points   int                 `json:"points"`
+		GradedAt time.Time           `json:"graded_at"`
+		Counted  bool                `json:"counted"` // the highest graded version is what counts
+	}
+
+	feedback := make([]Feedback, 0, len(grades))
+	for i, grade := range grades {
+		feedback = append(feedback, Feedback{
+			Version:  grade.Version,
+			Scores:   grade.Scores,
+			Comments: grade.Comments,
+			Raw:      grade.Raw,
+			Penalty:  grade.Penalty,
+			Points:   grade.Points,
+			GradedAt: grade.GradedAt,
+			Counted:  i == 0,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"max_points":   inject.MaxPoints,
+		"rubric":       inject.Rubric,
+		"late_policy":  inject.LatePolicy,
+		"late_penalty": inject.LatePenalty,
+		"feedback":     feedback,
+	})
+}
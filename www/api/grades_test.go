@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"quotient/engine/db"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInjectGrading(t *testing.T) {
+	tests := []struct {
+		name        string
+		form        url.Values
+		existing    db.InjectSchema
+		expectError bool
+		expected    db.InjectSchema
+	}{
+		{
+			name:     "defaults to no late policy",
+			form:     url.Values{"max-points": {"20"}},
+			expected: db.InjectSchema{MaxPoints: 20, LatePolicy: db.LatePolicyNone},
+		},
+		{
+			name: "rubric sets max points",
+			form: url.Values{
+				"max-points":   {"5"},
+				"late-policy":  {"linear"},
+				"late-penalty": {"30"},
+				"rubric":       {`[{"name":"report","max_points":10},{"name":"evidence","max_points":5}]`},
+			},
+			expected: db.InjectSchema{
+				MaxPoints:   15,
+				LatePolicy:  db.LatePolicyLinear,
+				LatePenalty: 30,
+				Rubric:      []db.RubricCriterion{{Name: "report", MaxPoints: 10}, {Name: "evidence", MaxPoints: 5}},
+			},
+		},
+		{
+			name:     "missing fields keep existing values",
+			form:     url.Values{},
+			existing: db.InjectSchema{MaxPoints: 10, LatePolicy: db.LatePolicyFlat, LatePenalty: 10},
+			expected: db.InjectSchema{MaxPoints: 10, LatePolicy: db.LatePolicyFlat, LatePenalty: 10},
+		},
+		{
+			name:     "empty rubric clears it",
+			form:     url.Values{"rubric": {"[]"}, "max-points": {"8"}},
+			existing: db.InjectSchema{Rubric: []db.RubricCriterion{{Name: "old", MaxPoints: 3}}, LatePolicy: db.LatePolicyNone},
+			expected: db.InjectSchema{MaxPoints: 8, LatePolicy: db.LatePolicyNone, Rubric: []db.RubricCriterion{}},
+		},
+		{name: "bad late policy", form: url.Values{"late-policy": {"double"}}, expectError: true},
+		{name: "penalty over 100", form: url.Values{"late-penalty": {"101"}}, expectError: true},
+		{name: "negative max points", form: url.Values{"max-points": {"-1"}}, expectError: true},
+		{name: "malformed rubric", form: url.Values{"rubric": {"{"}}, expectError: true},
+		{name: "criterion without points", form: url.Values{"rubric": {`[{"name":"report"}]`}}, expectError: true},
+		{name: "duplicate criterion", form: url.Values{"rubric": {`[{"name":"a","max_points":1},{"name":"a","max_points":1}]`}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/injects/create", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			inject := tt.existing
+			err := parseInjectGrading(r, &inject)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, inject)
+		})
+	}
+}
+
+func TestScoreRubric(t *testing.T) {
+	rubric := db.InjectSchema{
+		MaxPoints: 15,
+		Rubric:    []db.RubricCriterion{{Name: "report", MaxPoints: 10}, {Name: "evidence", MaxPoints: 5}},
+	}
+	overall := db.InjectSchema{MaxPoints: 20}
+
+	tests := []struct {
+		name        string
+		inject      db.InjectSchema
+		scores      []db.CriterionScore
+		points      int
+		expected    int
+		expectError bool
+	}{
+		{
+			name:     "rubric total",
+			inject:   rubric,
+			scores:   []db.CriterionScore{{Criterion: "evidence", Points: 4}, {Criterion: "report", Points: 9}},
+			expected: 13,
+		},
+		{
+			name:        "criterion over max",
+			inject:      rubric,
+			scores:      []db.CriterionScore{{Criterion: "report", Points: 11}, {Criterion: "evidence", Points: 0}},
+			expectError: true,
+		},
+		{
+			name:        "missing criterion",
+			inject:      rubric,
+			scores:      []db.CriterionScore{{Criterion: "report", Points: 5}, {Criterion: "other", Points: 1}},
+			expectError: true,
+		},
+		{
+			name:        "wrong number of scores",
+			inject:      rubric,
+			scores:      []db.CriterionScore{{Criterion: "report", Points: 5}},
+			expectError: true,
+		},
+		{name: "overall score", inject: overall, points: 17, expected: 17},
+		{name: "overall score over max", inject: overall, points: 21, expectError: true},
+		{name: "negative overall score", inject: overall, points: -1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, err := scoreRubric(tt.inject, tt.scores, tt.points)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, total)
+		})
+	}
+}
@@ -216,6 +216,63 @@ func GetUptimeStatus(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, data)
 }
 
+func GetKothStatus(w http.ResponseWriter, r *http.Request) {
+	if !CheckCompetitionStarted(w, r) {
+		return
+	}
+
+	records, err := db.GetKothOwnership()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	teams, err := db.GetTeams()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	scrub := shouldScrub(r)
+	teamNames := make(map[uint]string, len(teams))
+	for _, team := range teams {
+		if scrub {
+			teamNames[team.ID] = "Team"
+		} else {
+			teamNames[team.ID] = team.Name
+		}
+	}
+
+	type Point struct {
+		Round  uint
+		Owner  string
+		Points int
+	}
+	type Series struct {
+		Name  string
+		Owner string
+		Data  []Point
+	}
+
+	// records are ordered by round so the last point is the current owner
+	series := []Series{}
+	boxIndex := make(map[string]int)
+	for _, record := range records {
+		i, ok := boxIndex[record.BoxName]
+		if !ok {
+			i = len(series)
+			boxIndex[record.BoxName] = i
+			series = append(series, Series{Name: record.BoxName})
+		}
+		owner := teamNames[record.TeamID]
+		series[i].Owner = owner
+		series[i].Data = append(series[i].Data, Point{Round: record.RoundID, Owner: owner, Points: record.Points})
+	}
+
+	data := map[string]any{"series": series}
+	WriteJSON(w, http.StatusOK, data)
+}
+
 func shouldScrub(r *http.Request) bool {
 	if r.Context().Value("roles") != nil {
 		req_roles := r.Context().Value("roles").([]string)
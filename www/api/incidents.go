@@ -0,0 +1,277 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"quotient/engine/config"
+	"quotient/engine/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// parseIncidentReport reads the structured fields of an incident report form
+func parseIncidentReport(r *http.Request) (db.IncidentReportSchema, error) {
+	report := db.IncidentReportSchema{
+		BoxName:     strings.TrimSpace(r.FormValue("box")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Indicators:  strings.TrimSpace(r.FormValue("indicators")),
+		Remediation: strings.TrimSpace(r.FormValue("remediation")),
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339, r.FormValue("occurred-at"))
+	if err != nil {
+		return report, errors.New("Invalid incident time")
+	}
+	report.OccurredAt = occurredAt
+
+	if report.BoxName == "" || report.Description == "" {
+		return report, errors.New("An incident report needs an affected box and a description")
+	}
+	if !slices.ContainsFunc(conf.Box, func(box config.Box) bool { return box.Name == report.BoxName }) {
+		return report, errors.New("Unknown box")
+	}
+
+	return report, nil
+}
+
+func CreateIncidentReport(w http.ResponseWriter, r *http.Request) {
+	teamID, err := getUserTeamID(r.Context().Value("username").(string))
+	if err != nil || teamID == 0 {
+		WriteJSON(w, http.StatusForbidden, map[string]any{"error": "User is not on a team"})
+		return
+	}
+
+	if err := r.ParseMultipartForm(50 << 20); err != nil { // 50 MB
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Error parsing the form"})
+		return
+	}
+
+	report, err := parseIncidentReport(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	report.TeamID = teamID
+	report.SubmittedAt = time.Now()
+
+	report, err = db.CreateIncidentReport(report)
+	if err != nil {
+		slog.Error("failed to create incident report", "team", teamID, "error", err)
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error creating the incident report"})
+		return
+	}
+
+	files := r.MultipartForm.File["attachments"]
+	if len(files) > 0 {
+		uploadDir := fmt.Sprintf("submissions/incidents/%d/%d", teamID, report.ID)
+
+		// the report needs its ID before attachments can be saved, so take it back
+		// out if they can't be rather than leave a report missing its evidence
+		discard := func() {
+			if err := os.RemoveAll(uploadDir); err != nil {
+				slog.Error("failed to remove incident attachments", "report", report.ID, "error", err)
+			}
+			if err := db.DeleteIncidentReport(report); err != nil {
+				slog.Error("failed to delete incident report", "report", report.ID, "error", err)
+			}
+		}
+
+		if err := os.MkdirAll(uploadDir, 0750); err != nil {
+			discard()
+			WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error creating directories"})
+			return
+		}
+
+		attachments := make([]string, 0, len(files))
+		for _, fileHeader := range files {
+			filename := filepath.Base(fileHeader.Filename)
+			if err := saveUpload(uploadDir, filename, fileHeader); err != nil {
+				slog.Error("failed to save incident attachment", "report", report.ID, "file", filename, "error", err)
+				discard()
+				WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error saving attachments"})
+				return
+			}
+			attachments = append(attachments, filename)
+		}
+
+		if err := db.UpdateIncidentReportAttachments(report.ID, attachments); err != nil {
+			slog.Error("failed to save incident attachment names", "report", report.ID, "error", err)
+			discard()
+			WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error saving attachments"})
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]any{"message": "Incident report submitted successfully", "id": report.ID})
+}
+
+// saveUpload copies an uploaded file into a directory
+func saveUpload(dir string, filename string, fileHeader *multipart.FileHeader) error {
+	in, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := SafeCreate(dir, filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// GetIncidentReports returns every report to admins and a team's own reports to everyone else
+func GetIncidentReports(w http.ResponseWriter, r *http.Request) {
+	var reports []db.IncidentReportSchema
+	var err error
+
+	req_roles := r.Context().Value("roles").([]string)
+	if slices.Contains(req_roles, "admin") {
+		reports, err = db.GetIncidentReports()
+	} else {
+		teamID, teamErr := getUserTeamID(r.Context().Value("username").(string))
+		if teamErr != nil || teamID == 0 {
+			WriteJSON(w, http.StatusForbidden, map[string]any{"error": "User is not on a team"})
+			return
+		}
+		reports, err = db.GetTeamIncidentReports(teamID)
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving incident reports"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{"reports": reports, "share": conf.RedTeamSettings.IncidentReportShare})
+}
+
+func DownloadIncidentAttachment(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid incident report id"})
+		return
+	}
+
+	report, err := db.GetIncidentReportByID(uint(temp))
+	if err != nil {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Incident report not found"})
+		return
+	}
+
+	if !canViewTeam(r, report.TeamID) {
+		WriteJSON(w, http.StatusForbidden, map[string]any{"error": "Forbidden"})
+		return
+	}
+
+	filename := r.PathValue("file")
+	if !slices.Contains(report.Attachments, filename) {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"error": "File not found"})
+		return
+	}
+
+	file, err := SafeOpen(fmt.Sprintf("submissions/incidents/%d/%d", report.TeamID, report.ID), filename)
+	if err != nil {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"error": "File not found"})
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := io.Copy(w, file); err != nil {
+		slog.Error("failed to send incident attachment", "report", report.ID, "file", filename, "error", err)
+	}
+}
+
+// LinkIncidentReport links a report to the approved attack it describes and gives
+// the team back a share of that attack's penalty
+func LinkIncidentReport(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid incident report id"})
+		return
+	}
+
+	type Form struct {
+		AttackID uint `json:"attack_id"`
+		Award    *int `json:"award,omitempty"` // defaults to the configured share of the penalty
+	}
+
+	var form Form
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		return
+	}
+
+	report, err := db.GetIncidentReportByID(uint(temp))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Incident report not found"})
+			return
+		}
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving the incident report"})
+		return
+	}
+	if report.AttackID != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Incident report is already linked"})
+		return
+	}
+
+	attack, err := db.GetAttackByID(form.AttackID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Attack not found"})
+			return
+		}
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Error retrieving the attack"})
+		return
+	}
+	if attack.Status != db.AttackApproved {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Only approved attacks can be linked"})
+		return
+	}
+	if attack.TeamID != report.TeamID {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Attack was against a different team"})
+		return
+	}
+
+	award := attack.IncidentAward(conf.RedTeamSettings.IncidentReportShare)
+	if form.Award != nil {
+		award = *form.Award
+	}
+	if award < 0 || award > attack.Penalty {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("Award must be between 0 and %d", attack.Penalty)})
+		return
+	}
+
+	report.AttackID = &attack.ID
+	report.Award = award
+	report.ReviewedBy = r.Context().Value("username").(string)
+	report.ReviewedAt = time.Now()
+
+	if _, err := db.LinkIncidentReport(report); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Attack is already linked to another report"})
+			return
+		}
+		slog.Error("failed to link incident report", "report", report.ID, "attack", attack.ID, "error", err)
+		WriteJSON(w, http.StatusConflict, map[string]any{"error": "Failed to link incident report"})
+		return
+	}
+	slog.Info("incident report linked", "report", report.ID, "attack", attack.ID, "team", report.TeamID, "award", award, "by", report.ReviewedBy)
+
+	WriteJSON(w, http.StatusOK, report)
+}
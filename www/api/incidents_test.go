@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"quotient/engine/config"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIncidentReport(t *testing.T) {
+	prev := conf
+	conf = &config.ConfigSettings{Box: []config.Box{{Name: "web01"}, {Name: "dc01"}}}
+	t.Cleanup(func() { conf = prev })
+
+	valid := func() url.Values {
+		return url.Values{
+			"occurred-at": {"2025-01-01T12:30:00Z"},
+			"box":         {" dc01 "},
+			"description": {"new admin account"},
+			"indicators":  {"user evil"},
+			"remediation": {"deleted it"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		mutate      func(v url.Values)
+		expectError bool
+	}{
+		{name: "valid"},
+		{name: "bad time", mutate: func(v url.Values) { v.Set("occurred-at", "yesterday") }, expectError: true},
+		{name: "no box", mutate: func(v url.Values) { v.Del("box") }, expectError: true},
+		{name: "unknown box", mutate: func(v url.Values) { v.Set("box", "mail01") }, expectError: true},
+		{name: "no description", mutate: func(v url.Values) { v.Set("description", "   ") }, expectError: true},
+		{name: "optional fields", mutate: func(v url.Values) { v.Del("indicators"); v.Del("remediation") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := valid()
+			if tt.mutate != nil {
+				tt.mutate(form)
+			}
+			r := httptest.NewRequest("POST", "/api/incidents", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			report, err := parseIncidentReport(r)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "dc01", report.BoxName)
+			assert.Equal(t, time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC), report.OccurredAt.UTC())
+			assert.Equal(t, form.Get("indicators"), report.Indicators)
+		})
+	}
+}
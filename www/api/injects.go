@@ -160,6 +160,11 @@ func CreateInject(w http.ResponseWriter, r *http.Request) {
 		InjectFileNames: filenames,
 	}
 
+	if err := parseInjectGrading(r, &inject); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
 	if inject.OpenTime.After(inject.DueTime) {
 		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Open time must be before due time"})
 		return
@@ -273,6 +278,11 @@ func UpdateInject(w http.ResponseWriter, r *http.Request) {
 		inject.CloseTime = closeTime
 	}
 
+	if err := parseInjectGrading(r, &inject); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
 	if inject.OpenTime.After(inject.DueTime) {
 		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Open time must be before due time"})
 		return
@@ -35,14 +35,24 @@ func buildMetadata() MetadataResponse {
 
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Custom, "custom")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Dns, "dns")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Docker, "docker")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Ftp, "ftp")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Imap, "imap")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Kerberos, "kerberos")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Kubernetes, "kubernetes")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Ldap, "ldap")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Mail, "mail")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Memcached, "memcached")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Mongo, "mongo")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Mqtt, "mqtt")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Ntp, "ntp")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Ping, "ping")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Pop3, "pop3")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Rdp, "rdp")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Redis, "redis")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Smb, "smb")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Smtp, "smtp")...)
+		boxMeta.Services = append(boxMeta.Services, extractServices(box.Snmp, "snmp")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Sql, "sql")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Ssh, "ssh")...)
 		boxMeta.Services = append(boxMeta.Services, extractServices(box.Tcp, "tcp")...)
@@ -66,22 +76,42 @@ func extractServices[T checks.Runner](services []T, serviceType string) []string
 			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Dns); ok {
 			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Docker); ok {
+			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Ftp); ok {
 			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Imap); ok {
 			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Kerberos); ok {
+			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Kubernetes); ok {
+			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Ldap); ok {
 			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Mail); ok {
+			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Memcached); ok {
+			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Mongo); ok {
+			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Mqtt); ok {
+			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Ntp); ok {
+			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Ping); ok {
 			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Pop3); ok {
 			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Rdp); ok {
 			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Redis); ok {
+			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Smb); ok {
 			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Smtp); ok {
 			displayName = svc.Display
+		} else if svc, ok := interface{}(service).(*checks.Snmp); ok {
+			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Sql); ok {
 			displayName = svc.Display
 		} else if svc, ok := interface{}(service).(*checks.Ssh); ok {
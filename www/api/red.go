@@ -2,12 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"quotient/engine/db"
 	"strconv"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 func GetRed(w http.ResponseWriter, r *http.Request) {
@@ -48,10 +52,21 @@ func GetRed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// red only needs to tell teams apart, and must not see their koth tokens
+	type Team struct {
+		ID         uint
+		Name       string
+		Identifier string
+	}
+	redTeams := make([]Team, 0, len(teams))
+	for _, team := range teams {
+		redTeams = append(redTeams, Team{ID: team.ID, Name: team.Name, Identifier: team.Identifier})
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]any{
 		"vulns":   vulns,
 		"boxes":   boxes,
-		"teams":   teams,
+		"teams":   redTeams,
 		"attacks": attacks,
 	})
 }
@@ -247,5 +262,144 @@ func CreateAttack(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusCreated, map[string]any{"message": "Attack created successfully"})
 }
 
+// EditAttack updates an attack's report. The penalty is fixed when the attack is
+// approved, so afterwards this mostly matters for stopping recurring penalties.
 func EditAttack(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid attack ID"})
+		return
+	}
+
+	attack, err := db.GetAttackByID(uint(temp))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Attack not found"})
+			return
+		}
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to get attack"})
+		slog.Error("", "request_id", r.Context().Value("request_id"), "error", err.Error())
+		return
+	}
+
+	if c := r.FormValue("access-level"); c != "" {
+		access, err := strconv.Atoi(c)
+		if err != nil {
+			WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Failed to convert access level"})
+			return
+		}
+		attack.AccessLevel = access
+	}
+	if narrative := r.FormValue("narrative"); narrative != "" {
+		attack.Narrative = narrative
+	}
+
+	attack.StillWorks = r.FormValue("active") == "true"
+	attack.DataAccessPII = r.FormValue("accessedpii") == "true"
+	attack.DataAccessPassword = r.FormValue("accessedpassword") == "true"
+	attack.DataAccessSystemConfiguration = r.FormValue("accessedsysconfig") == "true"
+	attack.DataAccessDatabase = r.FormValue("accesseddatabases") == "true"
+
+	if _, err := db.UpdateAttack(attack); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to update attack"})
+		slog.Error("", "request_id", r.Context().Value("request_id"), "error", err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{"message": "Attack updated successfully"})
+}
+
+// GetAttackReviews lists attacks for admins along with the penalty the current
+// scoring policy would give them
+func GetAttackReviews(w http.ResponseWriter, r *http.Request) {
+	attacks, err := db.GetAttacks()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to get attacks"})
+		return
+	}
+
+	type Review struct {
+		db.AttackSchema
+		SuggestedPenalty          int `json:"suggested_penalty"`
+		SuggestedRecurringPenalty int `json:"suggested_recurring_penalty"`
+	}
+
+	reviews := make([]Review, 0, len(attacks))
+	for _, attack := range attacks {
+		reviews = append(reviews, Review{
+			AttackSchema:              attack,
+			SuggestedPenalty:          attack.ScorePenalty(conf.RedTeamSettings),
+			SuggestedRecurringPenalty: conf.RedTeamSettings.RecurringPenalty,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, reviews)
+}
+
+// ReviewAttack approves or rejects a pending attack. Admins can override the
+// policy's penalties when approving.
+func ReviewAttack(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid attack ID"})
+		return
+	}
+
+	type Form struct {
+		Approve          bool `json:"approve"`
+		Penalty          *int `json:"penalty,omitempty"`
+		RecurringPenalty *int `json:"recurring_penalty,omitempty"`
+	}
+
+	var form Form
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		return
+	}
+
+	attack, err := db.GetAttackByID(uint(temp))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Attack not found"})
+			return
+		}
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to get attack"})
+		return
+	}
+	if attack.Status != db.AttackPending {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Attack has already been reviewed"})
+		return
+	}
+
+	attack.ReviewedBy = r.Context().Value("username").(string)
+	attack.ReviewedAt = time.Now()
+	if form.Approve {
+		attack.Status = db.AttackApproved
+		attack.Penalty = attack.ScorePenalty(conf.RedTeamSettings)
+		attack.RecurringPenalty = conf.RedTeamSettings.RecurringPenalty
+		if form.Penalty != nil {
+			attack.Penalty = *form.Penalty
+		}
+		if form.RecurringPenalty != nil {
+			attack.RecurringPenalty = *form.RecurringPenalty
+		}
+		if attack.Penalty < 0 || attack.RecurringPenalty < 0 {
+			WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Penalties must not be negative"})
+			return
+		}
+		if eng != nil {
+			attack.ApprovedRound = eng.CurrentRound
+		}
+	} else {
+		attack.Status = db.AttackRejected
+	}
+
+	if _, err := db.ReviewAttack(attack); err != nil {
+		slog.Error("failed to review attack", "id", attack.ID, "error", err)
+		WriteJSON(w, http.StatusConflict, map[string]any{"error": "Failed to review attack"})
+		return
+	}
+	slog.Info("attack reviewed", "id", attack.ID, "team", attack.TeamID, "status", attack.Status, "penalty", attack.Penalty, "by", attack.ReviewedBy)
+
+	WriteJSON(w, http.StatusOK, attack)
 }
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"quotient/engine"
+	"quotient/engine/db"
+	"strconv"
+)
+
+// RerunCheck runs one team's check from an earlier round again
+func RerunCheck(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("round"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid round"})
+		return
+	}
+	roundID := uint(temp)
+
+	type Form struct {
+		TeamID      uint   `json:"team_id"`
+		ServiceName string `json:"service_name"`
+	}
+
+	var form Form
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		return
+	}
+
+	override, err := eng.RerunCheck(roundID, form.TeamID, form.ServiceName, r.Context().Value("username").(string))
+	if err != nil {
+		if errors.Is(err, engine.ErrNoChecks) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Check not found"})
+			return
+		}
+		slog.Error("failed to rerun check", "round", roundID, "team", form.TeamID, "service", form.ServiceName, "error", err)
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, override)
+}
+
+// RerunRound runs every check from an earlier round again
+func RerunRound(w http.ResponseWriter, r *http.Request) {
+	temp, err := strconv.ParseUint(r.PathValue("round"), 10, 32)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid round"})
+		return
+	}
+	roundID := uint(temp)
+
+	overrides, err := eng.RerunRound(roundID, r.Context().Value("username").(string))
+	if err != nil {
+		if errors.Is(err, engine.ErrNoChecks) {
+			WriteJSON(w, http.StatusNotFound, map[string]any{"error": "Round not found"})
+			return
+		}
+		slog.Error("failed to rerun round", "round", roundID, "error", err)
+		WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, overrides)
+}
+
+func GetCheckOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := db.GetCheckOverrides()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "Failed to retrieve check overrides"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, overrides)
+}
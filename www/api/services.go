@@ -114,6 +114,21 @@ func getUserTeamID(username string) (uint, error) {
 	return me.ID, nil
 }
 
+// canViewTeam reports whether the requester may see a team's data. Admins can see
+// every team, everyone else only their own.
+func canViewTeam(r *http.Request, teamID uint) bool {
+	req_roles := r.Context().Value("roles").([]string)
+	if slices.Contains(req_roles, "admin") {
+		return true
+	}
+	myTeamID, err := getUserTeamID(r.Context().Value("username").(string))
+	if err != nil {
+		slog.Error("Failed to get user's team", "username", r.Context().Value("username").(string), "err", err)
+		return false
+	}
+	return teamID == myTeamID
+}
+
 func GetTeamSummary(w http.ResponseWriter, r *http.Request) {
 	if !CheckCompetitionStarted(w, r) {
 		return
@@ -141,6 +141,13 @@ func (router *Router) PcrPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (router *Router) IncidentsPage(w http.ResponseWriter, r *http.Request) {
+	page := template.Must(template.Must(base.Clone()).ParseFiles("./static/templates/layouts/page.html", "./static/templates/pages/incidents.html"))
+	if err := page.ExecuteTemplate(w, "base", router.pageData(r, map[string]any{"title": "Incidents"})); err != nil {
+		panic(err)
+	}
+}
+
 func (router *Router) AdminPage(w http.ResponseWriter, r *http.Request) {
 	page := template.Must(template.Must(base.Clone()).ParseFiles("./static/templates/layouts/page.html", "./static/templates/pages/admin/admin.html"))
 	if err := page.ExecuteTemplate(w, "base", router.pageData(r, map[string]any{"title": "Admin"})); err != nil {
@@ -56,6 +56,7 @@ func (router *Router) Start() {
 	mux.HandleFunc("GET /api/graphs/services", UNAUTH(api.GetServiceStatus))
 	mux.HandleFunc("GET /api/graphs/scores", UNAUTH(api.GetScoreStatus))
 	mux.HandleFunc("GET /api/graphs/uptimes", UNAUTH(api.GetUptimeStatus))
+	mux.HandleFunc("GET /api/graphs/koth", UNAUTH(api.GetKothStatus))
 
 	// public WWW routes
 	mux.HandleFunc("GET /login", router.LoginPage)
@@ -93,8 +94,13 @@ func (router *Router) Start() {
 	mux.HandleFunc("GET /api/metadata", TEAMAUTH(api.GetMetadata))
 	mux.HandleFunc("GET /api/services/{team_id}", TEAMAUTH(api.GetTeamSummary))
 	mux.HandleFunc("GET /api/services/{team_id}/{service_name}", TEAMAUTH(api.GetServiceAll))
+	mux.HandleFunc("GET /api/adjustments/{team_id}", TEAMAUTH(api.GetTeamAdjustments))
+	mux.HandleFunc("GET /api/incidents", TEAMAUTH(api.GetIncidentReports))
+	mux.HandleFunc("POST /api/incidents", TEAMAUTH(api.CreateIncidentReport))
+	mux.HandleFunc("GET /incidents/{id}/{file}", TEAMAUTH(api.DownloadIncidentAttachment))
 	mux.HandleFunc("GET /api/injects", TEAMAUTH(api.GetInjects))
 	mux.HandleFunc("POST /api/injects/{id}/submit", TEAMAUTH(api.CreateSubmission))
+	mux.HandleFunc("GET /api/injects/{id}/feedback", TEAMAUTH(api.GetInjectFeedback))
 	mux.HandleFunc("GET /injects/{id}/submissions/{team}/{version}", TEAMAUTH(api.DownloadSubmissionFile))
 	mux.HandleFunc("GET /injects/{id}/{file}", TEAMAUTH(api.DownloadInjectFile))
 
@@ -109,6 +115,8 @@ func (router *Router) Start() {
 
 	mux.HandleFunc("GET /pcr", TEAMAUTH(router.PcrPage))
 
+	mux.HandleFunc("GET /incidents", TEAMAUTH(router.IncidentsPage))
+
 	/******************************************
 	|                                         |
 	|               RED ROUTES                |
@@ -150,6 +158,8 @@ func (router *Router) Start() {
 	mux.HandleFunc("POST /api/injects/{id}", INJECTAUTH(api.UpdateInject))
 	mux.HandleFunc("DELETE /api/injects/{id}", INJECTAUTH(api.DeleteInject))
 	mux.HandleFunc("GET /api/injects/{id}/submissions/download", INJECTAUTH(api.DownloadAllSubmissions))
+	mux.HandleFunc("GET /api/injects/{id}/grades", INJECTAUTH(api.GetInjectGrades))
+	mux.HandleFunc("POST /api/injects/{id}/grades", INJECTAUTH(api.GradeSubmission))
 
 	// router.HandleFunc("POST /api/engine/service/create", ADMINAUTH(api.CreateService))
 	// router.HandleFunc("POST /api/engine/service/update", ADMINAUTH(api.UpdateService))
@@ -160,10 +170,22 @@ func (router *Router) Start() {
 	mux.HandleFunc("GET /api/engine/reset", ADMINAUTH(api.ResetScores))
 	mux.HandleFunc("GET /api/engine", ADMINAUTH(api.GetEngine))
 	mux.HandleFunc("GET /api/engine/tasks", ADMINAUTH(api.GetActiveTasks))
+	mux.HandleFunc("GET /api/engine/runners", ADMINAUTH(api.GetRunners))
+	mux.HandleFunc("DELETE /api/engine/runners/{id}", ADMINAUTH(api.RemoveRunner))
+	mux.HandleFunc("POST /api/engine/rescore", ADMINAUTH(api.Rescore))
+	mux.HandleFunc("GET /api/engine/reruns", ADMINAUTH(api.GetCheckOverrides))
+	mux.HandleFunc("POST /api/engine/reruns/{round}", ADMINAUTH(api.RerunRound))
+	mux.HandleFunc("POST /api/engine/reruns/{round}/check", ADMINAUTH(api.RerunCheck))
 	mux.HandleFunc("POST /api/competition/start", ADMINAUTH(api.SetCompetitionStarted))
 	mux.HandleFunc("POST /api/admin/teams", ADMINAUTH(api.UpdateTeams))
 	mux.HandleFunc("GET /api/admin/teamchecks", ADMINAUTH(api.GetTeamChecks))
 	mux.HandleFunc("POST /api/admin/teamchecks", ADMINAUTH(api.UpdateTeamChecks))
+	mux.HandleFunc("GET /api/admin/adjustments", ADMINAUTH(api.GetAdjustments))
+	mux.HandleFunc("POST /api/admin/adjustments", ADMINAUTH(api.CreateAdjustment))
+	mux.HandleFunc("POST /api/admin/adjustments/{id}/revoke", ADMINAUTH(api.RevokeAdjustment))
+	mux.HandleFunc("GET /api/admin/attacks", ADMINAUTH(api.GetAttackReviews))
+	mux.HandleFunc("POST /api/admin/attacks/{id}/review", ADMINAUTH(api.ReviewAttack))
+	mux.HandleFunc("POST /api/admin/incidents/{id}/link", ADMINAUTH(api.LinkIncidentReport))
 
 	mux.HandleFunc("GET /api/engine/export/scores", ADMINAUTH(api.ExportScores))
 	mux.HandleFunc("GET /api/engine/export/config", ADMINAUTH(api.ExportConfig))